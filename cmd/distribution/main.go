@@ -0,0 +1,447 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"flag"
+	"fmt"
+	"math"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+	cfg "github.com/thenonexistent/nilis/internal/config"
+	"github.com/thenonexistent/nilis/internal/db"
+	"github.com/thenonexistent/nilis/pkg/sharding"
+	"github.com/thenonexistent/nilis/pkg/store"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/protobuf/types/known/emptypb"
+)
+
+const liveTimeout = time.Minute
+
+var (
+	strategies = []string{sharding.StrategyModulo, sharding.StrategyRing, sharding.StrategyRendezvous, sharding.StrategyJump}
+	hashes     = []string{sharding.HashFNV64, sharding.HashFNV64a, sharding.HashCRC64, sharding.HashSHA256}
+)
+
+// sampledKey is a key placed by the partitioners, standing for weight keys of
+// the sampled population.
+type sampledKey struct {
+	key    string
+	size   int
+	weight float64
+}
+
+type shardLoad struct {
+	keys  float64
+	bytes float64
+}
+
+// skew describes loads relative to each shard's weighted fair share.
+type skew struct {
+	maxKeys  float64
+	minKeys  float64
+	devKeys  float64
+	maxBytes float64
+	minBytes float64
+	devBytes float64
+}
+
+func main() {
+	configPath := flag.String("config", "", "configuration file describing the candidate shard list")
+	sampleSize := flag.Int("keys", 100000, "number of synthetic keys to sample when no key file or live cluster is given")
+	keysPath := flag.String("keys-file", "", "file with one key per line, optionally followed by a tab and its size in bytes")
+	liveAddress := flag.String("live", "", "address of a cluster node, samples the keys stored on every shard of the live cluster")
+	liveSample := flag.Int("live-sample", 10000, "number of keys sampled from each shard of the live cluster")
+	tlsCert := flag.String("tls-cert", "", "client certificate for a live cluster using mtls")
+	tlsKey := flag.String("tls-key", "", "client key for a live cluster using mtls")
+	tlsCA := flag.String("tls-ca", "", "ca certificate for a live cluster using mtls")
+	detail := flag.Bool("detail", false, "print per shard loads of every strategy and hash function instead of only the configured one")
+	flag.Parse()
+
+	log.Logger = log.Output(zerolog.ConsoleWriter{Out: os.Stderr})
+
+	if *configPath == "" {
+		log.Fatal().Str("module", "distribution").Msg("a -config file with the candidate shard list is required")
+	}
+
+	if *keysPath != "" && *liveAddress != "" {
+		log.Fatal().Str("module", "distribution").Msg("-keys-file and -live cannot be combined")
+	}
+
+	config, err := loadConfig(*configPath)
+	if err != nil {
+		log.Fatal().Str("module", "distribution").Err(err).Msg("failed loading candidate shard list")
+	}
+	shards := cfg.CreateShards(config)
+
+	var keys []sampledKey
+	if *liveAddress != "" {
+		creds, err := transportCredentials(*tlsCert, *tlsKey, *tlsCA)
+		if err != nil {
+			log.Fatal().Str("module", "distribution").Err(err).Msg("failed loading tls credentials")
+		}
+
+		var stats []*store.KeyStats
+		keys, stats, err = sampleLive(*liveAddress, *liveSample, creds, config.Queues.DeadLetterSuffix)
+		if err != nil {
+			log.Fatal().Str("module", "distribution").Err(err).Msg("failed sampling keys of the live cluster")
+		}
+
+		printLive(stats)
+	} else {
+		keys, err = loadKeys(*keysPath, *sampleSize)
+		if err != nil {
+			log.Fatal().Str("module", "distribution").Err(err).Msg("failed loading keys")
+		}
+	}
+
+	if len(keys) == 0 {
+		log.Fatal().Str("module", "distribution").Msg("no keys to sample")
+	}
+
+	configured := sharding.PartitionerSettings{
+		Strategy:     config.Sharding.Partitioner,
+		HashFunction: config.Sharding.HashFunction,
+		VirtualNodes: config.Sharding.VirtualNodes,
+		HashTags:     config.Sharding.HashTags,
+	}
+
+	totalKeys, totalBytes := 0.0, 0.0
+	for _, key := range keys {
+		totalKeys += key.weight
+		totalBytes += key.weight * float64(key.size)
+	}
+
+	fmt.Printf("candidate: %d shards, %d virtual nodes, hash tags %t\n", len(shards), configured.VirtualNodes, configured.HashTags)
+	fmt.Printf("sampled keys: %d, standing for %.0f keys and %.0f bytes\n\n", len(keys), totalKeys, totalBytes)
+
+	loads := make(map[sharding.PartitionerSettings]map[int]*shardLoad)
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(w, "strategy\thash\tkeys max\tkeys min\tkeys stddev\tbytes max\tbytes min\tbytes stddev\t")
+	for _, strategy := range strategies {
+		for _, hash := range hashes {
+			settings := configured
+			settings.Strategy = strategy
+			settings.HashFunction = hash
+
+			name := strategy
+			if settings == configured {
+				name += " *"
+			}
+
+			if strategy == sharding.StrategyModulo && !contiguousIDs(shards) {
+				fmt.Fprintf(w, "%s\t%s\t-\t-\t-\t-\t-\t-\t\n", name, hash)
+				continue
+			}
+
+			partitioner, err := sharding.NewPartitioner(settings, shards)
+			if err != nil {
+				log.Warn().Str("module", "distribution").Str("strategy", strategy).Str("hash", hash).Err(err).Msg("skipping partitioner")
+				continue
+			}
+
+			loads[settings] = distribute(partitioner, keys)
+			s := skewOf(shards, loads[settings], totalKeys, totalBytes)
+			fmt.Fprintf(w, "%s\t%s\t%.3f\t%.3f\t%.3f\t%.3f\t%.3f\t%.3f\t\n", name, hash, s.maxKeys, s.minKeys, s.devKeys, s.maxBytes, s.minBytes, s.devBytes)
+		}
+	}
+	w.Flush()
+
+	fmt.Println("\nloads are relative to each shard's weighted fair share, 1.000 is a perfect split, * marks the configured partitioner")
+	if !contiguousIDs(shards) {
+		fmt.Println("modulo needs shard ids running from 0 to n-1 and was skipped")
+	}
+
+	for _, strategy := range strategies {
+		for _, hash := range hashes {
+			settings := configured
+			settings.Strategy = strategy
+			settings.HashFunction = hash
+
+			if _, ok := loads[settings]; !ok || (!*detail && settings != configured) {
+				continue
+			}
+
+			fmt.Printf("\n%s partitioner, %s hash:\n", strategy, hash)
+			printLoads(shards, loads[settings], totalKeys, totalBytes)
+		}
+	}
+}
+
+func loadConfig(path string) (*cfg.Config, error) {
+	var config cfg.Config
+	if err := cfg.LoadConfigFile(path, &config); err != nil {
+		return nil, err
+	}
+
+	config.Sharding.Enabled = true
+	if err := cfg.ValidateConfig(&config); err != nil {
+		return nil, fmt.Errorf("invalid configuration %s: %w", path, err)
+	}
+
+	return &config, nil
+}
+
+func loadKeys(path string, sampleSize int) ([]sampledKey, error) {
+	if path == "" {
+		keys := make([]sampledKey, 0, sampleSize)
+		for i := 0; i < sampleSize; i++ {
+			key := fmt.Sprintf("key:%d", i)
+			keys = append(keys, sampledKey{key: key, size: len(key), weight: 1})
+		}
+		return keys, nil
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var keys []sampledKey
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "" {
+			continue
+		}
+
+		key := sampledKey{key: line, size: len(line), weight: 1}
+		if i := strings.LastIndexByte(line, '\t'); i >= 0 {
+			if size, err := strconv.Atoi(line[i+1:]); err == nil {
+				key.key, key.size = line[:i], size
+			}
+		}
+
+		keys = append(keys, key)
+	}
+
+	return keys, scanner.Err()
+}
+
+// sampleLive collects the key statistics of every shard of the live cluster
+// and turns their samples into keys weighted by the shard's key count.
+func sampleLive(address string, sampleSize int, creds credentials.TransportCredentials, deadLetterSuffix string) ([]sampledKey, []*store.KeyStats, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), liveTimeout)
+	defer cancel()
+
+	conn, err := grpc.NewClient(address, grpc.WithTransportCredentials(creds))
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed connecting to %s: %w", address, err)
+	}
+	defer conn.Close()
+
+	shardMap, err := store.NewStoreClient(conn).GetShardMap(ctx, &emptypb.Empty{})
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed fetching shard map: %w", err)
+	}
+
+	var keys []sampledKey
+	var stats []*store.KeyStats
+
+	for _, shard := range shardMap.GetCurrent().GetShards() {
+		shardStats, err := keyStats(ctx, shard, sampleSize, creds)
+		if err != nil {
+			log.Warn().Str("module", "distribution").Int32("shard_id", shard.Id).Str("address", shard.Address).Err(err).Msg("leaving shard out of the sample")
+			continue
+		}
+		stats = append(stats, shardStats)
+
+		if len(shardStats.Sample) == 0 {
+			continue
+		}
+
+		weight := float64(shardStats.Keys) / float64(len(shardStats.Sample))
+		for _, sample := range shardStats.Sample {
+			// a dead letter queue is placed with its source queue
+			key := sample.Key
+			if sample.Namespace == db.NamespaceQueues && deadLetterSuffix != "" {
+				key = strings.TrimSuffix(key, deadLetterSuffix)
+			}
+
+			keys = append(keys, sampledKey{key: key, size: int(sample.Size), weight: weight})
+		}
+	}
+
+	if len(stats) == 0 {
+		return nil, nil, errors.New("no shard of the live cluster could be sampled")
+	}
+
+	return keys, stats, nil
+}
+
+func keyStats(ctx context.Context, shard *store.ShardSpec, sampleSize int, creds credentials.TransportCredentials) (*store.KeyStats, error) {
+	conn, err := grpc.NewClient(shard.Address, grpc.WithTransportCredentials(creds))
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	// a node may serve several shards on one address
+	ctx = metadata.AppendToOutgoingContext(ctx, sharding.MetadataKey, strconv.Itoa(int(shard.Id)))
+
+	return store.NewClusterClient(conn).GetKeyStats(ctx, &store.KeyStatsRequest{SampleSize: int32(sampleSize)})
+}
+
+func transportCredentials(certFile string, keyFile string, caFile string) (credentials.TransportCredentials, error) {
+	if certFile == "" && keyFile == "" && caFile == "" {
+		return insecure.NewCredentials(), nil
+	}
+
+	clientCert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed initializing client certificate: %w", err)
+	}
+
+	caCert, err := os.ReadFile(caFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed loading ca certificate: %w", err)
+	}
+
+	certPool := x509.NewCertPool()
+	if !certPool.AppendCertsFromPEM(caCert) {
+		return nil, errors.New("failed appending ca to x509 certificate pool")
+	}
+
+	return credentials.NewTLS(&tls.Config{
+		Certificates: []tls.Certificate{clientCert},
+		RootCAs:      certPool,
+		MinVersion:   tls.VersionTLS13,
+		MaxVersion:   tls.VersionTLS13,
+	}), nil
+}
+
+func distribute(partitioner sharding.Partitioner, keys []sampledKey) map[int]*shardLoad {
+	loads := make(map[int]*shardLoad)
+	for _, shard := range partitioner.Shards() {
+		loads[shard.ID] = &shardLoad{}
+	}
+
+	for _, key := range keys {
+		load := loads[partitioner.ShardFromKey(key.key).ID]
+		load.keys += key.weight
+		load.bytes += key.weight * float64(key.size)
+	}
+
+	return loads
+}
+
+func skewOf(shards []sharding.Shard, loads map[int]*shardLoad, totalKeys float64, totalBytes float64) skew {
+	var keyRatios, byteRatios []float64
+
+	for _, shard := range shards {
+		share := fairShare(shards, shard)
+		load := loads[shard.ID]
+
+		keyRatios = append(keyRatios, load.keys/(totalKeys*share))
+		if totalBytes > 0 {
+			byteRatios = append(byteRatios, load.bytes/(totalBytes*share))
+		}
+	}
+
+	var s skew
+	s.maxKeys, s.minKeys, s.devKeys = spread(keyRatios)
+	s.maxBytes, s.minBytes, s.devBytes = spread(byteRatios)
+
+	return s
+}
+
+// spread returns the maximum, minimum and population standard deviation.
+func spread(values []float64) (float64, float64, float64) {
+	if len(values) == 0 {
+		return 0, 0, 0
+	}
+
+	maximum, minimum, sum := math.Inf(-1), math.Inf(1), 0.0
+	for _, v := range values {
+		maximum = max(maximum, v)
+		minimum = min(minimum, v)
+		sum += v
+	}
+
+	mean := sum / float64(len(values))
+	variance := 0.0
+	for _, v := range values {
+		variance += (v - mean) * (v - mean)
+	}
+
+	return maximum, minimum, math.Sqrt(variance / float64(len(values)))
+}
+
+func fairShare(shards []sharding.Shard, shard sharding.Shard) float64 {
+	total := 0
+	for _, s := range shards {
+		total += max(s.Weight, 1)
+	}
+
+	return float64(max(shard.Weight, 1)) / float64(total)
+}
+
+func contiguousIDs(shards []sharding.Shard) bool {
+	for id := range shards {
+		if _, ok := sharding.FindShardById(shards, id); !ok {
+			return false
+		}
+	}
+
+	return true
+}
+
+func printLoads(shards []sharding.Shard, loads map[int]*shardLoad, totalKeys float64, totalBytes float64) {
+	sorted := append([]sharding.Shard(nil), shards...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].ID < sorted[j].ID })
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(w, "shard\tweight\tfair share\tkeys\tkeys share\tbytes\tbytes share\t")
+	for _, shard := range sorted {
+		load := loads[shard.ID]
+		fmt.Fprintf(w, "%d\t%d\t%.2f%%\t%.0f\t%.2f%%\t%.0f\t%.2f%%\t\n",
+			shard.ID, max(shard.Weight, 1), 100*fairShare(shards, shard),
+			load.keys, percent(load.keys, totalKeys), load.bytes, percent(load.bytes, totalBytes))
+	}
+	w.Flush()
+}
+
+func printLive(stats []*store.KeyStats) {
+	sort.Slice(stats, func(i, j int) bool { return stats[i].ShardId < stats[j].ShardId })
+
+	var totalKeys, totalBytes uint64
+	for _, s := range stats {
+		totalKeys += s.Keys
+		totalBytes += s.Bytes
+	}
+
+	fmt.Printf("live cluster (epoch %d):\n", stats[0].Epoch)
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(w, "shard\tkeys\tkeys share\tbytes\tbytes share\tsampled\t")
+	for _, s := range stats {
+		fmt.Fprintf(w, "%d\t%d\t%.2f%%\t%d\t%.2f%%\t%d\t\n",
+			s.ShardId, s.Keys, percent(float64(s.Keys), float64(totalKeys)),
+			s.Bytes, percent(float64(s.Bytes), float64(totalBytes)), len(s.Sample))
+	}
+	w.Flush()
+	fmt.Println()
+}
+
+func percent(part float64, total float64) float64 {
+	if total == 0 {
+		return 0
+	}
+
+	return 100 * part / total
+}
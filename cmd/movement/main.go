@@ -0,0 +1,167 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"text/tabwriter"
+
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+	cfg "github.com/thenonexistent/nilis/internal/config"
+	"github.com/thenonexistent/nilis/pkg/sharding"
+)
+
+type shardMovement struct {
+	before   int
+	after    int
+	movedIn  int
+	movedOut int
+}
+
+func main() {
+	fromPath := flag.String("from", "", "configuration file describing the current topology")
+	toPath := flag.String("to", "", "configuration file describing the target topology")
+	sampleSize := flag.Int("keys", 100000, "number of synthetic keys to sample when no key file is given")
+	keysPath := flag.String("keys-file", "", "file with one key per line to use instead of synthetic keys")
+	flag.Parse()
+
+	log.Logger = log.Output(zerolog.ConsoleWriter{Out: os.Stderr})
+
+	if *fromPath == "" || *toPath == "" {
+		log.Fatal().Str("module", "movement").Msg("both -from and -to configuration files are required")
+	}
+
+	from, err := loadPartitioner(*fromPath)
+	if err != nil {
+		log.Fatal().Str("module", "movement").Err(err).Msg("failed loading current topology")
+	}
+
+	to, err := loadPartitioner(*toPath)
+	if err != nil {
+		log.Fatal().Str("module", "movement").Err(err).Msg("failed loading target topology")
+	}
+
+	keys, err := loadKeys(*keysPath, *sampleSize)
+	if err != nil {
+		log.Fatal().Str("module", "movement").Err(err).Msg("failed loading keys")
+	}
+
+	if len(keys) == 0 {
+		log.Fatal().Str("module", "movement").Msg("no keys to sample")
+	}
+
+	movements := make(map[int]*shardMovement)
+	movement := func(id int) *shardMovement {
+		if _, ok := movements[id]; !ok {
+			movements[id] = &shardMovement{}
+		}
+		return movements[id]
+	}
+
+	moved := 0
+	for _, key := range keys {
+		before := from.ShardFromKey(key)
+		after := to.ShardFromKey(key)
+
+		movement(before.ID).before++
+		movement(after.ID).after++
+
+		if before.ID != after.ID {
+			moved++
+			movement(before.ID).movedOut++
+			movement(after.ID).movedIn++
+		}
+	}
+
+	fmt.Printf("current: %s partitioner, %s hash, %d shards\n", from.Settings().Strategy, from.Settings().HashFunction, len(from.Shards()))
+	fmt.Printf("target:  %s partitioner, %s hash, %d shards\n", to.Settings().Strategy, to.Settings().HashFunction, len(to.Shards()))
+	fmt.Printf("sampled keys: %d\n", len(keys))
+	fmt.Printf("moved keys:   %d (%.2f%%)\n", moved, 100*float64(moved)/float64(len(keys)))
+	fmt.Printf("minimum possible movement: %.2f%%\n\n", 100*minimumMovement(from.Shards(), to.Shards()))
+
+	ids := make([]int, 0, len(movements))
+	for id := range movements {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(w, "shard\tbefore\tafter\tmoved out\tmoved in\t")
+	for _, id := range ids {
+		m := movements[id]
+		fmt.Fprintf(w, "%d\t%d\t%d\t%d\t%d\t\n", id, m.before, m.after, m.movedOut, m.movedIn)
+	}
+	w.Flush()
+}
+
+func loadPartitioner(path string) (sharding.Partitioner, error) {
+	var config cfg.Config
+	if err := cfg.LoadConfigFile(path, &config); err != nil {
+		return nil, err
+	}
+
+	config.Sharding.Enabled = true
+	if err := cfg.ValidateConfig(&config); err != nil {
+		return nil, fmt.Errorf("invalid configuration %s: %w", path, err)
+	}
+
+	return cfg.CreatePartitioner(&config, cfg.CreateShards(&config))
+}
+
+func loadKeys(path string, sampleSize int) ([]string, error) {
+	if path == "" {
+		keys := make([]string, 0, sampleSize)
+		for i := 0; i < sampleSize; i++ {
+			keys = append(keys, fmt.Sprintf("key:%d", i))
+		}
+		return keys, nil
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var keys []string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		if line := scanner.Text(); line != "" {
+			keys = append(keys, line)
+		}
+	}
+
+	return keys, scanner.Err()
+}
+
+// minimumMovement is the fraction of keys that has to move for every shard to
+// end up with its weighted share of the target topology.
+func minimumMovement(from []sharding.Shard, to []sharding.Shard) float64 {
+	share := func(shards []sharding.Shard) map[int]float64 {
+		total := 0
+		for _, shard := range shards {
+			total += max(shard.Weight, 1)
+		}
+
+		shares := make(map[int]float64, len(shards))
+		for _, shard := range shards {
+			shares[shard.ID] = float64(max(shard.Weight, 1)) / float64(total)
+		}
+		return shares
+	}
+
+	before := share(from)
+	after := share(to)
+
+	gained := 0.0
+	for id, target := range after {
+		if target > before[id] {
+			gained += target - before[id]
+		}
+	}
+
+	return gained
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+
+	"github.com/rs/zerolog/log"
+	"github.com/thenonexistent/nilis/pkg/store"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Backup writes a consistent copy of the local database to a path on this
+// node, one file per stripe, while it keeps serving writes.
+func (s *Server) Backup(ctx context.Context, in *store.BackupRequest) (*store.BackupReport, error) {
+	if !filepath.IsAbs(in.Path) {
+		return nil, status.Error(codes.InvalidArgument, "backup path must be absolute")
+	}
+
+	if err := os.MkdirAll(filepath.Dir(in.Path), 0o755); err != nil {
+		log.Error().Str("module", "server").Str("path", in.Path).Err(err).Msg("failed creating backup directory")
+		return nil, status.Error(codes.Internal, "failed creating backup directory")
+	}
+
+	written, err := s.db.Backup(in.Path)
+	if errors.Is(err, os.ErrExist) {
+		return nil, status.Errorf(codes.AlreadyExists, "backup %s already exists", in.Path)
+	}
+	if err != nil {
+		log.Error().Str("module", "server").Str("path", in.Path).Err(err).Msg("failed backing up local database")
+		return nil, status.Error(codes.Internal, "failed backing up database")
+	}
+
+	log.Info().Str("module", "server").Str("path", in.Path).Int("stripes", s.db.Stripes()).Int64("bytes", written).Msg("backed up local database")
+
+	return &store.BackupReport{
+		Path:    in.Path,
+		ShardId: int32(s.shard.ID),
+		Stripes: int32(s.db.Stripes()),
+		Bytes:   written,
+	}, nil
+}
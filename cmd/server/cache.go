@@ -0,0 +1,215 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"github.com/thenonexistent/nilis/internal/cache"
+	cfg "github.com/thenonexistent/nilis/internal/config"
+	"github.com/thenonexistent/nilis/pkg/store"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/emptypb"
+)
+
+const evictionSubscriberBuffer = 256
+
+type evictionFeed struct {
+	mu          sync.Mutex
+	subscribers map[chan *store.EvictionEvent]struct{}
+}
+
+func newEvictionFeed() *evictionFeed {
+	return &evictionFeed{
+		subscribers: make(map[chan *store.EvictionEvent]struct{}),
+	}
+}
+
+func (f *evictionFeed) subscribe() chan *store.EvictionEvent {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	ch := make(chan *store.EvictionEvent, evictionSubscriberBuffer)
+	f.subscribers[ch] = struct{}{}
+	return ch
+}
+
+func (f *evictionFeed) unsubscribe(ch chan *store.EvictionEvent) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	delete(f.subscribers, ch)
+}
+
+// publish never blocks the write path, slow subscribers miss events instead.
+func (f *evictionFeed) publish(keys []string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	now := time.Now().UnixMilli()
+	for ch := range f.subscribers {
+		for _, key := range keys {
+			select {
+			case ch <- &store.EvictionEvent{Key: key, EvictedAtUnixMs: now}:
+			default:
+			}
+		}
+	}
+}
+
+// initCache tracks the plain keys already on disk, collections and queues are
+// not counted against the cache budget.
+func (s *Server) initCache() error {
+	if s.config.Server.Mode != cfg.ModeCache {
+		return nil
+	}
+
+	tracker, err := cache.NewTracker(cache.Policy(s.config.Cache.EvictionPolicy), s.config.Cache.MaxBytes, s.config.Cache.MaxKeys)
+	if err != nil {
+		return err
+	}
+
+	var victims []string
+	err = s.db.ForEachKey(func(key string, size int) error {
+		evicted, err := tracker.Admit(key, int64(len(key)+size))
+		if err != nil {
+			evicted = []string{key}
+		}
+		victims = append(victims, evicted...)
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed loading cached keys: %w", err)
+	}
+
+	// the budget may have shrunk since the database was last written
+	if len(victims) > 0 {
+		if err := s.db.DeleteKeys(victims, nil); err != nil {
+			return fmt.Errorf("failed evicting keys over budget: %w", err)
+		}
+	}
+
+	s.cache = tracker
+	if s.config.Cache.EmitEvents {
+		s.evictions = newEvictionFeed()
+	}
+
+	stats := tracker.Stats()
+	log.Info().Str("module", "cache").
+		Str("eviction_policy", s.config.Cache.EvictionPolicy).
+		Int64("keys", stats.Keys).
+		Int64("bytes", stats.Bytes).
+		Int("evicted", len(victims)).
+		Msg("running in cache mode")
+
+	return nil
+}
+
+// admitCachedKey records a write of key and returns the keys to evict. Writes
+// call it inside their transaction, so an eviction of the same key either
+// runs before the write or finds the key tracked again and keeps it.
+func (s *Server) admitCachedKey(key string, size int) []string {
+	if s.cache == nil {
+		return nil
+	}
+
+	victims, err := s.cache.Admit(key, int64(len(key)+size))
+	if err != nil {
+		log.Error().Str("module", "cache").Str("key", key).Err(err).Msg("failed admitting key to cache")
+		return nil
+	}
+
+	return victims
+}
+
+// evictCachedKeys deletes the keys handed out by admitCachedKey, skipping the
+// ones that were written again in the meantime.
+func (s *Server) evictCachedKeys(victims []string) {
+	if len(victims) == 0 {
+		return
+	}
+
+	var evicted []string
+	err := s.db.DeleteKeys(victims, func(key string) bool {
+		if s.cache.Contains(key) {
+			return false
+		}
+		evicted = append(evicted, key)
+		return true
+	})
+	if err != nil {
+		log.Error().Str("module", "cache").Int("count", len(victims)).Err(err).Msg("failed deleting evicted keys")
+		return
+	}
+
+	if len(evicted) == 0 {
+		return
+	}
+
+	log.Debug().Str("module", "cache").Strs("keys", evicted).Msg("evicted keys")
+
+	if s.evictions != nil {
+		s.evictions.publish(evicted)
+	}
+}
+
+func (s *Server) fitsCache(key string, size int) bool {
+	return s.cache == nil || s.cache.Fits(int64(len(key)+size))
+}
+
+func (s *Server) touchCachedKey(key string) {
+	if s.cache != nil {
+		s.cache.Touch(key)
+	}
+}
+
+func (s *Server) forgetCachedKeys(keys []string) {
+	if s.cache == nil {
+		return
+	}
+
+	for _, key := range keys {
+		s.cache.Remove(key)
+	}
+}
+
+func (s *Server) GetCacheStats(ctx context.Context, in *emptypb.Empty) (*store.CacheStats, error) {
+	if s.cache == nil {
+		return nil, status.Error(codes.FailedPrecondition, "server is not running in cache mode")
+	}
+
+	stats := s.cache.Stats()
+
+	return &store.CacheStats{
+		Keys:           stats.Keys,
+		Bytes:          stats.Bytes,
+		Evictions:      stats.Evictions,
+		MaxKeys:        s.config.Cache.MaxKeys,
+		MaxBytes:       s.config.Cache.MaxBytes,
+		EvictionPolicy: s.config.Cache.EvictionPolicy,
+	}, nil
+}
+
+func (s *Server) WatchEvictions(in *emptypb.Empty, stream grpc.ServerStreamingServer[store.EvictionEvent]) error {
+	if s.evictions == nil {
+		return status.Error(codes.FailedPrecondition, "eviction events are not enabled")
+	}
+
+	ch := s.evictions.subscribe()
+	defer s.evictions.unsubscribe(ch)
+
+	for {
+		select {
+		case <-stream.Context().Done():
+			return nil
+		case event := <-ch:
+			if err := stream.Send(event); err != nil {
+				return err
+			}
+		}
+	}
+}
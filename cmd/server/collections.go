@@ -0,0 +1,216 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/rs/zerolog/log"
+	"github.com/thenonexistent/nilis/internal/db"
+	"github.com/thenonexistent/nilis/pkg/store"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func (s *Server) HashSet(ctx context.Context, in *store.HashSetRequest) (*store.Count, error) {
+	client, err := s.routeKey(ctx, in.Key)
+	if err != nil {
+		return nil, err
+	}
+	if client != nil {
+		return client.HashSet(forwardContext(ctx), in)
+	}
+
+	added, err := s.db.HashSet(in.Key, in.Fields)
+	if err != nil {
+		return nil, collectionError(err, in.Key, "hash set")
+	}
+
+	return &store.Count{Count: int64(added)}, nil
+}
+
+func (s *Server) HashGet(ctx context.Context, in *store.HashField) (*store.HashField, error) {
+	client, err := s.routeKey(ctx, in.Key)
+	if err != nil {
+		return nil, err
+	}
+	if client != nil {
+		return client.HashGet(forwardContext(ctx), in)
+	}
+
+	value, err := s.db.HashGet(in.Key, in.Field)
+	if err != nil {
+		return nil, collectionError(err, in.Key, "hash get")
+	}
+
+	if value == nil {
+		return nil, status.Errorf(codes.NotFound, "field %s not found in key %s", in.Field, in.Key)
+	}
+
+	return &store.HashField{
+		Key:   in.Key,
+		Field: in.Field,
+		Value: value,
+	}, nil
+}
+
+func (s *Server) HashGetAll(ctx context.Context, in *store.Key) (*store.Hash, error) {
+	client, err := s.routeKey(ctx, in.Key)
+	if err != nil {
+		return nil, err
+	}
+	if client != nil {
+		return client.HashGetAll(forwardContext(ctx), in)
+	}
+
+	fields, err := s.db.HashGetAll(in.Key)
+	if err != nil {
+		return nil, collectionError(err, in.Key, "hash get all")
+	}
+
+	return &store.Hash{
+		Key:    in.Key,
+		Fields: fields,
+	}, nil
+}
+
+func (s *Server) HashDelete(ctx context.Context, in *store.HashFields) (*store.Count, error) {
+	client, err := s.routeKey(ctx, in.Key)
+	if err != nil {
+		return nil, err
+	}
+	if client != nil {
+		return client.HashDelete(forwardContext(ctx), in)
+	}
+
+	removed, err := s.db.HashDelete(in.Key, in.Fields)
+	if err != nil {
+		return nil, collectionError(err, in.Key, "hash delete")
+	}
+
+	return &store.Count{Count: int64(removed)}, nil
+}
+
+func (s *Server) ListPush(ctx context.Context, in *store.ListPushRequest) (*store.Count, error) {
+	client, err := s.routeKey(ctx, in.Key)
+	if err != nil {
+		return nil, err
+	}
+	if client != nil {
+		return client.ListPush(forwardContext(ctx), in)
+	}
+
+	length, err := s.db.ListPush(in.Key, in.Values, in.Left)
+	if err != nil {
+		return nil, collectionError(err, in.Key, "list push")
+	}
+
+	return &store.Count{Count: int64(length)}, nil
+}
+
+func (s *Server) ListPop(ctx context.Context, in *store.ListPopRequest) (*store.Value, error) {
+	client, err := s.routeKey(ctx, in.Key)
+	if err != nil {
+		return nil, err
+	}
+	if client != nil {
+		return client.ListPop(forwardContext(ctx), in)
+	}
+
+	value, err := s.db.ListPop(in.Key, in.Left)
+	if err != nil {
+		return nil, collectionError(err, in.Key, "list pop")
+	}
+
+	if value == nil {
+		return nil, status.Errorf(codes.NotFound, "list %s is empty", in.Key)
+	}
+
+	return &store.Value{
+		Key:   in.Key,
+		Value: value,
+	}, nil
+}
+
+func (s *Server) ListRange(ctx context.Context, in *store.ListRangeRequest) (*store.Members, error) {
+	client, err := s.routeKey(ctx, in.Key)
+	if err != nil {
+		return nil, err
+	}
+	if client != nil {
+		return client.ListRange(forwardContext(ctx), in)
+	}
+
+	values, err := s.db.ListRange(in.Key, in.Start, in.Stop)
+	if err != nil {
+		return nil, collectionError(err, in.Key, "list range")
+	}
+
+	return &store.Members{
+		Key:     in.Key,
+		Members: values,
+	}, nil
+}
+
+func (s *Server) SetAdd(ctx context.Context, in *store.Members) (*store.Count, error) {
+	client, err := s.routeKey(ctx, in.Key)
+	if err != nil {
+		return nil, err
+	}
+	if client != nil {
+		return client.SetAdd(forwardContext(ctx), in)
+	}
+
+	added, err := s.db.SetAdd(in.Key, in.Members)
+	if err != nil {
+		return nil, collectionError(err, in.Key, "set add")
+	}
+
+	return &store.Count{Count: int64(added)}, nil
+}
+
+func (s *Server) SetRemove(ctx context.Context, in *store.Members) (*store.Count, error) {
+	client, err := s.routeKey(ctx, in.Key)
+	if err != nil {
+		return nil, err
+	}
+	if client != nil {
+		return client.SetRemove(forwardContext(ctx), in)
+	}
+
+	removed, err := s.db.SetRemove(in.Key, in.Members)
+	if err != nil {
+		return nil, collectionError(err, in.Key, "set remove")
+	}
+
+	return &store.Count{Count: int64(removed)}, nil
+}
+
+func (s *Server) SetMembers(ctx context.Context, in *store.Key) (*store.Members, error) {
+	client, err := s.routeKey(ctx, in.Key)
+	if err != nil {
+		return nil, err
+	}
+	if client != nil {
+		return client.SetMembers(forwardContext(ctx), in)
+	}
+
+	members, err := s.db.SetMembers(in.Key)
+	if err != nil {
+		return nil, collectionError(err, in.Key, "set members")
+	}
+
+	return &store.Members{
+		Key:     in.Key,
+		Members: members,
+	}, nil
+}
+
+func collectionError(err error, key string, operation string) error {
+	if errors.Is(err, db.ErrWrongType) {
+		return wrongTypeError(key, fmt.Sprintf("%s: key %s holds the wrong kind of value", operation, key))
+	}
+
+	log.Error().Str("module", "server").Str("key", key).Str("operation", operation).Err(err).Msg("failed collection operation in local database")
+	return status.Errorf(codes.Internal, "failed %s in database", operation)
+}
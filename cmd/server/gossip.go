@@ -0,0 +1,245 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/rs/zerolog/log"
+	"github.com/thenonexistent/nilis/internal/membership"
+	"github.com/thenonexistent/nilis/pkg/sharding"
+	"github.com/thenonexistent/nilis/pkg/store"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/backoff"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/emptypb"
+)
+
+// grpcTransport carries membership probes over the Cluster service. Replicas
+// are probed as well, so it keeps its own connections instead of the shard
+// pool.
+type grpcTransport struct {
+	dialOptions []grpc.DialOption
+
+	mu    sync.Mutex
+	conns map[string]store.ClusterClient
+}
+
+func (t *grpcTransport) client(address string) (store.ClusterClient, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if client, ok := t.conns[address]; ok {
+		return client, nil
+	}
+
+	conn, err := grpc.NewClient(address, t.dialOptions...)
+	if err != nil {
+		return nil, fmt.Errorf("failed creating client for %s: %w", address, err)
+	}
+
+	client := store.NewClusterClient(conn)
+	t.conns[address] = client
+	return client, nil
+}
+
+func (t *grpcTransport) Ping(ctx context.Context, target string, msg membership.Message) (membership.Message, error) {
+	client, err := t.client(target)
+	if err != nil {
+		return membership.Message{}, err
+	}
+
+	ack, err := client.Ping(ctx, gossipToProto(msg), grpc.WaitForReady(true))
+	if err != nil {
+		return membership.Message{}, err
+	}
+
+	return gossipFromProto(ack), nil
+}
+
+func (t *grpcTransport) PingReq(ctx context.Context, via string, target string, msg membership.Message) (membership.Message, error) {
+	client, err := t.client(via)
+	if err != nil {
+		return membership.Message{}, err
+	}
+
+	ack, err := client.PingReq(ctx, &store.PingRequest{Target: target, Message: gossipToProto(msg)}, grpc.WaitForReady(true))
+	if err != nil {
+		return membership.Message{}, err
+	}
+
+	return gossipFromProto(ack), nil
+}
+
+func (s *Server) initGossip() error {
+	dialOptions, err := s.dialOptions()
+	if err != nil {
+		return err
+	}
+
+	// reconnecting no slower than members are probed keeps a recovered
+	// member from looking dead because of connection backoff
+	dialOptions = append(dialOptions, grpc.WithConnectParams(grpc.ConnectParams{
+		Backoff: backoff.Config{
+			BaseDelay:  s.config.Gossip.ProbeTimeout,
+			Multiplier: backoff.DefaultConfig.Multiplier,
+			Jitter:     backoff.DefaultConfig.Jitter,
+			MaxDelay:   s.config.Gossip.ProbeInterval,
+		},
+		MinConnectTimeout: s.config.Gossip.ProbeTimeout,
+	}))
+
+	s.gossip = membership.NewNode(membership.Config{
+		Address:          s.address(),
+		Peers:            s.memberAddresses,
+		Transport:        &grpcTransport{dialOptions: dialOptions, conns: make(map[string]store.ClusterClient)},
+		ProbeInterval:    s.config.Gossip.ProbeInterval,
+		ProbeTimeout:     s.config.Gossip.ProbeTimeout,
+		IndirectProbes:   s.config.Gossip.IndirectProbes,
+		SuspicionTimeout: s.config.Gossip.SuspicionTimeout,
+		OnChange: func(m membership.Member) {
+			log.Info().Str("module", "gossip").
+				Str("address", m.Address).
+				Str("state", m.State.String()).
+				Uint64("incarnation", m.Incarnation).
+				Msg("member changed state")
+		},
+	})
+
+	go s.gossip.Run(s.ctx)
+	return nil
+}
+
+// memberAddresses lists every shard and replica of the current topology, and
+// of the target topology while resharding.
+func (s *Server) memberAddresses() []string {
+	var addresses []string
+	for address := range s.memberRoles() {
+		addresses = append(addresses, address)
+	}
+
+	return addresses
+}
+
+type memberRole struct {
+	shardID int
+	replica bool
+}
+
+func (s *Server) memberRoles() map[string]memberRole {
+	current, target := s.topologies()
+
+	shards := current.shards()
+	if target != nil {
+		shards = append(shards, target.shards()...)
+	}
+
+	roles := make(map[string]memberRole)
+	for _, shard := range shards {
+		roles[shard.Address] = memberRole{shardID: shard.ID}
+		for _, replica := range shard.Replicas {
+			roles[replica.Address] = memberRole{shardID: shard.ID, replica: true}
+		}
+	}
+
+	return roles
+}
+
+// shardDown reports whether failure detection declared the shard dead, so
+// requests for it fail fast instead of waiting for a timeout.
+func (s *Server) shardDown(shard sharding.Shard) bool {
+	return s.gossip != nil && s.gossip.State(shard.Address) == membership.StateDead
+}
+
+func shardDownError(shard sharding.Shard) error {
+	return status.Errorf(codes.Unavailable, "shard %d at %s is down", shard.ID, shard.Address)
+}
+
+func (s *Server) Ping(ctx context.Context, in *store.GossipMessage) (*store.GossipMessage, error) {
+	if s.gossip == nil {
+		return nil, status.Error(codes.FailedPrecondition, "failure detection is disabled")
+	}
+
+	return gossipToProto(s.gossip.HandlePing(gossipFromProto(in))), nil
+}
+
+func (s *Server) PingReq(ctx context.Context, in *store.PingRequest) (*store.GossipMessage, error) {
+	if s.gossip == nil {
+		return nil, status.Error(codes.FailedPrecondition, "failure detection is disabled")
+	}
+
+	ack, err := s.gossip.HandlePingReq(ctx, in.Target, gossipFromProto(in.Message))
+	if err != nil {
+		return nil, status.Errorf(codes.Unavailable, "%s did not answer: %v", in.Target, err)
+	}
+
+	return gossipToProto(ack), nil
+}
+
+func (s *Server) ClusterStatus(ctx context.Context, in *emptypb.Empty) (*store.ClusterState, error) {
+	if s.gossip == nil {
+		return nil, status.Error(codes.FailedPrecondition, "failure detection is disabled")
+	}
+
+	roles := s.memberRoles()
+
+	out := &store.ClusterState{
+		Self:        s.address(),
+		Incarnation: s.gossip.Incarnation(),
+	}
+
+	for _, m := range s.gossip.Members() {
+		role := roles[m.Address]
+		out.Members = append(out.Members, &store.MemberStatus{
+			Address:            m.Address,
+			ShardId:            int32(role.shardID),
+			Replica:            role.replica,
+			State:              m.State.String(),
+			Incarnation:        m.Incarnation,
+			StateChangedUnixMs: m.Since.UnixMilli(),
+		})
+	}
+
+	return out, nil
+}
+
+func gossipToProto(msg membership.Message) *store.GossipMessage {
+	out := &store.GossipMessage{
+		From:        msg.From,
+		Incarnation: msg.Incarnation,
+		Updates:     make([]*store.GossipUpdate, 0, len(msg.Updates)),
+	}
+
+	for _, update := range msg.Updates {
+		out.Updates = append(out.Updates, &store.GossipUpdate{
+			Address:     update.Address,
+			State:       update.State.String(),
+			Incarnation: update.Incarnation,
+		})
+	}
+
+	return out
+}
+
+func gossipFromProto(in *store.GossipMessage) membership.Message {
+	msg := membership.Message{
+		From:        in.GetFrom(),
+		Incarnation: in.GetIncarnation(),
+	}
+
+	for _, update := range in.GetUpdates() {
+		state, err := membership.ParseState(update.State)
+		if err != nil {
+			continue
+		}
+
+		msg.Updates = append(msg.Updates, membership.Update{
+			Address:     update.Address,
+			State:       state,
+			Incarnation: update.Incarnation,
+		})
+	}
+
+	return msg
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"github.com/thenonexistent/nilis/pkg/sharding"
+	"github.com/thenonexistent/nilis/pkg/store"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	handshakeTimeout       = 3 * time.Second
+	handshakeRetryInterval = time.Second
+)
+
+func (s *Server) partitionerInfo() *store.PartitionerInfo {
+	current, _ := s.topologies()
+	settings := current.partitioner.Settings()
+
+	return &store.PartitionerInfo{
+		ShardId:      int32(s.shard.ID),
+		Strategy:     settings.Strategy,
+		HashFunction: settings.HashFunction,
+		VirtualNodes: int32(settings.VirtualNodes),
+		HashTags:     settings.HashTags,
+		Fingerprint:  current.fingerprint(),
+	}
+}
+
+// Handshake lets a starting peer compare its partitioner settings with ours.
+// A mismatch is rejected so the peer refuses to start, the running node keeps
+// serving with the settings the rest of the cluster agreed on. While
+// resharding, peers joining with the target topology are accepted as well.
+func (s *Server) Handshake(ctx context.Context, in *store.PartitionerInfo) (*store.PartitionerInfo, error) {
+	local := s.partitionerInfo()
+
+	if _, target := s.topologies(); target != nil && in.Fingerprint == target.fingerprint() {
+		return local, nil
+	}
+
+	if in.Fingerprint != local.Fingerprint {
+		log.Error().Str("module", "cluster").
+			Int32("peer_shard_id", in.ShardId).
+			Str("peer_strategy", in.Strategy).
+			Str("peer_hash_function", in.HashFunction).
+			Int32("peer_virtual_nodes", in.VirtualNodes).
+			Bool("peer_hash_tags", in.HashTags).
+			Msg("rejected peer with mismatching partitioner settings")
+
+		return nil, status.Errorf(codes.FailedPrecondition,
+			"partitioner mismatch with shard %d: strategy=%s hash_function=%s virtual_nodes=%d hash_tags=%t fingerprint=%s",
+			local.ShardId, local.Strategy, local.HashFunction, local.VirtualNodes, local.HashTags, local.Fingerprint)
+	}
+
+	return local, nil
+}
+
+// VerifyPeers compares the partitioner settings with every peer. Peers that
+// are unreachable, for example because they are still starting, are retried
+// until they answer or ctx expires, so nodes starting together verify each
+// other once both are listening.
+func (s *Server) VerifyPeers(ctx context.Context) error {
+	local := s.partitionerInfo()
+
+	current, _ := s.topologies()
+
+	var pending []sharding.Shard
+	for _, shard := range current.shards() {
+		// shards at this node's address are served by this process and share
+		// its configuration
+		if shard.ID == s.shard.ID || shard.Address == s.address() {
+			continue
+		}
+		pending = append(pending, shard)
+	}
+
+	ticker := time.NewTicker(handshakeRetryInterval)
+	defer ticker.Stop()
+
+	for {
+		var unverified []sharding.Shard
+		for _, shard := range pending {
+			err := s.handshake(ctx, shard, local)
+			if status.Code(err) == codes.FailedPrecondition {
+				return fmt.Errorf("shard %d rejected partitioner settings: %s", shard.ID, status.Convert(err).Message())
+			}
+			if err != nil {
+				log.Warn().Str("module", "cluster").Int("shard_id", shard.ID).Err(err).Msg("could not verify partitioner settings with peer, retrying")
+				unverified = append(unverified, shard)
+			}
+		}
+
+		if len(unverified) == 0 {
+			return nil
+		}
+		pending = unverified
+
+		select {
+		case <-ctx.Done():
+			ids := make([]int, 0, len(pending))
+			for _, shard := range pending {
+				ids = append(ids, shard.ID)
+			}
+			return fmt.Errorf("could not verify partitioner settings with shards %v: %w", ids, ctx.Err())
+		case <-ticker.C:
+		}
+	}
+}
+
+func (s *Server) handshake(ctx context.Context, shard sharding.Shard, local *store.PartitionerInfo) error {
+	client, err := s.peer(shard)
+	if err != nil {
+		return err
+	}
+
+	callCtx, cancel := context.WithTimeout(ctx, handshakeTimeout)
+	defer cancel()
+
+	_, err = client.Handshake(callCtx, local)
+	return err
+}
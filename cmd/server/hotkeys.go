@@ -0,0 +1,169 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"github.com/thenonexistent/nilis/internal/db"
+	"github.com/thenonexistent/nilis/internal/hotkeys"
+	"github.com/thenonexistent/nilis/pkg/store"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const defaultHotKeysLimit = 10
+
+// hotKeyOps lists the keyed methods whose accesses are tracked.
+var hotKeyOps = map[string]hotkeys.Op{
+	store.Store_Get_FullMethodName:                   hotkeys.Read,
+	store.Store_MultiGet_FullMethodName:              hotkeys.Read,
+	store.Store_HashGet_FullMethodName:               hotkeys.Read,
+	store.Store_HashGetAll_FullMethodName:            hotkeys.Read,
+	store.Store_ListRange_FullMethodName:             hotkeys.Read,
+	store.Store_SetMembers_FullMethodName:            hotkeys.Read,
+	store.Store_SortedSetRank_FullMethodName:         hotkeys.Read,
+	store.Store_SortedSetRangeByRank_FullMethodName:  hotkeys.Read,
+	store.Store_SortedSetRangeByScore_FullMethodName: hotkeys.Read,
+
+	store.Store_Set_FullMethodName:             hotkeys.Write,
+	store.Store_Delete_FullMethodName:          hotkeys.Write,
+	store.Store_HashSet_FullMethodName:         hotkeys.Write,
+	store.Store_HashDelete_FullMethodName:      hotkeys.Write,
+	store.Store_ListPush_FullMethodName:        hotkeys.Write,
+	store.Store_ListPop_FullMethodName:         hotkeys.Write,
+	store.Store_SetAdd_FullMethodName:          hotkeys.Write,
+	store.Store_SetRemove_FullMethodName:       hotkeys.Write,
+	store.Store_SortedSetAdd_FullMethodName:    hotkeys.Write,
+	store.Store_SortedSetRemove_FullMethodName: hotkeys.Write,
+	store.Store_Enqueue_FullMethodName:         hotkeys.Write,
+	store.Store_Dequeue_FullMethodName:         hotkeys.Write,
+	store.Store_Ack_FullMethodName:             hotkeys.Write,
+	store.Store_Nack_FullMethodName:            hotkeys.Write,
+}
+
+type keyedRequest interface {
+	GetKey() string
+}
+
+type queueRequest interface {
+	GetQueue() string
+}
+
+// UnaryHotKeyInterceptor samples the keyed requests this node handles into
+// the hot key detector of the shard serving them. Lookups of missing keys
+// count as accesses too.
+func (r *shardRouter) UnaryHotKeyInterceptor(
+	ctx context.Context,
+	req any,
+	info *grpc.UnaryServerInfo,
+	handler grpc.UnaryHandler,
+) (any, error) {
+	resp, err := handler(ctx, req)
+
+	op, ok := hotKeyOps[info.FullMethod]
+	if !ok || (err != nil && status.Code(err) != codes.NotFound) {
+		return resp, err
+	}
+
+	switch in := req.(type) {
+	case *store.Keys:
+		for _, key := range in.Keys {
+			r.sampleHotKey(ctx, db.NamespaceData, key, key, op)
+		}
+	case queueRequest:
+		r.sampleHotKey(ctx, db.NamespaceQueues, in.GetQueue(), r.primary.queueRoutingKey(in.GetQueue()), op)
+	case keyedRequest:
+		r.sampleHotKey(ctx, db.NamespaceData, in.GetKey(), in.GetKey(), op)
+	}
+
+	return resp, err
+}
+
+func (r *shardRouter) sampleHotKey(ctx context.Context, namespace string, key string, routingKey string, op hotkeys.Op) {
+	if !r.primary.hotKeys.Sample() {
+		return
+	}
+
+	if s, err := r.server(ctx, routingKey); err == nil {
+		s.recordHotKey(ctx, namespace, key, routingKey, op)
+	}
+}
+
+// recordHotKey records an access unless the request was forwarded to the
+// key's owner, which counts it itself.
+func (s *Server) recordHotKey(ctx context.Context, namespace string, key string, routingKey string, op hotkeys.Op) {
+	if s.config.Sharding.Enabled && !isForwarded(ctx) {
+		if owner, _ := s.writeOwner(routingKey); owner.ID != s.shard.ID {
+			return
+		}
+	}
+
+	s.hotKeys.Record(namespace+"/"+key, op)
+}
+
+func (s *Server) GetHotKeys(ctx context.Context, in *store.HotKeysRequest) (*store.HotKeys, error) {
+	if s.hotKeys == nil {
+		return nil, status.Error(codes.FailedPrecondition, "hot key detection is not enabled")
+	}
+
+	limit := int(in.Limit)
+	if limit == 0 {
+		limit = defaultHotKeysLimit
+	}
+	if limit < 0 || limit > s.config.HotKeys.Capacity {
+		return nil, status.Errorf(codes.InvalidArgument, "limit must be between 1 and %d", s.config.HotKeys.Capacity)
+	}
+
+	order := hotkeys.Order(in.Order)
+	switch order {
+	case "":
+		order = hotkeys.ByTotal
+	case hotkeys.ByTotal, hotkeys.ByReads, hotkeys.ByWrites:
+	default:
+		return nil, status.Errorf(codes.InvalidArgument, "order must be %s, %s or %s", hotkeys.ByTotal, hotkeys.ByReads, hotkeys.ByWrites)
+	}
+
+	out := &store.HotKeys{
+		WindowMs:   s.hotKeys.Window().Milliseconds(),
+		SampleRate: s.hotKeys.SampleRate(),
+	}
+
+	for _, stats := range s.hotKeys.Top(limit, order) {
+		namespace, key, _ := strings.Cut(stats.Key, "/")
+		out.Keys = append(out.Keys, &store.HotKey{
+			Namespace: namespace,
+			Key:       key,
+			Reads:     stats.Reads,
+			Writes:    stats.Writes,
+		})
+	}
+
+	return out, nil
+}
+
+func (s *Server) logHotKeys(ctx context.Context) {
+	ticker := time.NewTicker(s.config.HotKeys.LogInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		for i, stats := range s.hotKeys.Top(s.config.HotKeys.LogTop, hotkeys.ByTotal) {
+			namespace, key, _ := strings.Cut(stats.Key, "/")
+			log.Info().Str("module", "hotkeys").
+				Int("rank", i+1).
+				Str("namespace", namespace).
+				Str("key", key).
+				Uint64("reads", stats.Reads).
+				Uint64("writes", stats.Writes).
+				Msg("hot key")
+		}
+	}
+}
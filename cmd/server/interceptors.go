@@ -4,6 +4,7 @@ import (
 	"context"
 
 	"github.com/rs/zerolog/log"
+	"github.com/thenonexistent/nilis/pkg/store"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/peer"
@@ -66,3 +67,43 @@ func UnaryLoggingInterceptor(
 
 	return handler(ctx, req)
 }
+
+// UnaryUnavailableInterceptor marks every Unavailable status this node
+// answers with, so the circuit breakers of its peers tell a node that
+// responded apart from one they could not reach.
+func UnaryUnavailableInterceptor(
+	ctx context.Context,
+	req any,
+	info *grpc.UnaryServerInfo,
+	handler grpc.UnaryHandler,
+) (any, error) {
+	resp, err := handler(ctx, req)
+	return resp, markServerUnavailable(err)
+}
+
+func StreamUnavailableInterceptor(srv any, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	return markServerUnavailable(handler(srv, stream))
+}
+
+func markServerUnavailable(err error) error {
+	if status.Code(err) != codes.Unavailable || isServerUnavailable(err) {
+		return err
+	}
+
+	detailed, detailErr := status.Convert(err).WithDetails(&store.ServerUnavailable{})
+	if detailErr != nil {
+		return err
+	}
+
+	return detailed.Err()
+}
+
+func isServerUnavailable(err error) bool {
+	for _, detail := range status.Convert(err).Details() {
+		if _, ok := detail.(*store.ServerUnavailable); ok {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"math/rand/v2"
+
+	"github.com/rs/zerolog/log"
+	"github.com/thenonexistent/nilis/internal/db"
+	"github.com/thenonexistent/nilis/pkg/store"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const defaultKeySampleSize = 1000
+
+// GetKeyStats reports the number of keys and bytes stored on this server
+// together with a uniform sample of its keys, which lets placement strategies
+// be compared against live data.
+func (s *Server) GetKeyStats(ctx context.Context, in *store.KeyStatsRequest) (*store.KeyStats, error) {
+	sampleSize := int(in.SampleSize)
+	if sampleSize == 0 {
+		sampleSize = defaultKeySampleSize
+	}
+	if sampleSize < 0 || sampleSize > maxScanLimit {
+		return nil, status.Errorf(codes.InvalidArgument, "sample size must be between 1 and %d", maxScanLimit)
+	}
+
+	current, _ := s.topologies()
+	out := &store.KeyStats{
+		ShardId: int32(s.shard.ID),
+		Epoch:   current.epoch,
+	}
+
+	for _, namespace := range []string{db.NamespaceData, db.NamespaceQueues} {
+		err := s.db.ForEachEntrySize(namespace, func(key []byte, size int) error {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+
+			out.Keys++
+			out.Bytes += uint64(size)
+
+			sample := &store.KeySample{Namespace: namespace, Key: string(key), Size: uint64(size)}
+
+			// reservoir sampling keeps every key equally likely to be picked
+			if len(out.Sample) < sampleSize {
+				out.Sample = append(out.Sample, sample)
+			} else if i := rand.Uint64N(out.Keys); i < uint64(sampleSize) {
+				out.Sample[i] = sample
+			}
+
+			return nil
+		})
+		if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+			return nil, status.FromContextError(err).Err()
+		}
+		if err != nil {
+			log.Error().Str("module", "server").Str("namespace", namespace).Err(err).Msg("failed collecting key statistics from local database")
+			return nil, status.Error(codes.Internal, "failed scanning database")
+		}
+	}
+
+	return out, nil
+}
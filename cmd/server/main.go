@@ -1,9 +1,12 @@
 package main
 
 import (
+	"context"
+	"flag"
 	"fmt"
 	"net"
 	"os"
+	"sort"
 	"strings"
 
 	"github.com/rs/zerolog"
@@ -12,12 +15,16 @@ import (
 	"github.com/thenonexistent/nilis/pkg/sharding"
 	"github.com/thenonexistent/nilis/pkg/store"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
 	"google.golang.org/grpc/reflection"
 )
 
 var config cfg.Config
 
 func main() {
+	overrideMetadata := flag.Bool("override-metadata", false, "start even if a database was recorded for another shard or placement, and record the configured one")
+	flag.Parse()
 
 	if err := cfg.LoadConfig(&config); err != nil {
 		log.Fatal().Str("module", "main").Err(err).Msg("error in initial configuration")
@@ -30,47 +37,93 @@ func main() {
 	initLogger(config.Logging.Level)
 
 	var shards []sharding.Shard
-	var serverShard sharding.Shard
+	var localShards []sharding.Shard
 
 	if config.Sharding.Enabled {
-		var err error
-		var ok bool
+		shards = cfg.CreateShards(&config)
 
-		shards, err = createShardsFromConfig(&config)
-		if err != nil {
-			log.Fatal().Err(err).Msg("failed creating shards based on provided configuraion")
-		}
+		localIDs := append([]int(nil), cfg.LocalShardIDs(&config)...)
+		sort.Ints(localIDs)
 
-		serverShard, ok = sharding.FindShardById(shards, config.Sharding.ShardID)
-		if !ok {
-			log.Fatal().Int("shard_id", config.Sharding.ShardID).Msg("provided shard id is not present withing sharding configuration")
+		for _, id := range localIDs {
+			shard, ok := sharding.FindShardById(shards, id)
+			if !ok {
+				log.Fatal().Int("shard_id", id).Msg("provided shard id is not present withing sharding configuration")
+			}
+			localShards = append(localShards, shard)
 		}
 	} else {
-		serverShard = sharding.Shard{
+		serverShard := sharding.Shard{
 			ID:       0,
 			Address:  fmt.Sprintf("%s:%d", config.Server.BindAddress, config.Server.ListenPort),
 			Replicas: []sharding.Replica{},
+			Weight:   1,
 		}
 		shards = []sharding.Shard{serverShard}
+		localShards = shards
 	}
 
-	storeServer, cancelFunc, err := NewServer(&config, serverShard, shards)
+	partitioner, err := cfg.CreatePartitioner(&config, shards)
 	if err != nil {
-		log.Fatal().Str("module", "main").Err(err).Msg("failed to create store server")
+		log.Fatal().Str("module", "main").Err(err).Msg("failed creating shard partitioner")
+	}
+
+	// the first local shard is the primary, the others share its connection
+	// pool and failure detection
+	var servers []*Server
+	for _, shard := range localShards {
+		var primary *Server
+		if len(servers) > 0 {
+			primary = servers[0]
+		}
+
+		storeServer, cancelFunc, err := NewServer(&config, shard, partitioner, primary, *overrideMetadata)
+		if err != nil {
+			log.Fatal().Str("module", "main").Int("shard_id", shard.ID).Err(err).Msg("failed to create store server")
+		}
+		defer cancelFunc()
+
+		servers = append(servers, storeServer)
 	}
-	defer cancelFunc()
 
-	log.Info().Int("shard_id", serverShard.ID).Msg("initialized server")
+	for _, storeServer := range servers {
+		if err := storeServer.InitCluster(); err != nil {
+			log.Fatal().Str("module", "main").Int("shard_id", storeServer.shard.ID).Err(err).Msg("failed to initialize cluster clients")
+		}
+
+		log.Info().Int("shard_id", storeServer.shard.ID).Msg("initialized server")
+	}
+
+	router := newShardRouter(servers)
 
 	errChan := make(chan error, 2)
 	sigChan := make(chan os.Signal, 1)
 
 	go func() {
-		if err := startGRPCServer(storeServer); err != nil {
+		if err := startGRPCServer(router); err != nil {
 			errChan <- fmt.Errorf("gRPC server failed: %w", err)
 		}
 	}()
 
+	// peers starting at the same time can only verify each other once both
+	// listen, client requests are rejected until the check passed
+	go func() {
+		if config.Sharding.Enabled {
+			ctx, cancel := context.WithTimeout(context.Background(), config.Sharding.HandshakeTimeout)
+			defer cancel()
+
+			for _, storeServer := range servers {
+				if err := storeServer.VerifyPeers(ctx); err != nil {
+					errChan <- fmt.Errorf("refusing to serve shard %d: %w", storeServer.shard.ID, err)
+					return
+				}
+			}
+		}
+
+		router.serving.Store(true)
+		log.Info().Str("module", "main").Msg("serving client requests")
+	}()
+
 	select {
 	case sig := <-sigChan:
 		log.Info().Str("signal", sig.String()).Msg("received interrupt, exiting...")
@@ -81,7 +134,7 @@ func main() {
 	}
 }
 
-func startGRPCServer(storeServer *Server) error {
+func startGRPCServer(router *shardRouter) error {
 	ListenAddr := fmt.Sprintf("%s:%d", config.Server.BindAddress, config.Server.ListenPort)
 	lis, err := net.Listen("tcp", ListenAddr)
 	if err != nil {
@@ -91,13 +144,22 @@ func startGRPCServer(storeServer *Server) error {
 	srvOpts := []grpc.ServerOption{}
 	unaryServerInterceptors := []grpc.UnaryServerInterceptor{}
 
-	unaryServerInterceptors = append(unaryServerInterceptors, UnaryCancelInterceptor)
+	unaryServerInterceptors = append(unaryServerInterceptors, UnaryUnavailableInterceptor, router.UnaryServingInterceptor, UnaryCancelInterceptor)
+
+	if config.Sharding.Replica {
+		unaryServerInterceptors = append(unaryServerInterceptors, router.primary.UnaryReplicaInterceptor)
+	}
+
+	if config.HotKeys.Enabled {
+		unaryServerInterceptors = append(unaryServerInterceptors, router.UnaryHotKeyInterceptor)
+	}
 
 	if strings.ToLower(config.Logging.Level) == "debug" {
 		unaryServerInterceptors = append(unaryServerInterceptors, UnaryLoggingInterceptor)
 	}
 
 	srvOpts = append(srvOpts, grpc.ChainUnaryInterceptor(unaryServerInterceptors...))
+	srvOpts = append(srvOpts, grpc.ChainStreamInterceptor(StreamUnavailableInterceptor, router.StreamServingInterceptor))
 
 	if config.Server.UseTLS {
 		creds, err := newServerTLS(&config)
@@ -110,7 +172,11 @@ func startGRPCServer(storeServer *Server) error {
 
 	s := grpc.NewServer(srvOpts...)
 	reflection.Register(s)
-	store.RegisterStoreServer(s, storeServer)
+	store.RegisterStoreServer(s, router)
+	store.RegisterClusterServer(s, router)
+
+	healthServer := health.NewServer()
+	healthpb.RegisterHealthServer(s, healthServer)
 
 	log.Info().Str("module", "grpc").Str("listen_address", ListenAddr).Msg("gRPC server started")
 	return s.Serve(lis)
@@ -0,0 +1,280 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"github.com/thenonexistent/nilis/pkg/sharding"
+	"github.com/thenonexistent/nilis/pkg/store"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/emptypb"
+)
+
+const topologySyncTimeout = 3 * time.Second
+
+// AddShard moves keys to a new shard, which has to be running with the
+// resulting shard list before the reshard can finish.
+func (s *Server) AddShard(ctx context.Context, in *store.ShardSpec) (*store.ReshardStatus, error) {
+	current, _ := s.topologies()
+	if current.contains(int(in.Id)) {
+		return nil, status.Errorf(codes.AlreadyExists, "shard %d is already part of the cluster", in.Id)
+	}
+
+	next := topologyToProto(current)
+	next.Shards = append(next.Shards, in)
+
+	return s.StartReshard(ctx, next)
+}
+
+// RemoveShard moves all keys off a shard. The shard can be shut down once
+// the reshard is committed.
+func (s *Server) RemoveShard(ctx context.Context, in *store.ShardID) (*store.ReshardStatus, error) {
+	current, _ := s.topologies()
+	if !current.contains(int(in.Id)) {
+		return nil, status.Errorf(codes.NotFound, "shard %d is not part of the cluster", in.Id)
+	}
+
+	if len(current.shards()) == 1 {
+		return nil, status.Error(codes.FailedPrecondition, "cannot remove the last shard")
+	}
+
+	next := topologyToProto(current)
+	next.Shards = slices.DeleteFunc(next.Shards, func(spec *store.ShardSpec) bool {
+		return spec.Id == in.Id
+	})
+
+	return s.StartReshard(ctx, next)
+}
+
+// UpdateShard changes the address of a shard. Weights decide key placement,
+// so changing them takes a reshard instead.
+func (s *Server) UpdateShard(ctx context.Context, in *store.ShardSpec) (*store.ShardMap, error) {
+	if in.Address == "" {
+		return nil, status.Error(codes.InvalidArgument, "shard address cannot be empty")
+	}
+
+	return s.updateTopology(ctx, in.Id, func(spec *store.ShardSpec) error {
+		if in.Weight != 0 && in.Weight != spec.Weight {
+			return status.Error(codes.InvalidArgument, "changing a shard weight moves keys, start a reshard instead")
+		}
+
+		spec.Address = in.Address
+		return nil
+	})
+}
+
+func (s *Server) AddReplica(ctx context.Context, in *store.ReplicaRequest) (*store.ShardMap, error) {
+	if in.Address == "" {
+		return nil, status.Error(codes.InvalidArgument, "replica address cannot be empty")
+	}
+
+	return s.updateTopology(ctx, in.ShardId, func(spec *store.ShardSpec) error {
+		if slices.Contains(spec.Replicas, in.Address) {
+			return status.Errorf(codes.AlreadyExists, "replica %s already belongs to shard %d", in.Address, in.ShardId)
+		}
+
+		spec.Replicas = append(spec.Replicas, in.Address)
+		return nil
+	})
+}
+
+func (s *Server) RemoveReplica(ctx context.Context, in *store.ReplicaRequest) (*store.ShardMap, error) {
+	return s.updateTopology(ctx, in.ShardId, func(spec *store.ShardSpec) error {
+		if !slices.Contains(spec.Replicas, in.Address) {
+			return status.Errorf(codes.NotFound, "replica %s does not belong to shard %d", in.Address, in.ShardId)
+		}
+
+		spec.Replicas = slices.DeleteFunc(spec.Replicas, func(address string) bool {
+			return address == in.Address
+		})
+		return nil
+	})
+}
+
+// ApplyTopology adopts a newer topology from a peer, as long as it places
+// keys like the current one. Placement changes only happen through a reshard.
+func (s *Server) ApplyTopology(ctx context.Context, in *store.Topology) (*emptypb.Empty, error) {
+	next, err := topologyFromProto(in)
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "invalid topology: %v", err)
+	}
+
+	if err := s.applyTopology(next); err != nil {
+		return nil, err
+	}
+
+	return &emptypb.Empty{}, nil
+}
+
+// updateTopology applies a change to one shard that leaves key placement
+// untouched under the next epoch, and propagates it to all peers. A peer
+// holding a newer topology, or a different one of the same epoch that wins
+// the tie, aborts the change, this node adopts the winner and the caller
+// retries.
+func (s *Server) updateTopology(ctx context.Context, shardID int32, update func(spec *store.ShardSpec) error) (*store.ShardMap, error) {
+	if !s.config.Sharding.Enabled {
+		return nil, status.Error(codes.FailedPrecondition, "membership changes require sharding to be enabled")
+	}
+
+	encoded, err := s.proposeTopology(shardID, update)
+	if err != nil {
+		return nil, err
+	}
+	s.startReplication()
+
+	// peers missing the update now pick it up on their next topology sync
+	for id, client := range s.peers() {
+		_, err := client.ApplyTopology(forwardContext(ctx), encoded)
+		if status.Code(err) == codes.Aborted {
+			if err := s.syncTopologyFrom(ctx, client); err != nil {
+				log.Warn().Str("module", "cluster").Int("shard_id", id).Err(err).Msg("failed adopting conflicting topology from peer")
+			}
+			return nil, status.Errorf(codes.Aborted, "topology of epoch %d conflicts with shard %d: %s", encoded.Epoch, id, status.Convert(err).Message())
+		}
+		if err != nil {
+			log.Warn().Str("module", "cluster").Int("shard_id", id).Err(err).Msg("failed propagating topology to peer")
+		}
+	}
+
+	return &store.ShardMap{Current: encoded}, nil
+}
+
+// proposeTopology applies update to the current topology under the next
+// epoch, holding s.mu so concurrent changes on this node build on each other.
+func (s *Server) proposeTopology(shardID int32, update func(spec *store.ShardSpec) error) (*store.Topology, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.target != nil {
+		return nil, status.Errorf(codes.FailedPrecondition, "reshard to epoch %d is in progress", s.target.epoch)
+	}
+
+	encoded := topologyToProto(s.current)
+
+	idx := slices.IndexFunc(encoded.Shards, func(spec *store.ShardSpec) bool {
+		return spec.Id == shardID
+	})
+	if idx < 0 {
+		return nil, status.Errorf(codes.NotFound, "shard %d is not part of the cluster", shardID)
+	}
+
+	if err := update(encoded.Shards[idx]); err != nil {
+		return nil, err
+	}
+	encoded.Epoch = s.current.epoch + 1
+
+	next, err := topologyFromProto(encoded)
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "invalid topology: %v", err)
+	}
+
+	if err := s.applyTopologyLocked(next); err != nil {
+		return nil, err
+	}
+
+	return encoded, nil
+}
+
+func (s *Server) applyTopology(next topology) error {
+	s.mu.Lock()
+	err := s.applyTopologyLocked(next)
+	s.mu.Unlock()
+
+	if err != nil {
+		return err
+	}
+
+	// a failure is logged, the replica tries again when it connects
+	s.startReplication()
+	return nil
+}
+
+// applyTopologyLocked adopts next when it is newer than the current
+// topology. Of two different topologies with the same epoch the one with the
+// higher digest wins on every node, so concurrent changes converge. The
+// caller holds s.mu.
+func (s *Server) applyTopologyLocked(next topology) error {
+	if next.epoch < s.current.epoch {
+		return status.Errorf(codes.Aborted, "topology epoch %d is older than the current epoch %d", next.epoch, s.current.epoch)
+	}
+
+	if next.epoch == s.current.epoch {
+		nextDigest, currentDigest := next.digest(), s.current.digest()
+		if nextDigest == currentDigest {
+			return nil
+		}
+		if nextDigest < currentDigest {
+			return status.Errorf(codes.Aborted, "a different topology of epoch %d is applied here and wins the tie", next.epoch)
+		}
+	}
+
+	if s.target != nil {
+		return status.Errorf(codes.FailedPrecondition, "reshard to epoch %d is in progress", s.target.epoch)
+	}
+
+	if next.fingerprint() != s.current.fingerprint() {
+		return status.Errorf(codes.FailedPrecondition, "topology of epoch %d places keys differently, it can only be reached through a reshard", next.epoch)
+	}
+
+	if err := s.saveTopology(currentTopologyKey, next); err != nil {
+		return status.Errorf(codes.Internal, "failed persisting topology: %v", err)
+	}
+
+	if self, ok := sharding.FindShardById(next.shards(), s.shard.ID); ok && self.Address != s.shard.Address {
+		log.Warn().Str("module", "cluster").
+			Str("address", self.Address).
+			Msg("address of this shard changed, restart it listening on the new address")
+	}
+
+	s.current = next
+
+	log.Info().Str("module", "cluster").Uint64("epoch", next.epoch).Msg("applied new topology")
+	return nil
+}
+
+// syncTopology periodically compares epochs with all peers and adopts a newer
+// topology, so nodes that were down during a membership change converge.
+func (s *Server) syncTopology(ctx context.Context) {
+	ticker := time.NewTicker(s.config.Sharding.TopologySyncInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		for id, client := range s.peers() {
+			if err := s.syncTopologyFrom(ctx, client); err != nil {
+				log.Debug().Str("module", "cluster").Int("shard_id", id).Err(err).Msg("failed syncing topology with peer")
+			}
+		}
+	}
+}
+
+func (s *Server) syncTopologyFrom(ctx context.Context, client *ShardClient) error {
+	callCtx, cancel := context.WithTimeout(ctx, topologySyncTimeout)
+	defer cancel()
+
+	shardMap, err := client.GetShardMap(forwardContext(callCtx), &emptypb.Empty{})
+	if err != nil {
+		return err
+	}
+
+	// topologies of the same epoch are compared by digest
+	if current, _ := s.topologies(); shardMap.Current.GetEpoch() < current.epoch {
+		return nil
+	}
+
+	next, err := topologyFromProto(shardMap.Current)
+	if err != nil {
+		return fmt.Errorf("invalid topology: %w", err)
+	}
+
+	return s.applyTopology(next)
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	metadataShardID      = "shard_id"
+	metadataShardCount   = "shard_count"
+	metadataPartitioner  = "partitioner"
+	metadataHashFunction = "hash_function"
+	metadataVirtualNodes = "virtual_nodes"
+	metadataHashTags     = "hash_tags"
+	metadataEpoch        = "epoch"
+)
+
+var verifiedMetadata = []string{
+	metadataShardID,
+	metadataShardCount,
+	metadataPartitioner,
+	metadataHashFunction,
+	metadataVirtualNodes,
+	metadataHashTags,
+}
+
+// shardMetadata describes which part of the keyspace a database of shardID
+// holds under the topology t.
+func shardMetadata(shardID int, t topology) map[string]string {
+	settings := t.partitioner.Settings()
+
+	return map[string]string{
+		metadataShardID:      strconv.Itoa(shardID),
+		metadataShardCount:   strconv.Itoa(len(t.partitioner.Shards())),
+		metadataPartitioner:  settings.Strategy,
+		metadataHashFunction: settings.HashFunction,
+		metadataVirtualNodes: strconv.Itoa(settings.VirtualNodes),
+		metadataHashTags:     strconv.FormatBool(settings.HashTags),
+		metadataEpoch:        strconv.FormatUint(t.epoch, 10),
+	}
+}
+
+// VerifyMetadata refuses a database that was recorded for another shard or
+// placement than the one this server runs with, which happens when shard ids
+// are swapped in configuration. override accepts the database anyway and
+// records the new values, for intentional migrations.
+func (s *Server) VerifyMetadata(override bool) error {
+	recorded, err := s.db.Metadata()
+	if err != nil {
+		return fmt.Errorf("failed reading database metadata: %w", err)
+	}
+
+	current, _ := s.topologies()
+	expected := shardMetadata(s.shard.ID, current)
+
+	if len(recorded) == 0 {
+		log.Info().Str("module", "server").Int("shard_id", s.shard.ID).Msg("recording shard metadata of existing database")
+		return s.db.SetMetadata(expected)
+	}
+
+	// a topology committed after the metadata was last written changed the
+	// placement on purpose, only the shard id is checked against it
+	epoch, _ := strconv.ParseUint(recorded[metadataEpoch], 10, 64)
+	outdated := epoch < current.epoch
+
+	var mismatches []string
+	for _, key := range verifiedMetadata {
+		if outdated && key != metadataShardID {
+			continue
+		}
+		if recorded[key] != expected[key] {
+			mismatches = append(mismatches, fmt.Sprintf("%s %s, expected %s", key, recorded[key], expected[key]))
+		}
+	}
+
+	if len(mismatches) > 0 && !override {
+		return fmt.Errorf("database was recorded with %s", strings.Join(mismatches, "; "))
+	}
+
+	if len(mismatches) > 0 {
+		log.Warn().Str("module", "server").Int("shard_id", s.shard.ID).Strs("mismatches", mismatches).Msg("overriding shard metadata of database")
+	}
+
+	if len(mismatches) > 0 || outdated {
+		return s.db.SetMetadata(expected)
+	}
+
+	return nil
+}
@@ -37,3 +37,29 @@ func newServerTLS(config *cfg.Config) (credentials.TransportCredentials, error)
 
 	return credentials.NewTLS(tlsConfig), nil
 }
+
+func newClientTLS(config *cfg.Config) (credentials.TransportCredentials, error) {
+	clientCert, err := tls.LoadX509KeyPair(config.Server.TLSCert, config.Server.TLSKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed initializing client certificate: %w", err)
+	}
+
+	caCert, err := os.ReadFile(config.Server.TLSCA)
+	if err != nil {
+		return nil, fmt.Errorf("failed loading ca certificate: %w", err)
+	}
+
+	certPool := x509.NewCertPool()
+	if !certPool.AppendCertsFromPEM(caCert) {
+		return nil, errors.New("failed appending ca to x509 certificate pool")
+	}
+
+	tlsConfig := &tls.Config{
+		Certificates: []tls.Certificate{clientCert},
+		RootCAs:      certPool,
+		MinVersion:   tls.VersionTLS13,
+		MaxVersion:   tls.VersionTLS13,
+	}
+
+	return credentials.NewTLS(tlsConfig), nil
+}
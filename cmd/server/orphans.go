@@ -0,0 +1,258 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	cfg "github.com/thenonexistent/nilis/internal/config"
+	"github.com/thenonexistent/nilis/internal/db"
+	"github.com/thenonexistent/nilis/pkg/sharding"
+	"github.com/thenonexistent/nilis/pkg/store"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	orphanBatchSize   = 500
+	orphanCallTimeout = 30 * time.Second
+)
+
+// CleanupOrphans removes keys left behind on this server by topology changes.
+// Unless execute is set it only reports what a cleanup would do.
+func (s *Server) CleanupOrphans(ctx context.Context, in *store.OrphanCleanupRequest) (*store.OrphanCleanupReport, error) {
+	if !s.config.Sharding.Enabled {
+		return nil, status.Error(codes.FailedPrecondition, "sharding is not enabled")
+	}
+
+	mode := in.Mode
+	if mode == "" {
+		mode = s.config.Orphans.Mode
+	}
+	if mode != cfg.OrphansHandOff && mode != cfg.OrphansDelete {
+		return nil, status.Errorf(codes.InvalidArgument, "mode must be %s or %s", cfg.OrphansHandOff, cfg.OrphansDelete)
+	}
+
+	limit := int(in.Limit)
+	if limit == 0 {
+		limit = defaultMisplacedKeysLimit
+	}
+	if limit < 0 || limit > maxScanLimit {
+		return nil, status.Errorf(codes.InvalidArgument, "limit must be between 1 and %d", maxScanLimit)
+	}
+
+	return s.cleanupOrphans(ctx, mode, !in.Execute, limit)
+}
+
+func (s *Server) cleanupOrphansPeriodically(ctx context.Context) {
+	ticker := time.NewTicker(s.config.Orphans.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		if _, err := s.cleanupOrphans(ctx, s.config.Orphans.Mode, s.config.Orphans.DryRun, 0); err != nil {
+			log.Warn().Str("module", "cluster").Err(err).Msg("skipped orphaned key cleanup")
+		}
+	}
+}
+
+// cleanupOrphans walks every key stored on this server, and for the ones the
+// current topology places on another shard deletes the local copy once the
+// owner is confirmed to hold the key. Handoff mode first imports keys the
+// owner is missing, delete mode keeps them. Up to limit orphaned keys are
+// listed in the report.
+func (s *Server) cleanupOrphans(ctx context.Context, mode string, dryRun bool, limit int) (*store.OrphanCleanupReport, error) {
+	if !s.cleanupMu.TryLock() {
+		return nil, status.Error(codes.FailedPrecondition, "orphan cleanup is already running")
+	}
+	defer s.cleanupMu.Unlock()
+
+	// keys waiting to be migrated are not orphaned, the migration moves them
+	current, target := s.topologies()
+	if target != nil {
+		return nil, status.Error(codes.FailedPrecondition, "cannot clean up orphaned keys while resharding")
+	}
+
+	report := &store.OrphanCleanupReport{
+		DryRun: dryRun,
+		Mode:   mode,
+		Epoch:  current.epoch,
+	}
+
+	for _, namespace := range []string{db.NamespaceData, db.NamespaceQueues} {
+		var from []byte
+
+		for {
+			if _, target := s.topologies(); target != nil {
+				return nil, status.Error(codes.Aborted, "resharding started during orphan cleanup")
+			}
+
+			entries, next, err := s.db.ExportRange(namespace, from, orphanBatchSize, func(key []byte) bool {
+				report.Scanned++
+				return s.ownerIn(current, namespace, string(key)).ID != s.shard.ID
+			})
+			if err != nil {
+				log.Error().Str("module", "cluster").Str("namespace", namespace).Err(err).Msg("failed scanning local database for orphaned keys")
+				return nil, status.Error(codes.Internal, "failed scanning database")
+			}
+
+			s.cleanupOrphanBatch(ctx, current, namespace, entries, mode, dryRun, limit, report)
+
+			if err := ctx.Err(); err != nil {
+				return nil, status.FromContextError(err).Err()
+			}
+
+			if next == nil {
+				break
+			}
+			from = next
+		}
+	}
+
+	log.Info().Str("module", "cluster").
+		Bool("dry_run", report.DryRun).
+		Str("mode", report.Mode).
+		Uint64("scanned", report.Scanned).
+		Uint64("orphaned", report.Orphaned).
+		Uint64("present_on_owner", report.PresentOnOwner).
+		Uint64("handed_off", report.HandedOff).
+		Uint64("deleted", report.Deleted).
+		Uint64("kept", report.Kept).
+		Uint64("failed", report.Failed).
+		Msg("finished orphaned key cleanup")
+
+	return report, nil
+}
+
+func (s *Server) cleanupOrphanBatch(ctx context.Context, t topology, namespace string, entries []db.Entry, mode string, dryRun bool, limit int, report *store.OrphanCleanupReport) {
+	groups := make(map[int][]db.Entry)
+	owners := make(map[int]sharding.Shard)
+
+	for _, entry := range entries {
+		owner := s.ownerIn(t, namespace, string(entry.Key))
+		groups[owner.ID] = append(groups[owner.ID], entry)
+		owners[owner.ID] = owner
+
+		report.Orphaned++
+		if len(report.Keys) < limit {
+			report.Keys = append(report.Keys, &store.MisplacedKey{
+				Namespace:    namespace,
+				Key:          string(entry.Key),
+				OwnerShardId: int32(owner.ID),
+			})
+		}
+	}
+
+	for id, group := range groups {
+		if err := s.cleanupOrphanGroup(ctx, owners[id], namespace, group, mode, dryRun, report); err != nil {
+			report.Failed += uint64(len(group))
+			log.Warn().Str("module", "cluster").Int("shard_id", id).Str("namespace", namespace).Err(err).Msg("failed cleaning up orphaned keys")
+		}
+	}
+}
+
+func (s *Server) cleanupOrphanGroup(ctx context.Context, owner sharding.Shard, namespace string, group []db.Entry, mode string, dryRun bool, report *store.OrphanCleanupReport) error {
+	if s.shardDown(owner) {
+		return shardDownError(owner)
+	}
+
+	client, err := s.peer(owner)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, orphanCallTimeout)
+	defer cancel()
+
+	present, err := ownerKeys(ctx, client, namespace, group)
+	if err != nil {
+		return fmt.Errorf("failed checking keys on shard %d: %w", owner.ID, err)
+	}
+
+	var confirmed [][]byte
+	var missing []db.Entry
+	for _, entry := range group {
+		if _, ok := present[string(entry.Key)]; ok {
+			confirmed = append(confirmed, entry.Key)
+		} else {
+			missing = append(missing, entry)
+		}
+	}
+
+	presentOnOwner := len(confirmed)
+	handedOff, kept := 0, 0
+
+	switch {
+	case mode == cfg.OrphansDelete:
+		kept = len(missing)
+
+	case dryRun:
+		for _, entry := range missing {
+			confirmed = append(confirmed, entry.Key)
+		}
+		handedOff = len(missing)
+
+	case len(missing) > 0:
+		// an existing key on the owner is never overwritten by the import
+		_, err := client.ImportEntries(forwardContext(ctx), &store.EntryBatch{
+			Namespace: namespace,
+			Entries:   entriesToProto(missing),
+		})
+		if err != nil {
+			return fmt.Errorf("failed handing keys to shard %d: %w", owner.ID, err)
+		}
+
+		imported, err := ownerKeys(ctx, client, namespace, missing)
+		if err != nil {
+			return fmt.Errorf("failed confirming keys on shard %d: %w", owner.ID, err)
+		}
+
+		for _, entry := range missing {
+			if _, ok := imported[string(entry.Key)]; ok {
+				confirmed = append(confirmed, entry.Key)
+				handedOff++
+			} else {
+				kept++
+			}
+		}
+	}
+
+	if !dryRun && len(confirmed) > 0 {
+		if _, err := s.DeleteEntries(ctx, &store.EntryKeys{Namespace: namespace, Keys: confirmed}); err != nil {
+			return fmt.Errorf("failed deleting orphaned keys: %w", err)
+		}
+	}
+
+	report.PresentOnOwner += uint64(presentOnOwner)
+	report.HandedOff += uint64(handedOff)
+	report.Deleted += uint64(len(confirmed))
+	report.Kept += uint64(kept)
+
+	return nil
+}
+
+// ownerKeys returns which of the entries' keys exist on the shard of client.
+func ownerKeys(ctx context.Context, client *ShardClient, namespace string, entries []db.Entry) (map[string]struct{}, error) {
+	keys := make([][]byte, 0, len(entries))
+	for _, entry := range entries {
+		keys = append(keys, entry.Key)
+	}
+
+	batch, err := client.ExportEntries(forwardContext(ctx), &store.EntryKeys{Namespace: namespace, Keys: keys})
+	if err != nil {
+		return nil, err
+	}
+
+	found := make(map[string]struct{}, len(batch.Entries))
+	for _, entry := range batch.Entries {
+		found[string(entry.Key)] = struct{}{}
+	}
+
+	return found, nil
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+
+	"github.com/rs/zerolog/log"
+	cfg "github.com/thenonexistent/nilis/internal/config"
+	"github.com/thenonexistent/nilis/internal/db"
+	"github.com/thenonexistent/nilis/pkg/sharding"
+	"github.com/thenonexistent/nilis/pkg/store"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/emptypb"
+)
+
+const defaultMisplacedKeysLimit = 1000
+
+// ownershipCounters counts requests for keys owned by another shard that
+// reached this server without being forwarded to their owner.
+type ownershipCounters struct {
+	rejected atomic.Uint64
+	accepted atomic.Uint64
+}
+
+// misplaced handles a request for a key owned by another shard that cannot be
+// forwarded there. Strict mode rejects it with MOVED, lenient mode serves it
+// locally and only logs it.
+func (s *Server) misplaced(key string, owner sharding.Shard, epoch uint64) error {
+	if s.config.Sharding.Ownership == cfg.OwnershipLenient {
+		s.ownership.accepted.Add(1)
+		log.Warn().Str("module", "cluster").Str("key", key).Int("owner_shard_id", owner.ID).Msg("serving key owned by another shard")
+		return nil
+	}
+
+	s.ownership.rejected.Add(1)
+	log.Debug().Str("module", "cluster").Str("key", key).Int("owner_shard_id", owner.ID).Msg("rejected key owned by another shard")
+	return movedError(key, owner, epoch)
+}
+
+func (s *Server) GetOwnershipStats(ctx context.Context, in *emptypb.Empty) (*store.OwnershipStats, error) {
+	return &store.OwnershipStats{
+		Mode:     s.config.Sharding.Ownership,
+		Rejected: s.ownership.rejected.Load(),
+		Accepted: s.ownership.accepted.Load(),
+	}, nil
+}
+
+// FindMisplacedKeys walks every key stored on this server and reports the
+// ones the current topology places on another shard, which are invisible to
+// correctly routed requests.
+func (s *Server) FindMisplacedKeys(ctx context.Context, in *store.MisplacedKeysRequest) (*store.MisplacedKeys, error) {
+	if !s.config.Sharding.Enabled {
+		return nil, status.Error(codes.FailedPrecondition, "sharding is not enabled")
+	}
+
+	limit := int(in.Limit)
+	if limit == 0 {
+		limit = defaultMisplacedKeysLimit
+	}
+	if limit < 0 || limit > maxScanLimit {
+		return nil, status.Errorf(codes.InvalidArgument, "limit must be between 1 and %d", maxScanLimit)
+	}
+
+	// keys waiting to be migrated would all be reported while resharding
+	current, target := s.topologies()
+	if target != nil {
+		return nil, status.Error(codes.FailedPrecondition, "cannot look for misplaced keys while resharding")
+	}
+
+	out := &store.MisplacedKeys{Epoch: current.epoch}
+
+	for _, namespace := range []string{db.NamespaceData, db.NamespaceQueues} {
+		err := s.db.ForEachEntryKey(namespace, func(key []byte) error {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+
+			out.Scanned++
+
+			owner := s.ownerIn(current, namespace, string(key))
+			if owner.ID == s.shard.ID {
+				return nil
+			}
+
+			out.Misplaced++
+			if len(out.Keys) < limit {
+				out.Keys = append(out.Keys, &store.MisplacedKey{
+					Namespace:    namespace,
+					Key:          string(key),
+					OwnerShardId: int32(owner.ID),
+				})
+			}
+
+			return nil
+		})
+		if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+			return nil, status.FromContextError(err).Err()
+		}
+		if err != nil {
+			log.Error().Str("module", "cluster").Str("namespace", namespace).Err(err).Msg("failed scanning local database for misplaced keys")
+			return nil, status.Error(codes.Internal, "failed scanning database")
+		}
+	}
+
+	log.Info().Str("module", "cluster").Uint64("scanned", out.Scanned).Uint64("misplaced", out.Misplaced).Uint64("epoch", out.Epoch).Msg("finished scan for misplaced keys")
+
+	return out, nil
+}
@@ -0,0 +1,412 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	cfg "github.com/thenonexistent/nilis/internal/config"
+	"github.com/thenonexistent/nilis/pkg/sharding"
+	"github.com/thenonexistent/nilis/pkg/store"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/backoff"
+	"google.golang.org/grpc/codes"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/emptypb"
+)
+
+type circuitState int
+
+const (
+	circuitClosed circuitState = iota
+	circuitOpen
+	circuitHalfOpen
+)
+
+func (c circuitState) String() string {
+	switch c {
+	case circuitClosed:
+		return "closed"
+	case circuitOpen:
+		return "open"
+	case circuitHalfOpen:
+		return "half_open"
+	default:
+		return fmt.Sprintf("unknown(%d)", int(c))
+	}
+}
+
+var (
+	errNotServing  = errors.New("health check reports not serving")
+	errUnreachable = errors.New("health check failed")
+)
+
+// circuitBreaker stops calls to a shard after consecutive connection
+// failures. Once the cooldown passed a single trial call, or health check,
+// decides whether the circuit closes again.
+type circuitBreaker struct {
+	shard     sharding.Shard
+	threshold int
+	cooldown  time.Duration
+
+	mu       sync.Mutex
+	state    circuitState
+	failures int
+	openedAt time.Time
+	trial    bool
+	opened   uint64
+	lastErr  string
+	health   string
+}
+
+func (b *circuitBreaker) allow() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case circuitOpen:
+		if time.Since(b.openedAt) < b.cooldown {
+			return b.openError()
+		}
+		b.transition(circuitHalfOpen)
+		b.trial = true
+	case circuitHalfOpen:
+		if b.trial {
+			return b.openError()
+		}
+		b.trial = true
+	}
+
+	return nil
+}
+
+func (b *circuitBreaker) record(err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	// a call the caller gave up on says nothing about the shard, a half-open
+	// circuit lets the next call try again
+	if isAbandoned(err) {
+		if b.state == circuitHalfOpen {
+			b.trial = false
+		}
+		return
+	}
+
+	failed := isConnectionFailure(err)
+	if failed {
+		b.lastErr = status.Convert(err).Message()
+	}
+
+	switch b.state {
+	case circuitClosed:
+		if !failed {
+			b.failures = 0
+			return
+		}
+
+		b.failures++
+		if b.failures >= b.threshold {
+			b.transition(circuitOpen)
+		}
+	case circuitHalfOpen:
+		b.trial = false
+
+		if failed {
+			b.transition(circuitOpen)
+		} else {
+			b.failures = 0
+			b.transition(circuitClosed)
+		}
+	}
+}
+
+func (b *circuitBreaker) transition(state circuitState) {
+	b.state = state
+
+	event := log.Info()
+	if state == circuitOpen {
+		b.openedAt = time.Now()
+		b.opened++
+		event = log.Warn().Str("last_error", b.lastErr)
+	}
+
+	event.Str("module", "pool").
+		Int("shard_id", b.shard.ID).
+		Str("address", b.shard.Address).
+		Str("circuit", state.String()).
+		Msg("shard circuit changed state")
+}
+
+func (b *circuitBreaker) openError() error {
+	return status.Errorf(codes.Unavailable, "circuit to shard %d at %s is open", b.shard.ID, b.shard.Address)
+}
+
+func (b *circuitBreaker) intercept(ctx context.Context, method string, req, reply any, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+	// health checks are judged by the monitor, which also looks at the
+	// reported serving status
+	if method == healthpb.Health_Check_FullMethodName {
+		return invoker(ctx, method, req, reply, cc, opts...)
+	}
+
+	if err := b.allow(); err != nil {
+		return err
+	}
+
+	err := invoker(ctx, method, req, reply, cc, opts...)
+	b.record(err)
+
+	return err
+}
+
+// interceptStream judges a shard by whether streams to it can be opened,
+// what happens on an open stream is up to its handler.
+func (b *circuitBreaker) interceptStream(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+	if err := b.allow(); err != nil {
+		return nil, err
+	}
+
+	stream, err := streamer(ctx, desc, cc, method, opts...)
+	b.record(err)
+
+	return stream, err
+}
+
+func (b *circuitBreaker) setHealth(health string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.health = health
+}
+
+func (b *circuitBreaker) stats() *store.PeerStats {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return &store.PeerStats{
+		ShardId:             int32(b.shard.ID),
+		Address:             b.shard.Address,
+		Circuit:             b.state.String(),
+		ConsecutiveFailures: int32(b.failures),
+		TimesOpened:         b.opened,
+		Health:              b.health,
+		LastError:           b.lastErr,
+	}
+}
+
+// isConnectionFailure tells failures reaching the shard apart from errors
+// it answered with, which say nothing about its health, even when they
+// report another shard as unavailable. Deadlines are left to the health
+// monitor, a caller's deadline may simply be too short.
+func isConnectionFailure(err error) bool {
+	if err == nil {
+		return false
+	}
+
+	if status.Code(err) == codes.Unavailable {
+		return !isServerUnavailable(err)
+	}
+
+	return errors.Is(err, errNotServing) || errors.Is(err, errUnreachable)
+}
+
+func isAbandoned(err error) bool {
+	switch status.Code(err) {
+	case codes.DeadlineExceeded, codes.Canceled:
+		return true
+	}
+
+	return false
+}
+
+// shardPool holds one connection per peer shard, dialed lazily and watched
+// with the standard gRPC health protocol.
+type shardPool struct {
+	ctx         context.Context
+	config      *cfg.Config
+	dialOptions func() ([]grpc.DialOption, error)
+
+	mu      sync.RWMutex
+	clients map[int]*ShardClient
+}
+
+func newShardPool(ctx context.Context, config *cfg.Config, dialOptions func() ([]grpc.DialOption, error)) *shardPool {
+	return &shardPool{
+		ctx:         ctx,
+		config:      config,
+		dialOptions: dialOptions,
+		clients:     make(map[int]*ShardClient),
+	}
+}
+
+// get returns the client of a shard, dialing it on first use or again when
+// the shard address changed.
+func (p *shardPool) get(shard sharding.Shard) (*ShardClient, error) {
+	p.mu.RLock()
+	client, ok := p.clients[shard.ID]
+	p.mu.RUnlock()
+
+	if ok && client.shard.Address == shard.Address {
+		return client, nil
+	}
+
+	opts, err := p.dialOptions()
+	if err != nil {
+		return nil, err
+	}
+
+	breaker := &circuitBreaker{
+		shard:     shard,
+		threshold: p.config.Pool.FailureThreshold,
+		cooldown:  p.config.Pool.Cooldown,
+		health:    healthpb.HealthCheckResponse_UNKNOWN.String(),
+	}
+	opts = append(opts,
+		grpc.WithChainUnaryInterceptor(breaker.intercept, targetShardInterceptor(shard.ID)),
+		grpc.WithChainStreamInterceptor(breaker.interceptStream, targetShardStreamInterceptor(shard.ID)),
+		// a half-open trial must not fail only because the connection is
+		// still backing off from the outage
+		grpc.WithConnectParams(grpc.ConnectParams{
+			Backoff: backoff.Config{
+				BaseDelay:  backoff.DefaultConfig.BaseDelay,
+				Multiplier: backoff.DefaultConfig.Multiplier,
+				Jitter:     backoff.DefaultConfig.Jitter,
+				MaxDelay:   p.config.Pool.Cooldown,
+			},
+			MinConnectTimeout: p.config.Pool.HealthCheckTimeout,
+		}),
+	)
+
+	conn, err := grpc.NewClient(shard.Address, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("failed creating client for shard %d: %w", shard.ID, err)
+	}
+
+	ctx, cancel := context.WithCancel(p.ctx)
+
+	client = &ShardClient{
+		shard:         shard,
+		conn:          conn,
+		breaker:       breaker,
+		cancel:        cancel,
+		StoreClient:   store.NewStoreClient(conn),
+		ClusterClient: store.NewClusterClient(conn),
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if existing, ok := p.clients[shard.ID]; ok {
+		if existing.shard.Address == shard.Address {
+			cancel()
+			conn.Close()
+			return existing, nil
+		}
+		existing.close()
+	}
+
+	p.clients[shard.ID] = client
+	go p.monitor(ctx, client, healthpb.NewHealthClient(conn))
+
+	log.Debug().Str("module", "pool").Int("shard_id", shard.ID).Str("address", shard.Address).Msg("added shard connection to pool")
+	return client, nil
+}
+
+func (p *shardPool) monitor(ctx context.Context, client *ShardClient, health healthpb.HealthClient) {
+	ticker := time.NewTicker(p.config.Pool.HealthCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		// an open circuit is only probed once its cooldown passed
+		if err := client.breaker.allow(); err != nil {
+			continue
+		}
+
+		checkCtx, cancel := context.WithTimeout(ctx, p.config.Pool.HealthCheckTimeout)
+		res, err := health.Check(checkCtx, &healthpb.HealthCheckRequest{})
+		cancel()
+
+		if ctx.Err() != nil {
+			return
+		}
+
+		switch {
+		case err != nil:
+			client.breaker.setHealth("unreachable")
+			err = fmt.Errorf("%w: %s", errUnreachable, status.Convert(err).Message())
+		case res.Status != healthpb.HealthCheckResponse_SERVING:
+			client.breaker.setHealth(res.Status.String())
+			err = errNotServing
+		default:
+			client.breaker.setHealth(res.Status.String())
+		}
+
+		client.breaker.record(err)
+	}
+}
+
+func (p *shardPool) stats() []*store.PeerStats {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	out := make([]*store.PeerStats, 0, len(p.clients))
+	for _, client := range p.clients {
+		out = append(out, client.breaker.stats())
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].ShardId < out[j].ShardId })
+
+	return out
+}
+
+// retain closes the clients of shards that are no longer part of the
+// topology.
+func (p *shardPool) retain(shards []sharding.Shard) {
+	keep := make(map[int]struct{}, len(shards))
+	for _, shard := range shards {
+		keep[shard.ID] = struct{}{}
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for id, client := range p.clients {
+		if _, ok := keep[id]; ok {
+			continue
+		}
+
+		client.close()
+		delete(p.clients, id)
+
+		log.Info().Str("module", "pool").Int("shard_id", id).Str("address", client.shard.Address).Msg("closed connection to removed shard")
+	}
+}
+
+func (p *shardPool) close() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for id, client := range p.clients {
+		client.close()
+		delete(p.clients, id)
+	}
+}
+
+func (c *ShardClient) close() {
+	c.cancel()
+	c.conn.Close()
+}
+
+func (s *Server) GetPoolStats(ctx context.Context, in *emptypb.Empty) (*store.PoolStats, error) {
+	return &store.PoolStats{Peers: s.shardPool.stats()}, nil
+}
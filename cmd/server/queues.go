@@ -0,0 +1,175 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"github.com/thenonexistent/nilis/internal/db"
+	"github.com/thenonexistent/nilis/pkg/store"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/emptypb"
+)
+
+const maxDequeueMessages = 100
+
+func (s *Server) Enqueue(ctx context.Context, in *store.EnqueueRequest) (*store.MessageIDs, error) {
+	client, err := s.routeQueue(ctx, in.Queue)
+	if err != nil {
+		return nil, err
+	}
+	if client != nil {
+		return client.Enqueue(forwardContext(ctx), in)
+	}
+
+	if in.Queue == "" {
+		return nil, status.Error(codes.InvalidArgument, "queue name cannot be empty")
+	}
+
+	ids, err := s.db.Enqueue(in.Queue, in.Messages)
+	if err != nil {
+		log.Error().Str("module", "queues").Str("queue", in.Queue).Err(err).Msg("failed enqueueing messages in local database")
+		return nil, status.Error(codes.Internal, "failed enqueueing messages")
+	}
+
+	return &store.MessageIDs{Ids: ids}, nil
+}
+
+func (s *Server) Dequeue(ctx context.Context, in *store.DequeueRequest) (*store.QueueMessages, error) {
+	client, err := s.routeQueue(ctx, in.Queue)
+	if err != nil {
+		return nil, err
+	}
+	if client != nil {
+		return client.Dequeue(forwardContext(ctx), in)
+	}
+
+	if in.Queue == "" {
+		return nil, status.Error(codes.InvalidArgument, "queue name cannot be empty")
+	}
+
+	maxMessages := int(in.MaxMessages)
+	if maxMessages <= 0 {
+		maxMessages = 1
+	}
+	if maxMessages > maxDequeueMessages {
+		return nil, status.Errorf(codes.InvalidArgument, "cannot dequeue more than %d messages at once", maxDequeueMessages)
+	}
+
+	visibilityTimeout := time.Duration(in.VisibilityTimeoutMs) * time.Millisecond
+	if visibilityTimeout == 0 {
+		visibilityTimeout = s.config.Queues.DefaultVisibilityTimeout
+	}
+	if visibilityTimeout < 0 || visibilityTimeout > s.config.Queues.MaxVisibilityTimeout {
+		return nil, status.Errorf(codes.InvalidArgument, "visibility timeout must be between 0 and %s", s.config.Queues.MaxVisibilityTimeout)
+	}
+
+	opts := db.DequeueOptions{
+		MaxMessages:       maxMessages,
+		VisibilityTimeout: visibilityTimeout,
+		MaxDeliveries:     uint32(s.config.Queues.MaxDeliveries),
+	}
+
+	// dead letter queues are terminal, their messages are never dead lettered again
+	if !s.isDeadLetterQueue(in.Queue) {
+		opts.DeadLetterQueue = in.Queue + s.config.Queues.DeadLetterSuffix
+	} else {
+		opts.MaxDeliveries = 0
+	}
+
+	messages, err := s.db.Dequeue(in.Queue, opts)
+	if err != nil {
+		log.Error().Str("module", "queues").Str("queue", in.Queue).Err(err).Msg("failed dequeueing messages from local database")
+		return nil, status.Error(codes.Internal, "failed dequeueing messages")
+	}
+
+	out := &store.QueueMessages{
+		Queue:    in.Queue,
+		Messages: make([]*store.QueueMessage, 0, len(messages)),
+	}
+	for _, message := range messages {
+		out.Messages = append(out.Messages, &store.QueueMessage{
+			Id:            message.ID,
+			Body:          message.Body,
+			ReceiptHandle: message.ReceiptHandle,
+			DeliveryCount: message.DeliveryCount,
+		})
+	}
+
+	return out, nil
+}
+
+func (s *Server) Ack(ctx context.Context, in *store.Receipt) (*emptypb.Empty, error) {
+	client, err := s.routeQueue(ctx, in.Queue)
+	if err != nil {
+		return nil, err
+	}
+	if client != nil {
+		return client.Ack(forwardContext(ctx), in)
+	}
+
+	if in.Queue == "" {
+		return nil, status.Error(codes.InvalidArgument, "queue name cannot be empty")
+	}
+
+	if err := s.db.Ack(in.Queue, in.ReceiptHandle); err != nil {
+		return nil, receiptError(err, in.Queue, "ack")
+	}
+
+	return &emptypb.Empty{}, nil
+}
+
+func (s *Server) Nack(ctx context.Context, in *store.Receipt) (*emptypb.Empty, error) {
+	client, err := s.routeQueue(ctx, in.Queue)
+	if err != nil {
+		return nil, err
+	}
+	if client != nil {
+		return client.Nack(forwardContext(ctx), in)
+	}
+
+	if in.Queue == "" {
+		return nil, status.Error(codes.InvalidArgument, "queue name cannot be empty")
+	}
+
+	delay := time.Duration(in.DelayMs) * time.Millisecond
+	if delay < 0 || delay > s.config.Queues.MaxVisibilityTimeout {
+		return nil, status.Errorf(codes.InvalidArgument, "nack delay must be between 0 and %s", s.config.Queues.MaxVisibilityTimeout)
+	}
+
+	if err := s.db.Nack(in.Queue, in.ReceiptHandle, delay); err != nil {
+		return nil, receiptError(err, in.Queue, "nack")
+	}
+
+	return &emptypb.Empty{}, nil
+}
+
+// queueRoutingKey places a dead letter queue on the same shard as its source
+// queue, since messages are dead lettered locally.
+func (s *Server) queueRoutingKey(queue string) string {
+	if s.isDeadLetterQueue(queue) {
+		return strings.TrimSuffix(queue, s.config.Queues.DeadLetterSuffix)
+	}
+
+	return queue
+}
+
+func (s *Server) isDeadLetterQueue(queue string) bool {
+	suffix := s.config.Queues.DeadLetterSuffix
+	return suffix != "" && strings.HasSuffix(queue, suffix)
+}
+
+func receiptError(err error, queue string, operation string) error {
+	switch {
+	case errors.Is(err, db.ErrInvalidReceipt):
+		return status.Errorf(codes.InvalidArgument, "%s: %v", operation, err)
+	case errors.Is(err, db.ErrReceiptExpired):
+		return status.Errorf(codes.NotFound, "%s: %v", operation, err)
+	}
+
+	log.Error().Str("module", "queues").Str("queue", queue).Str("operation", operation).Err(err).Msg("failed updating message in local database")
+	return status.Errorf(codes.Internal, "failed %s in database", operation)
+}
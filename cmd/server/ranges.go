@@ -0,0 +1,90 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/rs/zerolog/log"
+	"github.com/thenonexistent/nilis/internal/db"
+	"github.com/thenonexistent/nilis/pkg/store"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const deleteRangeBatchSize = 1000
+
+// DeleteRange removes a prefix or a [start, end) range of keys. Since a range
+// spans every shard, the receiving node fans the request out to all peers and
+// reports the total number of deleted keys.
+func (s *Server) DeleteRange(ctx context.Context, in *store.DeleteRangeRequest) (*store.Count, error) {
+	start, end, err := deleteRangeBounds(in)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	var total int64
+	var failures []string
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+
+	if s.config.Sharding.Enabled && !isForwarded(ctx) {
+		for id, client := range s.peers() {
+			wg.Add(1)
+			go func(id int, client *ShardClient) {
+				defer wg.Done()
+
+				count, err := client.DeleteRange(forwardContext(ctx), in)
+
+				mu.Lock()
+				defer mu.Unlock()
+
+				if err != nil {
+					log.Error().Str("module", "server").Int("shard_id", id).Err(err).Msg("failed deleting range on peer shard")
+					failures = append(failures, fmt.Sprintf("shard %d: %v", id, status.Convert(err).Message()))
+					return
+				}
+				total += count.Count
+			}(id, client)
+		}
+	}
+
+	deleted, err := s.db.DeleteRange(start, end, deleteRangeBatchSize, s.forgetCachedKeys)
+	if err != nil {
+		log.Error().Str("module", "server").Int("deleted", deleted).Err(err).Msg("failed deleting range from local database")
+	}
+
+	wg.Wait()
+
+	total += int64(deleted)
+
+	if err != nil {
+		failures = append(failures, fmt.Sprintf("shard %d: %v", s.shard.ID, err))
+	}
+
+	if len(failures) > 0 {
+		return nil, status.Errorf(codes.Unavailable, "deleted %d keys before failing on %s", total, strings.Join(failures, "; "))
+	}
+
+	return &store.Count{Count: total}, nil
+}
+
+func deleteRangeBounds(in *store.DeleteRangeRequest) ([]byte, []byte, error) {
+	if in.Prefix != "" {
+		if in.Start != "" || in.End != "" {
+			return nil, nil, fmt.Errorf("prefix cannot be combined with a start or end key")
+		}
+		return []byte(in.Prefix), db.PrefixEnd([]byte(in.Prefix)), nil
+	}
+
+	if in.Start == "" && in.End == "" {
+		return nil, nil, fmt.Errorf("a prefix or a start or end key is required")
+	}
+
+	if in.End != "" && in.Start >= in.End {
+		return nil, nil, fmt.Errorf("start key must sort before end key")
+	}
+
+	return []byte(in.Start), []byte(in.End), nil
+}
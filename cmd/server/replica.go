@@ -0,0 +1,242 @@
+package main
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strings"
+	"sync/atomic"
+
+	"github.com/rs/zerolog/log"
+	cfg "github.com/thenonexistent/nilis/internal/config"
+	"github.com/thenonexistent/nilis/pkg/store"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/known/emptypb"
+)
+
+const (
+	rolePrimary = "primary"
+	roleReplica = "replica"
+
+	appliedSequenceKey = "replication_applied_sequence"
+)
+
+// replicaWrites lists the methods a read only replica leaves to its primary.
+var replicaWrites = map[string]struct{}{
+	store.Store_Set_FullMethodName:             {},
+	store.Store_Delete_FullMethodName:          {},
+	store.Store_DeleteRange_FullMethodName:     {},
+	store.Store_CreateSession_FullMethodName:   {},
+	store.Store_Heartbeat_FullMethodName:       {},
+	store.Store_CloseSession_FullMethodName:    {},
+	store.Store_HashSet_FullMethodName:         {},
+	store.Store_HashDelete_FullMethodName:      {},
+	store.Store_ListPush_FullMethodName:        {},
+	store.Store_ListPop_FullMethodName:         {},
+	store.Store_SetAdd_FullMethodName:          {},
+	store.Store_SetRemove_FullMethodName:       {},
+	store.Store_SortedSetAdd_FullMethodName:    {},
+	store.Store_SortedSetRemove_FullMethodName: {},
+	store.Store_Enqueue_FullMethodName:         {},
+	store.Store_Dequeue_FullMethodName:         {},
+	store.Store_Ack_FullMethodName:             {},
+	store.Store_Nack_FullMethodName:            {},
+
+	store.Cluster_CleanupOrphans_FullMethodName: {},
+	store.Cluster_StartReshard_FullMethodName:   {},
+	store.Cluster_PrepareReshard_FullMethodName: {},
+	store.Cluster_CommitReshard_FullMethodName:  {},
+	store.Cluster_AddShard_FullMethodName:       {},
+	store.Cluster_RemoveShard_FullMethodName:    {},
+	store.Cluster_UpdateShard_FullMethodName:    {},
+	store.Cluster_AddReplica_FullMethodName:     {},
+	store.Cluster_RemoveReplica_FullMethodName:  {},
+	store.Cluster_ImportEntries_FullMethodName:  {},
+	store.Cluster_DeleteEntries_FullMethodName:  {},
+}
+
+// follower is the state of a server running as a read only replica of the
+// primary of its shard. The server keeps the identity of that shard, so keys
+// of the shard are served locally and every other key is routed as usual.
+type follower struct {
+	address     string
+	applied     atomic.Uint64
+	sequence    atomic.Uint64
+	connected   atomic.Bool
+	changelogID string
+	// loaded is set once a complete snapshot of the primary was applied,
+	// until then the local entries are partial or missing
+	loaded atomic.Bool
+}
+
+// ack reports the position of the replica to its primary.
+func (f *follower) ack(shardID int) *store.ReplicationAck {
+	return &store.ReplicationAck{
+		Address:         f.address,
+		ShardId:         int32(shardID),
+		AppliedSequence: f.applied.Load(),
+		ChangelogId:     f.changelogID,
+	}
+}
+
+func (s *Server) initFollower() error {
+	address, err := cfg.ReplicaAddress(s.config)
+	if err != nil {
+		return err
+	}
+
+	s.follower = &follower{address: address}
+
+	raw, err := s.db.GetSystemValue(appliedSequenceKey)
+	if err != nil {
+		return fmt.Errorf("failed reading replication position: %w", err)
+	}
+	if raw != nil {
+		applied, err := decodeSequence(raw)
+		if err != nil {
+			return err
+		}
+		s.follower.applied.Store(applied)
+	}
+
+	id, err := s.db.GetSystemValue(replicaChangelogIDKey)
+	if err != nil {
+		return fmt.Errorf("failed reading replicated changelog: %w", err)
+	}
+	s.follower.changelogID = string(id)
+	s.follower.loaded.Store(s.follower.changelogID != "" || !s.config.Replication.Enabled)
+
+	return nil
+}
+
+func (s *Server) isReplica() bool {
+	return s.follower != nil
+}
+
+// address returns the address this server is reachable at, which differs from
+// the address of its shard on replicas.
+func (s *Server) address() string {
+	if s.follower != nil {
+		return s.follower.address
+	}
+
+	return s.shard.Address
+}
+
+// UnaryReplicaInterceptor keeps a replica read only, writes are rejected or
+// forwarded to the primary depending on the replica_writes setting. Reads are
+// rejected until the replica holds a complete snapshot of its primary.
+func (s *Server) UnaryReplicaInterceptor(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	if !s.isReplica() {
+		return handler(ctx, req)
+	}
+
+	if _, ok := replicaWrites[info.FullMethod]; !ok {
+		if isStoreMethod(info.FullMethod) && !s.follower.loaded.Load() {
+			return nil, status.Errorf(codes.Unavailable, "replica of shard %d is loading a snapshot, read from the primary at %s", s.shard.ID, s.shard.Address)
+		}
+		return handler(ctx, req)
+	}
+
+	if s.config.Sharding.ReplicaWrites != cfg.ReplicaWritesForward {
+		return nil, status.Errorf(codes.FailedPrecondition, "replica of shard %d is read only, send writes to the primary at %s", s.shard.ID, s.shard.Address)
+	}
+
+	if s.shardDown(s.shard) {
+		return nil, shardDownError(s.shard)
+	}
+
+	client, err := s.peer(s.shard)
+	if err != nil {
+		log.Error().Str("module", "replica").Int("shard_id", s.shard.ID).Err(err).Msg("failed connecting to primary")
+		return nil, status.Errorf(codes.Unavailable, "primary of shard %d is unavailable", s.shard.ID)
+	}
+
+	reply, err := replyFor(info.FullMethod)
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+
+	// not marked as forwarded, the primary routes keys of other shards on
+	// and never forwards back to a replica
+	if err := client.conn.Invoke(ctx, info.FullMethod, req, reply); err != nil {
+		return nil, err
+	}
+
+	return reply, nil
+}
+
+// replyFor returns an empty reply message of a method, looked up by its full
+// name in the registered service descriptors.
+func replyFor(fullMethod string) (protoreflect.ProtoMessage, error) {
+	service, method, ok := strings.Cut(strings.TrimPrefix(fullMethod, "/"), "/")
+	if !ok {
+		return nil, fmt.Errorf("malformed method name %s", fullMethod)
+	}
+
+	descriptor, err := protoregistry.GlobalFiles.FindDescriptorByName(protoreflect.FullName(service))
+	if err != nil {
+		return nil, fmt.Errorf("unknown service %s: %w", service, err)
+	}
+
+	serviceDescriptor, ok := descriptor.(protoreflect.ServiceDescriptor)
+	if !ok {
+		return nil, fmt.Errorf("%s is not a service", service)
+	}
+
+	methodDescriptor := serviceDescriptor.Methods().ByName(protoreflect.Name(method))
+	if methodDescriptor == nil {
+		return nil, fmt.Errorf("unknown method %s", fullMethod)
+	}
+
+	replyType, err := protoregistry.GlobalTypes.FindMessageByName(methodDescriptor.Output().FullName())
+	if err != nil {
+		return nil, fmt.Errorf("unknown reply of %s: %w", fullMethod, err)
+	}
+
+	return replyType.New().Interface(), nil
+}
+
+func (s *Server) GetReplicationStatus(ctx context.Context, in *emptypb.Empty) (*store.ReplicationStatus, error) {
+	out := &store.ReplicationStatus{
+		Role:    rolePrimary,
+		ShardId: int32(s.shard.ID),
+		Address: s.address(),
+	}
+
+	if s.isReplica() {
+		out.Role = roleReplica
+		out.Primary = s.shard.Address
+		out.AppliedSequence = s.follower.applied.Load()
+		out.Sequence = s.follower.sequence.Load()
+		out.Connected = s.follower.connected.Load()
+		if out.Sequence > out.AppliedSequence {
+			out.Lag = out.Sequence - out.AppliedSequence
+		}
+		return out, nil
+	}
+
+	if s.db.ChangelogID() != "" {
+		out.Sequence = s.db.LastSequence()
+		out.Replicas = s.replication.progress(s.replicaAddresses(), out.Sequence)
+	}
+
+	return out, nil
+}
+
+func encodeSequence(sequence uint64) []byte {
+	return binary.BigEndian.AppendUint64(nil, sequence)
+}
+
+func decodeSequence(raw []byte) (uint64, error) {
+	if len(raw) != 8 {
+		return 0, errors.New("corrupted replication sequence")
+	}
+
+	return binary.BigEndian.Uint64(raw), nil
+}
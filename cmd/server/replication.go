@@ -0,0 +1,542 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"github.com/thenonexistent/nilis/internal/db"
+	"github.com/thenonexistent/nilis/pkg/store"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const replicaChangelogIDKey = "replication_changelog_id"
+
+// replication tracks the replicas following the changelog of a primary. The
+// progress of a replica is kept after it disconnects, so the changes it needs
+// to resume are not trimmed.
+type replication struct {
+	mu       sync.Mutex
+	replicas map[string]*replicaProgress
+}
+
+type replicaProgress struct {
+	streams int
+	acked   uint64
+	ackedAt time.Time
+}
+
+func newReplication() *replication {
+	return &replication{replicas: make(map[string]*replicaProgress)}
+}
+
+func (r *replication) connect(address string, acked uint64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	progress, ok := r.replicas[address]
+	if !ok {
+		progress = &replicaProgress{}
+		r.replicas[address] = progress
+	}
+	progress.streams++
+	progress.acked = acked
+	progress.ackedAt = time.Now()
+}
+
+func (r *replication) disconnect(address string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if progress, ok := r.replicas[address]; ok {
+		progress.streams--
+	}
+}
+
+func (r *replication) ack(address string, sequence uint64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if progress, ok := r.replicas[address]; ok {
+		progress.acked = sequence
+		progress.ackedAt = time.Now()
+	}
+}
+
+// trimmable returns the last sequence every replica in addresses has
+// applied, a replica that has not connected yet keeps everything.
+func (r *replication) trimmable(addresses []string, last uint64) uint64 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	through := last
+	for _, address := range addresses {
+		progress, ok := r.replicas[address]
+		if !ok {
+			return 0
+		}
+		through = min(through, progress.acked)
+	}
+
+	return through
+}
+
+func (r *replication) progress(addresses []string, last uint64) []*store.ReplicaProgress {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for address := range r.replicas {
+		if !slices.Contains(addresses, address) {
+			addresses = append(addresses, address)
+		}
+	}
+	sort.Strings(addresses)
+
+	out := make([]*store.ReplicaProgress, 0, len(addresses))
+	for _, address := range addresses {
+		replica := &store.ReplicaProgress{Address: address, Lag: last}
+
+		if progress, ok := r.replicas[address]; ok {
+			replica.Connected = progress.streams > 0
+			replica.AckedSequence = progress.acked
+			replica.AckedAtUnixMs = progress.ackedAt.UnixMilli()
+			if progress.acked < last {
+				replica.Lag = last - progress.acked
+			} else {
+				replica.Lag = 0
+			}
+		}
+
+		out = append(out, replica)
+	}
+
+	return out
+}
+
+// replicaAddresses returns the replicas of this server's shard in the current
+// topology.
+func (s *Server) replicaAddresses() []string {
+	current, _ := s.topologies()
+
+	var addresses []string
+	for _, shard := range current.shards() {
+		if shard.ID != s.shard.ID {
+			continue
+		}
+		for _, replica := range shard.Replicas {
+			addresses = append(addresses, replica.Address)
+		}
+	}
+
+	return addresses
+}
+
+// openChangelog records changes for replication on a primary whose shard has
+// replicas in the topology. Without replicas nothing would read or trim the
+// changelog, so it stays closed until the first replica is added.
+func (s *Server) openChangelog() error {
+	if s.config.Sharding.Enabled && s.config.Replication.Enabled && !s.isReplica() {
+		s.replication = newReplication()
+	}
+
+	return s.db.OpenChangelog(s.replication != nil && len(s.replicaAddresses()) > 0)
+}
+
+// startReplication opens the changelog once the topology gives this shard its
+// first replica. The changelog is new to the replica, so it starts with a
+// snapshot holding every write made before.
+func (s *Server) startReplication() error {
+	if s.replication == nil || s.db.ChangelogID() != "" || len(s.replicaAddresses()) == 0 {
+		return nil
+	}
+
+	if err := s.db.OpenChangelog(true); err != nil {
+		log.Error().Str("module", "replication").Int("shard_id", s.shard.ID).Err(err).Msg("failed opening changelog for new replica")
+		return err
+	}
+
+	log.Info().Str("module", "replication").Int("shard_id", s.shard.ID).Msg("opened changelog for new replica")
+	return nil
+}
+
+// Replicate streams the changelog of this primary to one of its replicas,
+// starting after the sequence the replica last applied. A replica of another
+// changelog, or one that fell behind the changes still kept, first receives a
+// snapshot of every entry.
+func (s *Server) Replicate(stream store.Cluster_ReplicateServer) error {
+	if s.isReplica() {
+		return status.Errorf(codes.FailedPrecondition, "replica of shard %d does not serve replication, connect to the primary at %s", s.shard.ID, s.shard.Address)
+	}
+	if s.replication == nil {
+		return status.Errorf(codes.FailedPrecondition, "replication is disabled on shard %d", s.shard.ID)
+	}
+
+	hello, err := stream.Recv()
+	if err != nil {
+		return err
+	}
+
+	if int(hello.ShardId) != s.shard.ID {
+		return status.Errorf(codes.FailedPrecondition, "this node is the primary of shard %d, not %d", s.shard.ID, hello.ShardId)
+	}
+	if !slices.Contains(s.replicaAddresses(), hello.Address) {
+		return status.Errorf(codes.PermissionDenied, "%s is not a replica of shard %d", hello.Address, s.shard.ID)
+	}
+
+	// the replica may connect before the topology adding it was applied here
+	if err := s.startReplication(); err != nil {
+		return status.Errorf(codes.Internal, "failed opening changelog of shard %d", s.shard.ID)
+	}
+
+	position := hello.AppliedSequence
+	resync := hello.ChangelogId != s.db.ChangelogID()
+	if resync {
+		position = 0
+	}
+
+	s.replication.connect(hello.Address, position)
+	defer s.replication.disconnect(hello.Address)
+
+	log.Info().Str("module", "replication").Int("shard_id", s.shard.ID).Str("replica", hello.Address).Uint64("sequence", position).Msg("replica connected")
+
+	ctx, cancel := context.WithCancel(stream.Context())
+	defer cancel()
+
+	// acks arrive on the same stream while changes are being sent
+	received := make(chan error, 1)
+	go func() {
+		defer cancel()
+		for {
+			ack, err := stream.Recv()
+			if err != nil {
+				received <- err
+				return
+			}
+			s.replication.ack(hello.Address, ack.AppliedSequence)
+		}
+	}()
+
+	// tells the replica where the changelog stands while it is idle
+	if err := stream.Send(&store.ReplicationBatch{LastSequence: s.db.LastSequence()}); err != nil {
+		return replicationEnded(ctx, received, err)
+	}
+
+	for {
+		if resync {
+			if position, err = s.sendSnapshot(ctx, stream, hello.Address); err != nil {
+				return replicationEnded(ctx, received, err)
+			}
+			resync = false
+		}
+
+		changes, err := s.db.ChangesSince(position, s.config.Replication.BatchSize)
+		if errors.Is(err, db.ErrChangesTrimmed) {
+			log.Warn().Str("module", "replication").Int("shard_id", s.shard.ID).Str("replica", hello.Address).Err(err).Msg("replica fell behind the changelog")
+			resync = true
+			continue
+		}
+		if err != nil {
+			log.Error().Str("module", "replication").Int("shard_id", s.shard.ID).Err(err).Msg("failed reading changelog")
+			return status.Error(codes.Internal, "failed reading changelog")
+		}
+
+		if len(changes) == 0 {
+			if err := s.db.WaitForChanges(ctx, position); err != nil {
+				return replicationEnded(ctx, received, err)
+			}
+			continue
+		}
+
+		position = changes[len(changes)-1].Sequence
+
+		err = stream.Send(&store.ReplicationBatch{
+			Changes:      changesToProto(changes),
+			Sequence:     position,
+			LastSequence: s.db.LastSequence(),
+			ChangelogId:  s.db.ChangelogID(),
+		})
+		if err != nil {
+			return replicationEnded(ctx, received, err)
+		}
+	}
+}
+
+// sendSnapshot sends every entry and returns the sequence the
+// replica continues from. Changes committed while the snapshot is read are
+// sent again afterwards, which converges as every change carries the whole
+// state of its key.
+func (s *Server) sendSnapshot(ctx context.Context, stream store.Cluster_ReplicateServer, address string) (uint64, error) {
+	sequence := s.db.LastSequence()
+
+	// the changes following the snapshot must be kept until they are applied
+	s.replication.ack(address, sequence)
+
+	log.Info().Str("module", "replication").Int("shard_id", s.shard.ID).Str("replica", address).Uint64("sequence", sequence).Msg("sending snapshot to replica")
+
+	if err := stream.Send(&store.ReplicationBatch{Snapshot: true, LastSequence: sequence}); err != nil {
+		return 0, err
+	}
+
+	sent := 0
+	for _, namespace := range []string{db.NamespaceData, db.NamespaceQueues} {
+		var from []byte
+		for {
+			if err := ctx.Err(); err != nil {
+				return 0, err
+			}
+
+			entries, next, err := s.db.SnapshotRange(namespace, from, s.config.Replication.BatchSize)
+			if err != nil {
+				return 0, fmt.Errorf("failed exporting %s: %w", namespace, err)
+			}
+
+			if len(entries) > 0 {
+				changes := make([]db.Change, 0, len(entries))
+				for _, entry := range entries {
+					changes = append(changes, db.Change{Namespace: namespace, Key: entry.Key, Entry: &entry})
+				}
+
+				if err := stream.Send(&store.ReplicationBatch{Changes: changesToProto(changes), LastSequence: s.db.LastSequence()}); err != nil {
+					return 0, err
+				}
+				sent += len(entries)
+			}
+
+			if next == nil {
+				break
+			}
+			from = next
+		}
+	}
+
+	err := stream.Send(&store.ReplicationBatch{
+		Sequence:     sequence,
+		LastSequence: s.db.LastSequence(),
+		ChangelogId:  s.db.ChangelogID(),
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	log.Info().Str("module", "replication").Int("shard_id", s.shard.ID).Str("replica", address).Int("entries", sent).Msg("sent snapshot to replica")
+
+	return sequence, nil
+}
+
+// replicationEnded reports how a stream ended, a replica closing it is not an
+// error.
+func replicationEnded(ctx context.Context, received <-chan error, err error) error {
+	if ctx.Err() == nil {
+		return err
+	}
+
+	select {
+	case err := <-received:
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		return err
+	default:
+		return status.FromContextError(ctx.Err()).Err()
+	}
+}
+
+// trimChangelogPeriodically drops the changes every replica has applied, and
+// the oldest ones beyond max_changes, which a replica that fell further behind
+// replaces with a snapshot.
+func (s *Server) trimChangelogPeriodically(ctx context.Context) {
+	ticker := time.NewTicker(s.config.Replication.TrimInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		if s.db.ChangelogID() == "" {
+			continue
+		}
+
+		last := s.db.LastSequence()
+		through := s.replication.trimmable(s.replicaAddresses(), last)
+		if last > s.config.Replication.MaxChanges {
+			through = max(through, last-s.config.Replication.MaxChanges)
+		}
+
+		trimmed, err := s.db.TrimChanges(through)
+		if err != nil {
+			log.Error().Str("module", "replication").Int("shard_id", s.shard.ID).Err(err).Msg("failed trimming changelog")
+			continue
+		}
+		if trimmed > 0 {
+			log.Debug().Str("module", "replication").Int("shard_id", s.shard.ID).Int("changes", trimmed).Uint64("through", through).Msg("trimmed changelog")
+		}
+	}
+}
+
+// follow keeps a replica streaming the changelog of its primary, reconnecting
+// from the last applied sequence whenever the stream breaks.
+func (s *Server) follow(ctx context.Context) {
+	for {
+		err := s.followOnce(ctx)
+		s.follower.connected.Store(false)
+
+		if ctx.Err() != nil {
+			return
+		}
+
+		log.Warn().Str("module", "replication").Int("shard_id", s.shard.ID).Str("primary", s.shard.Address).Err(err).Msg("replication stream ended, reconnecting")
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(s.config.Replication.RetryInterval):
+		}
+	}
+}
+
+func (s *Server) followOnce(ctx context.Context) error {
+	client, err := s.peer(s.shard)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	stream, err := client.Replicate(ctx)
+	if err != nil {
+		return err
+	}
+
+	if err := stream.Send(s.follower.ack(s.shard.ID)); err != nil {
+		return err
+	}
+
+	for {
+		batch, err := stream.Recv()
+		if err != nil {
+			return err
+		}
+		s.follower.connected.Store(true)
+
+		if err := s.applyBatch(batch); err != nil {
+			return fmt.Errorf("failed applying replication batch: %w", err)
+		}
+
+		if err := stream.Send(s.follower.ack(s.shard.ID)); err != nil {
+			return err
+		}
+	}
+}
+
+// applyBatch applies a batch of the primary and records the position reached.
+// A position is recorded before the changelog it belongs to, so a replica
+// interrupted in between starts over with a snapshot. Reads are rejected from
+// the start of a snapshot until its changelog is recorded.
+func (s *Server) applyBatch(batch *store.ReplicationBatch) error {
+	f := s.follower
+
+	if batch.Snapshot {
+		log.Info().Str("module", "replication").Int("shard_id", s.shard.ID).Str("primary", s.shard.Address).Msg("replacing local entries with a snapshot of the primary")
+
+		f.loaded.Store(false)
+		f.changelogID = ""
+		if err := s.db.DeleteSystemValue(replicaChangelogIDKey); err != nil {
+			return err
+		}
+		if err := s.recordApplied(0); err != nil {
+			return err
+		}
+
+		for _, namespace := range []string{db.NamespaceData, db.NamespaceQueues} {
+			if err := s.db.DropNamespace(namespace); err != nil {
+				return fmt.Errorf("failed dropping %s: %w", namespace, err)
+			}
+		}
+	}
+
+	if err := s.db.ApplyChanges(changesFromProto(batch.Changes)); err != nil {
+		return err
+	}
+
+	if batch.LastSequence > 0 {
+		f.sequence.Store(batch.LastSequence)
+	}
+
+	if batch.Sequence > 0 {
+		if err := s.recordApplied(batch.Sequence); err != nil {
+			return err
+		}
+	}
+
+	if batch.ChangelogId != "" && batch.ChangelogId != f.changelogID {
+		if err := s.db.SetSystemValue(replicaChangelogIDKey, []byte(batch.ChangelogId)); err != nil {
+			return err
+		}
+		f.changelogID = batch.ChangelogId
+		f.loaded.Store(true)
+	}
+
+	return nil
+}
+
+func (s *Server) recordApplied(sequence uint64) error {
+	if err := s.db.SetSystemValue(appliedSequenceKey, encodeSequence(sequence)); err != nil {
+		return fmt.Errorf("failed recording replication position: %w", err)
+	}
+
+	s.follower.applied.Store(sequence)
+	return nil
+}
+
+func changesToProto(changes []db.Change) []*store.ReplicatedChange {
+	out := make([]*store.ReplicatedChange, 0, len(changes))
+	for _, change := range changes {
+		replicated := &store.ReplicatedChange{
+			Sequence:       change.Sequence,
+			Namespace:      change.Namespace,
+			Key:            change.Key,
+			Field:          change.Field,
+			BucketSequence: change.BucketSequence,
+			Collection:     uint32(change.Collection),
+		}
+		if change.Entry != nil {
+			replicated.Entry = entriesToProto([]db.Entry{*change.Entry})[0]
+		}
+
+		out = append(out, replicated)
+	}
+
+	return out
+}
+
+func changesFromProto(changes []*store.ReplicatedChange) []db.Change {
+	out := make([]db.Change, 0, len(changes))
+	for _, replicated := range changes {
+		change := db.Change{
+			Sequence:       replicated.Sequence,
+			Namespace:      replicated.Namespace,
+			Key:            replicated.Key,
+			Field:          replicated.Field,
+			BucketSequence: replicated.BucketSequence,
+			Collection:     db.ValueType(replicated.Collection),
+		}
+		if replicated.Entry != nil {
+			change.Entry = &entriesFromProto([]*store.Entry{replicated.Entry})[0]
+		}
+
+		out = append(out, change)
+	}
+
+	return out
+}
@@ -0,0 +1,773 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"github.com/thenonexistent/nilis/internal/db"
+	"github.com/thenonexistent/nilis/pkg/sharding"
+	"github.com/thenonexistent/nilis/pkg/store"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/emptypb"
+)
+
+const (
+	migrationBatchSize  = 128
+	migrationRetryDelay = time.Second
+	reshardPollInterval = time.Second
+
+	reshardIdle        = "idle"
+	reshardMigrating   = "migrating"
+	reshardDone        = "done"
+	reshardReady       = "ready"
+	reshardUnreachable = "unreachable"
+)
+
+// migration tracks this node's part of a reshard: streaming away every key it
+// no longer owns under the target topology. Keys claimed by this node as
+// their new owner are remembered and persisted next to the target topology,
+// so late copies from the old owner can never overwrite or resurrect them,
+// not even after a restart.
+type migration struct {
+	epoch  uint64
+	cancel context.CancelFunc
+
+	mu      sync.Mutex
+	state   string
+	scanned int64
+	moved   int64
+	err     string
+
+	claimMu sync.Mutex
+	touched map[string]struct{}
+}
+
+func (m *migration) progress(scanned int64, moved int64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.scanned += scanned
+	m.moved += moved
+	m.err = ""
+}
+
+func (m *migration) fail(err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.err = err.Error()
+}
+
+func (m *migration) finish() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.state = reshardDone
+}
+
+func (m *migration) status(shardID int) *store.ShardMigrationStatus {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return &store.ShardMigrationStatus{
+		ShardId:     int32(shardID),
+		State:       m.state,
+		KeysScanned: m.scanned,
+		KeysMoved:   m.moved,
+		Error:       m.err,
+	}
+}
+
+func touchedKey(namespace string, key string) string {
+	return namespace + "\x00" + key
+}
+
+func (s *Server) StartReshard(ctx context.Context, in *store.Topology) (*store.ReshardStatus, error) {
+	if !s.config.Sharding.Enabled {
+		return nil, status.Error(codes.FailedPrecondition, "resharding requires sharding to be enabled")
+	}
+
+	current, target := s.topologies()
+	if target != nil {
+		return nil, status.Errorf(codes.FailedPrecondition, "reshard to epoch %d is already in progress", target.epoch)
+	}
+
+	settings := current.partitioner.Settings()
+	if in.Partitioner == "" {
+		in.Partitioner = settings.Strategy
+		in.HashTags = settings.HashTags
+	}
+	if in.HashFunction == "" {
+		in.HashFunction = settings.HashFunction
+	}
+	if in.VirtualNodes == 0 {
+		in.VirtualNodes = int32(settings.VirtualNodes)
+	}
+	in.Epoch = current.epoch + 1
+
+	next, err := topologyFromProto(in)
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "invalid target topology: %v", err)
+	}
+
+	if next.fingerprint() == current.fingerprint() {
+		return nil, status.Error(codes.InvalidArgument, "target topology places keys exactly like the current one")
+	}
+
+	req := &store.PrepareReshardRequest{
+		Current: topologyToProto(current),
+		Target:  topologyToProto(next),
+	}
+
+	if err := s.prepareReshard(req); err != nil {
+		return nil, err
+	}
+
+	log.Info().Str("module", "reshard").
+		Uint64("current_epoch", current.epoch).
+		Uint64("target_epoch", next.epoch).
+		Int("target_shards", len(next.shards())).
+		Msg("started resharding")
+
+	// peers that cannot be prepared now are retried by every coordinator loop
+	s.preparePeers(ctx, req)
+
+	return s.clusterReshardStatus(ctx), nil
+}
+
+func (s *Server) GetReshardStatus(ctx context.Context, in *emptypb.Empty) (*store.ReshardStatus, error) {
+	if isForwarded(ctx) {
+		return s.localReshardStatus(), nil
+	}
+
+	return s.clusterReshardStatus(ctx), nil
+}
+
+func (s *Server) PrepareReshard(ctx context.Context, in *store.PrepareReshardRequest) (*emptypb.Empty, error) {
+	if err := s.prepareReshard(in); err != nil {
+		return nil, err
+	}
+
+	return &emptypb.Empty{}, nil
+}
+
+// CommitReshard commits the local node when called by a peer. Called by an
+// operator it commits the whole cluster, which only succeeds once every shard
+// finished migrating.
+func (s *Server) CommitReshard(ctx context.Context, in *store.Epoch) (*emptypb.Empty, error) {
+	if isForwarded(ctx) {
+		if err := s.commitLocal(in.Epoch); err != nil {
+			return nil, err
+		}
+		return &emptypb.Empty{}, nil
+	}
+
+	_, target := s.topologies()
+	if target == nil || target.epoch != in.Epoch {
+		return nil, status.Errorf(codes.FailedPrecondition, "no reshard to epoch %d in progress", in.Epoch)
+	}
+
+	if !s.reshardComplete(ctx, *target) {
+		return nil, status.Error(codes.FailedPrecondition, "not every shard finished migrating")
+	}
+
+	if err := s.commitCluster(ctx, *target); err != nil {
+		return nil, status.Errorf(codes.Unavailable, "failed committing reshard: %v", err)
+	}
+
+	return &emptypb.Empty{}, nil
+}
+
+func (s *Server) ImportEntries(ctx context.Context, in *store.EntryBatch) (*store.Count, error) {
+	entries := entriesFromProto(in.Entries)
+
+	if m := s.activeMigration(); m != nil {
+		m.claimMu.Lock()
+		defer m.claimMu.Unlock()
+
+		fresh := entries[:0]
+		for _, entry := range entries {
+			if _, ok := m.touched[touchedKey(in.Namespace, string(entry.Key))]; !ok {
+				fresh = append(fresh, entry)
+			}
+		}
+		entries = fresh
+	}
+
+	if in.Namespace == db.NamespaceData {
+		admitted, err := s.admitSessions(ctx, entries)
+		if err != nil {
+			return nil, err
+		}
+		entries = admitted
+	}
+
+	imported, err := s.db.ImportEntries(in.Namespace, entries)
+	if err != nil {
+		log.Error().Str("module", "reshard").Str("namespace", in.Namespace).Err(err).Msg("failed importing entries")
+		return nil, status.Error(codes.Internal, "failed importing entries")
+	}
+
+	if in.Namespace == db.NamespaceData {
+		for _, entry := range entries {
+			if !entry.Bucket {
+				s.evictCachedKeys(s.admitCachedKey(string(entry.Key), len(entry.Value)))
+			}
+		}
+	}
+
+	return &store.Count{Count: int64(imported)}, nil
+}
+
+func (s *Server) ExportEntries(ctx context.Context, in *store.EntryKeys) (*store.EntryBatch, error) {
+	entries, err := s.db.ExportKeys(in.Namespace, in.Keys)
+	if err != nil {
+		log.Error().Str("module", "reshard").Str("namespace", in.Namespace).Err(err).Msg("failed exporting entries")
+		return nil, status.Error(codes.Internal, "failed exporting entries")
+	}
+
+	return &store.EntryBatch{
+		Namespace: in.Namespace,
+		Entries:   entriesToProto(entries),
+	}, nil
+}
+
+func (s *Server) DeleteEntries(ctx context.Context, in *store.EntryKeys) (*store.Count, error) {
+	deleted, err := s.db.DeleteEntries(in.Namespace, in.Keys)
+	if err != nil {
+		log.Error().Str("module", "reshard").Str("namespace", in.Namespace).Err(err).Msg("failed deleting entries")
+		return nil, status.Error(codes.Internal, "failed deleting entries")
+	}
+
+	if in.Namespace == db.NamespaceData {
+		keys := make([]string, 0, len(in.Keys))
+		for _, key := range in.Keys {
+			keys = append(keys, string(key))
+		}
+		s.forgetCachedKeys(keys)
+	}
+
+	return &store.Count{Count: int64(deleted)}, nil
+}
+
+func (s *Server) prepareReshard(in *store.PrepareReshardRequest) error {
+	if in.Current == nil || in.Target == nil {
+		return status.Error(codes.InvalidArgument, "current and target topology are required")
+	}
+
+	current, err := topologyFromProto(in.Current)
+	if err != nil {
+		return status.Errorf(codes.InvalidArgument, "invalid current topology: %v", err)
+	}
+
+	target, err := topologyFromProto(in.Target)
+	if err != nil {
+		return status.Errorf(codes.InvalidArgument, "invalid target topology: %v", err)
+	}
+
+	s.mu.Lock()
+
+	if s.current.epoch >= target.epoch {
+		s.mu.Unlock()
+		return nil
+	}
+
+	if s.target != nil {
+		defer s.mu.Unlock()
+		if s.target.epoch == target.epoch && s.target.fingerprint() == target.fingerprint() {
+			return nil
+		}
+		return status.Errorf(codes.FailedPrecondition, "reshard to epoch %d is already in progress", s.target.epoch)
+	}
+
+	// a node added by this reshard was started with the target shard list
+	local := s.current.fingerprint()
+	if local != current.fingerprint() && local != target.fingerprint() {
+		s.mu.Unlock()
+		return status.Error(codes.FailedPrecondition, "local topology matches neither the current nor the target topology")
+	}
+
+	// claims of a reshard whose commit was interrupted
+	if err := s.db.DeleteSystemKeys(claimedKeyPrefix); err != nil {
+		s.mu.Unlock()
+		return status.Errorf(codes.Internal, "failed clearing claimed keys: %v", err)
+	}
+	if err := s.saveTopology(currentTopologyKey, current); err != nil {
+		s.mu.Unlock()
+		return status.Errorf(codes.Internal, "failed persisting current topology: %v", err)
+	}
+	if err := s.saveTopology(targetTopologyKey, target); err != nil {
+		s.mu.Unlock()
+		return status.Errorf(codes.Internal, "failed persisting target topology: %v", err)
+	}
+
+	s.current = current
+	s.target = &target
+	s.mu.Unlock()
+
+	log.Info().Str("module", "reshard").Uint64("target_epoch", target.epoch).Msg("prepared for resharding")
+
+	if err := s.resumeReshard(); err != nil {
+		return status.Errorf(codes.Internal, "failed resuming reshard: %v", err)
+	}
+	return nil
+}
+
+func (s *Server) resumeReshard() error {
+	claimed, err := s.db.SystemKeys(claimedKeyPrefix)
+	if err != nil {
+		return fmt.Errorf("failed loading claimed keys: %w", err)
+	}
+
+	touched := make(map[string]struct{}, len(claimed))
+	for _, key := range claimed {
+		touched[strings.TrimPrefix(key, claimedKeyPrefix)] = struct{}{}
+	}
+
+	ctx, cancel := context.WithCancel(s.ctx)
+
+	s.mu.Lock()
+	if s.target == nil || s.migration != nil {
+		s.mu.Unlock()
+		cancel()
+		return nil
+	}
+
+	target := *s.target
+	m := &migration{
+		epoch:   target.epoch,
+		cancel:  cancel,
+		state:   reshardMigrating,
+		touched: touched,
+	}
+	s.migration = m
+	s.mu.Unlock()
+
+	go s.migrate(ctx, m, target)
+	go s.coordinateReshard(ctx, target)
+	return nil
+}
+
+func (s *Server) activeMigration() *migration {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.migration
+}
+
+func (s *Server) commitLocal(epoch uint64) error {
+	s.mu.Lock()
+
+	if s.current.epoch >= epoch {
+		s.mu.Unlock()
+		return nil
+	}
+
+	if s.target == nil || s.target.epoch != epoch {
+		s.mu.Unlock()
+		return status.Errorf(codes.FailedPrecondition, "not prepared for reshard to epoch %d", epoch)
+	}
+
+	m := s.migration
+	if m == nil || m.status(s.shard.ID).State != reshardDone {
+		s.mu.Unlock()
+		return status.Error(codes.FailedPrecondition, "local migration has not finished")
+	}
+
+	if err := s.saveTopology(currentTopologyKey, *s.target); err != nil {
+		s.mu.Unlock()
+		return status.Errorf(codes.Internal, "failed persisting topology: %v", err)
+	}
+	if err := s.db.DeleteSystemValue(targetTopologyKey); err != nil {
+		s.mu.Unlock()
+		return status.Errorf(codes.Internal, "failed clearing target topology: %v", err)
+	}
+	// left over claims are cleared by the next reshard as well
+	if err := s.db.DeleteSystemKeys(claimedKeyPrefix); err != nil {
+		log.Warn().Str("module", "reshard").Err(err).Msg("failed clearing claimed keys")
+	}
+
+	s.current = *s.target
+	s.target = nil
+	s.migration = nil
+	shards := s.current.shards()
+	s.mu.Unlock()
+
+	m.cancel()
+	s.shardPool.retain(shards)
+	s.startReplication()
+
+	log.Info().Str("module", "reshard").Uint64("epoch", epoch).Msg("committed new topology")
+	return nil
+}
+
+// migrate hands every local key that belongs to another shard under the
+// target topology to its new owner, deleting it locally once the owner has
+// stored it.
+func (s *Server) migrate(ctx context.Context, m *migration, target topology) {
+	for _, namespace := range []string{db.NamespaceData, db.NamespaceQueues} {
+		var from []byte
+
+		for {
+			var scanned int64
+			entries, next, err := s.db.ExportRange(namespace, from, migrationBatchSize, func(key []byte) bool {
+				scanned++
+				return s.ownerIn(target, namespace, string(key)).ID != s.shard.ID
+			})
+			if err == nil {
+				err = s.handOff(ctx, target, namespace, entries)
+			}
+
+			if err != nil {
+				if ctx.Err() != nil {
+					return
+				}
+
+				m.fail(err)
+				log.Error().Str("module", "reshard").Str("namespace", namespace).Err(err).Msg("failed migrating keys, retrying")
+
+				select {
+				case <-ctx.Done():
+					return
+				case <-time.After(migrationRetryDelay):
+				}
+				continue
+			}
+
+			m.progress(scanned, int64(len(entries)))
+
+			if next == nil {
+				break
+			}
+			from = next
+		}
+	}
+
+	m.finish()
+
+	st := m.status(s.shard.ID)
+	log.Info().Str("module", "reshard").
+		Int64("keys_scanned", st.KeysScanned).
+		Int64("keys_moved", st.KeysMoved).
+		Msg("finished migrating keys")
+}
+
+func (s *Server) handOff(ctx context.Context, target topology, namespace string, entries []db.Entry) error {
+	groups := make(map[int][]db.Entry)
+	owners := make(map[int]sharding.Shard)
+
+	for _, entry := range entries {
+		owner := s.ownerIn(target, namespace, string(entry.Key))
+		groups[owner.ID] = append(groups[owner.ID], entry)
+		owners[owner.ID] = owner
+	}
+
+	for id, group := range groups {
+		client, err := s.peer(owners[id])
+		if err != nil {
+			return err
+		}
+
+		_, err = client.ImportEntries(forwardContext(ctx), &store.EntryBatch{
+			Namespace: namespace,
+			Entries:   entriesToProto(group),
+		})
+		if err != nil {
+			return fmt.Errorf("failed handing keys to shard %d: %w", id, err)
+		}
+
+		keys := make([][]byte, 0, len(group))
+		for _, entry := range group {
+			keys = append(keys, entry.Key)
+		}
+
+		if _, err := s.DeleteEntries(ctx, &store.EntryKeys{Namespace: namespace, Keys: keys}); err != nil {
+			return fmt.Errorf("failed deleting keys handed to shard %d: %w", id, err)
+		}
+	}
+
+	return nil
+}
+
+// claimKey runs before this node serves a key it owns only under the target
+// topology, and pulls the key from its previous owner unless it was already
+// claimed, so reads see data that has not been migrated yet.
+func (s *Server) claimKey(ctx context.Context, namespace string, key string) error {
+	s.mu.RLock()
+	current, target, m := s.current, s.target, s.migration
+	s.mu.RUnlock()
+
+	if target == nil || m == nil {
+		return nil
+	}
+
+	if s.ownerIn(*target, namespace, key).ID != s.shard.ID {
+		return nil
+	}
+
+	previous := s.ownerIn(current, namespace, key)
+	if previous.ID == s.shard.ID {
+		return nil
+	}
+
+	m.claimMu.Lock()
+	defer m.claimMu.Unlock()
+
+	claim := touchedKey(namespace, key)
+	if _, ok := m.touched[claim]; ok {
+		return nil
+	}
+
+	client, err := s.peer(previous)
+	if err != nil {
+		return status.Errorf(codes.Unavailable, "previous owner of key %s is unavailable: %v", key, err)
+	}
+
+	keys := &store.EntryKeys{Namespace: namespace, Keys: [][]byte{[]byte(key)}}
+
+	batch, err := client.ExportEntries(forwardContext(ctx), keys)
+	if err != nil {
+		return status.Errorf(codes.Unavailable, "failed fetching key %s from shard %d: %v", key, previous.ID, status.Convert(err).Message())
+	}
+
+	if len(batch.Entries) > 0 {
+		entries := entriesFromProto(batch.Entries)
+		if namespace == db.NamespaceData {
+			if entries, err = s.admitSessions(ctx, entries); err != nil {
+				return err
+			}
+		}
+
+		if _, err := s.db.ImportEntries(namespace, entries); err != nil {
+			log.Error().Str("module", "reshard").Str("key", key).Err(err).Msg("failed importing claimed key")
+			return status.Error(codes.Internal, "failed importing key from previous owner")
+		}
+	}
+
+	if err := s.db.SetSystemValue(claimedKeyPrefix+claim, []byte{}); err != nil {
+		log.Error().Str("module", "reshard").Str("key", key).Err(err).Msg("failed recording claimed key")
+		return status.Error(codes.Internal, "failed recording claimed key")
+	}
+	m.touched[claim] = struct{}{}
+
+	if len(batch.Entries) > 0 {
+		// the previous owner skips claimed keys on import and deletes them
+		// locally afterwards, so a failure here only delays the cleanup
+		if _, err := client.DeleteEntries(forwardContext(ctx), keys); err != nil {
+			log.Warn().Str("module", "reshard").Str("key", key).Int("shard_id", previous.ID).Err(err).Msg("failed deleting claimed key from previous owner")
+		}
+	}
+
+	return nil
+}
+
+func (s *Server) ownerIn(t topology, namespace string, key string) sharding.Shard {
+	if namespace == db.NamespaceQueues {
+		key = s.queueRoutingKey(key)
+	}
+
+	return t.partitioner.ShardFromKey(key)
+}
+
+func (s *Server) coordinateReshard(ctx context.Context, target topology) {
+	ticker := time.NewTicker(reshardPollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		if !s.reshardComplete(ctx, target) {
+			continue
+		}
+
+		if err := s.commitCluster(ctx, target); err != nil {
+			log.Warn().Str("module", "reshard").Uint64("epoch", target.epoch).Err(err).Msg("failed committing reshard, retrying")
+			continue
+		}
+
+		return
+	}
+}
+
+// reshardComplete reports whether every shard of the current and target
+// topology finished migrating, preparing any shard that missed the reshard.
+func (s *Server) reshardComplete(ctx context.Context, target topology) bool {
+	current, _ := s.topologies()
+	req := &store.PrepareReshardRequest{
+		Current: topologyToProto(current),
+		Target:  topologyToProto(target),
+	}
+
+	complete := true
+	for _, node := range s.nodeStatuses(ctx) {
+		switch {
+		case node.err != nil:
+			complete = false
+		case node.status.CurrentEpoch >= target.epoch:
+		case node.status.TargetEpoch != target.epoch:
+			complete = false
+			if node.client != nil {
+				if _, err := node.client.PrepareReshard(forwardContext(ctx), req); err != nil {
+					log.Warn().Str("module", "reshard").Int("shard_id", node.id).Err(err).Msg("failed preparing shard for resharding")
+				}
+			}
+		case node.status.State != reshardDone:
+			complete = false
+		}
+	}
+
+	return complete
+}
+
+func (s *Server) commitCluster(ctx context.Context, target topology) error {
+	var failed []error
+
+	for id, client := range s.peers() {
+		if _, err := client.CommitReshard(forwardContext(ctx), &store.Epoch{Epoch: target.epoch}); err != nil {
+			failed = append(failed, fmt.Errorf("shard %d: %w", id, err))
+		}
+	}
+
+	if len(failed) > 0 {
+		return errors.Join(failed...)
+	}
+
+	return s.commitLocal(target.epoch)
+}
+
+func (s *Server) preparePeers(ctx context.Context, req *store.PrepareReshardRequest) {
+	for id, client := range s.peers() {
+		if _, err := client.PrepareReshard(forwardContext(ctx), req); err != nil {
+			log.Warn().Str("module", "reshard").Int("shard_id", id).Err(err).Msg("failed preparing shard for resharding")
+		}
+	}
+}
+
+type nodeStatus struct {
+	id     int
+	client *ShardClient
+	status *store.ReshardStatus
+	err    error
+}
+
+func (s *Server) nodeStatuses(ctx context.Context) []nodeStatus {
+	nodes := []nodeStatus{{id: s.shard.ID, status: s.localReshardStatus()}}
+
+	for id, client := range s.peers() {
+		st, err := client.GetReshardStatus(forwardContext(ctx), &emptypb.Empty{})
+		nodes = append(nodes, nodeStatus{id: id, client: client, status: st, err: err})
+	}
+
+	return nodes
+}
+
+func (s *Server) localReshardStatus() *store.ReshardStatus {
+	s.mu.RLock()
+	current, target, m := s.current, s.target, s.migration
+	s.mu.RUnlock()
+
+	shard := &store.ShardMigrationStatus{
+		ShardId: int32(s.shard.ID),
+		State:   reshardIdle,
+	}
+	if m != nil {
+		shard = m.status(s.shard.ID)
+	}
+
+	out := &store.ReshardStatus{
+		State:        shard.State,
+		CurrentEpoch: current.epoch,
+		Shards:       []*store.ShardMigrationStatus{shard},
+	}
+	if target != nil {
+		out.TargetEpoch = target.epoch
+	}
+
+	return out
+}
+
+func (s *Server) clusterReshardStatus(ctx context.Context) *store.ReshardStatus {
+	current, target := s.topologies()
+
+	out := &store.ReshardStatus{
+		State:        reshardIdle,
+		CurrentEpoch: current.epoch,
+	}
+	if target == nil {
+		out.Shards = s.localReshardStatus().Shards
+		return out
+	}
+
+	out.TargetEpoch = target.epoch
+	out.State = reshardReady
+
+	for _, node := range s.nodeStatuses(ctx) {
+		if node.err != nil {
+			out.State = reshardMigrating
+			out.Shards = append(out.Shards, &store.ShardMigrationStatus{
+				ShardId: int32(node.id),
+				State:   reshardUnreachable,
+				Error:   status.Convert(node.err).Message(),
+			})
+			continue
+		}
+
+		shard := node.status.Shards[0]
+		if node.status.CurrentEpoch >= target.epoch {
+			shard.State = reshardDone
+		}
+		if shard.State != reshardDone {
+			out.State = reshardMigrating
+		}
+		out.Shards = append(out.Shards, shard)
+	}
+
+	return out
+}
+
+func entriesToProto(entries []db.Entry) []*store.Entry {
+	out := make([]*store.Entry, 0, len(entries))
+	for _, entry := range entries {
+		out = append(out, &store.Entry{
+			Key:       entry.Key,
+			Value:     entry.Value,
+			Bucket:    entry.Bucket,
+			Sequence:  entry.Sequence,
+			Children:  entriesToProto(entry.Children),
+			SessionId: entry.Session,
+		})
+	}
+
+	return out
+}
+
+func entriesFromProto(entries []*store.Entry) []db.Entry {
+	out := make([]db.Entry, 0, len(entries))
+	for _, entry := range entries {
+		value := entry.Value
+		if !entry.Bucket && value == nil {
+			value = []byte{}
+		}
+
+		out = append(out, db.Entry{
+			Key:      entry.Key,
+			Value:    value,
+			Bucket:   entry.Bucket,
+			Sequence: entry.Sequence,
+			Children: entriesFromProto(entry.Children),
+			Session:  entry.SessionId,
+		})
+	}
+
+	return out
+}
@@ -0,0 +1,370 @@
+package main
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"sync/atomic"
+
+	"github.com/thenonexistent/nilis/pkg/sharding"
+	"github.com/thenonexistent/nilis/pkg/store"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/emptypb"
+)
+
+// shardRouter is the gRPC service of a node, handing every request to the
+// local shard it belongs to. Calls from peers name their shard, client
+// requests go to the local owner of their key, and anything else goes to the
+// primary shard, which forwards keys owned elsewhere like a single shard node.
+// Every method is routed explicitly, a method added without routing fails
+// as unimplemented instead of running on the wrong shard.
+type shardRouter struct {
+	primary *Server
+	servers map[int]*Server
+	// serving is set once the node verified its partitioner settings with
+	// its peers, client requests are rejected until then
+	serving atomic.Bool
+
+	store.UnimplementedStoreServer
+	store.UnimplementedClusterServer
+}
+
+func newShardRouter(servers []*Server) *shardRouter {
+	r := &shardRouter{
+		primary: servers[0],
+		servers: make(map[int]*Server, len(servers)),
+	}
+
+	for _, s := range servers {
+		r.servers[s.shard.ID] = s
+	}
+
+	return r
+}
+
+// server picks the local shard handling a request, key is empty for requests
+// not tied to a single key.
+func (r *shardRouter) server(ctx context.Context, key string) (*Server, error) {
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if values := md.Get(sharding.MetadataKey); len(values) > 0 {
+			id, err := strconv.Atoi(values[0])
+			if err != nil {
+				return nil, status.Errorf(codes.InvalidArgument, "invalid shard id %q", values[0])
+			}
+
+			s, ok := r.servers[id]
+			if !ok {
+				return nil, status.Errorf(codes.FailedPrecondition, "shard %d is not served by this node", id)
+			}
+			return s, nil
+		}
+	}
+
+	if key != "" && len(r.servers) > 1 {
+		owner, _ := r.primary.writeOwner(key)
+		if s, ok := r.servers[owner.ID]; ok {
+			return s, nil
+		}
+	}
+
+	return r.primary, nil
+}
+
+func route[In any, Out any](r *shardRouter, ctx context.Context, key string, in In, handler func(*Server, context.Context, In) (Out, error)) (Out, error) {
+	s, err := r.server(ctx, key)
+	if err != nil {
+		var out Out
+		return out, err
+	}
+
+	return handler(s, ctx, in)
+}
+
+// targetShardInterceptor names the shard every call of a peer client is meant
+// for.
+func targetShardInterceptor(shardID int) grpc.UnaryClientInterceptor {
+	value := strconv.Itoa(shardID)
+
+	return func(ctx context.Context, method string, req, reply any, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		return invoker(metadata.AppendToOutgoingContext(ctx, sharding.MetadataKey, value), method, req, reply, cc, opts...)
+	}
+}
+
+func targetShardStreamInterceptor(shardID int) grpc.StreamClientInterceptor {
+	value := strconv.Itoa(shardID)
+
+	return func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		return streamer(metadata.AppendToOutgoingContext(ctx, sharding.MetadataKey, value), desc, cc, method, opts...)
+	}
+}
+
+func (r *shardRouter) Set(ctx context.Context, in *store.Value) (*emptypb.Empty, error) {
+	return route(r, ctx, in.Key, in, (*Server).Set)
+}
+
+func (r *shardRouter) Get(ctx context.Context, in *store.Key) (*store.Value, error) {
+	return route(r, ctx, in.Key, in, (*Server).Get)
+}
+
+func (r *shardRouter) Delete(ctx context.Context, in *store.Key) (*emptypb.Empty, error) {
+	return route(r, ctx, in.Key, in, (*Server).Delete)
+}
+
+func (r *shardRouter) DeleteRange(ctx context.Context, in *store.DeleteRangeRequest) (*store.Count, error) {
+	return route(r, ctx, "", in, (*Server).DeleteRange)
+}
+
+func (r *shardRouter) MultiGet(ctx context.Context, in *store.Keys) (*store.KeyValues, error) {
+	return route(r, ctx, "", in, (*Server).MultiGet)
+}
+
+func (r *shardRouter) Scan(ctx context.Context, in *store.ScanRequest) (*store.KeyValues, error) {
+	return route(r, ctx, "", in, (*Server).Scan)
+}
+
+func (r *shardRouter) CreateSession(ctx context.Context, in *store.SessionRequest) (*store.Session, error) {
+	return route(r, ctx, "", in, (*Server).CreateSession)
+}
+
+func (r *shardRouter) Heartbeat(ctx context.Context, in *store.SessionID) (*emptypb.Empty, error) {
+	return route(r, ctx, "", in, (*Server).Heartbeat)
+}
+
+func (r *shardRouter) CloseSession(ctx context.Context, in *store.SessionID) (*emptypb.Empty, error) {
+	return route(r, ctx, "", in, (*Server).CloseSession)
+}
+
+func (r *shardRouter) HashSet(ctx context.Context, in *store.HashSetRequest) (*store.Count, error) {
+	return route(r, ctx, in.Key, in, (*Server).HashSet)
+}
+
+func (r *shardRouter) HashGet(ctx context.Context, in *store.HashField) (*store.HashField, error) {
+	return route(r, ctx, in.Key, in, (*Server).HashGet)
+}
+
+func (r *shardRouter) HashGetAll(ctx context.Context, in *store.Key) (*store.Hash, error) {
+	return route(r, ctx, in.Key, in, (*Server).HashGetAll)
+}
+
+func (r *shardRouter) HashDelete(ctx context.Context, in *store.HashFields) (*store.Count, error) {
+	return route(r, ctx, in.Key, in, (*Server).HashDelete)
+}
+
+func (r *shardRouter) ListPush(ctx context.Context, in *store.ListPushRequest) (*store.Count, error) {
+	return route(r, ctx, in.Key, in, (*Server).ListPush)
+}
+
+func (r *shardRouter) ListPop(ctx context.Context, in *store.ListPopRequest) (*store.Value, error) {
+	return route(r, ctx, in.Key, in, (*Server).ListPop)
+}
+
+func (r *shardRouter) ListRange(ctx context.Context, in *store.ListRangeRequest) (*store.Members, error) {
+	return route(r, ctx, in.Key, in, (*Server).ListRange)
+}
+
+func (r *shardRouter) SetAdd(ctx context.Context, in *store.Members) (*store.Count, error) {
+	return route(r, ctx, in.Key, in, (*Server).SetAdd)
+}
+
+func (r *shardRouter) SetRemove(ctx context.Context, in *store.Members) (*store.Count, error) {
+	return route(r, ctx, in.Key, in, (*Server).SetRemove)
+}
+
+func (r *shardRouter) SetMembers(ctx context.Context, in *store.Key) (*store.Members, error) {
+	return route(r, ctx, in.Key, in, (*Server).SetMembers)
+}
+
+func (r *shardRouter) SortedSetAdd(ctx context.Context, in *store.ScoredMembers) (*store.Count, error) {
+	return route(r, ctx, in.Key, in, (*Server).SortedSetAdd)
+}
+
+func (r *shardRouter) SortedSetRemove(ctx context.Context, in *store.Members) (*store.Count, error) {
+	return route(r, ctx, in.Key, in, (*Server).SortedSetRemove)
+}
+
+func (r *shardRouter) SortedSetRank(ctx context.Context, in *store.SortedSetMember) (*store.Rank, error) {
+	return route(r, ctx, in.Key, in, (*Server).SortedSetRank)
+}
+
+func (r *shardRouter) SortedSetRangeByRank(ctx context.Context, in *store.RankRangeRequest) (*store.ScoredMembers, error) {
+	return route(r, ctx, in.Key, in, (*Server).SortedSetRangeByRank)
+}
+
+func (r *shardRouter) SortedSetRangeByScore(ctx context.Context, in *store.ScoreRangeRequest) (*store.ScoredMembers, error) {
+	return route(r, ctx, in.Key, in, (*Server).SortedSetRangeByScore)
+}
+
+func (r *shardRouter) Enqueue(ctx context.Context, in *store.EnqueueRequest) (*store.MessageIDs, error) {
+	return route(r, ctx, r.primary.queueRoutingKey(in.Queue), in, (*Server).Enqueue)
+}
+
+func (r *shardRouter) Dequeue(ctx context.Context, in *store.DequeueRequest) (*store.QueueMessages, error) {
+	return route(r, ctx, r.primary.queueRoutingKey(in.Queue), in, (*Server).Dequeue)
+}
+
+func (r *shardRouter) Ack(ctx context.Context, in *store.Receipt) (*emptypb.Empty, error) {
+	return route(r, ctx, r.primary.queueRoutingKey(in.Queue), in, (*Server).Ack)
+}
+
+func (r *shardRouter) Nack(ctx context.Context, in *store.Receipt) (*emptypb.Empty, error) {
+	return route(r, ctx, r.primary.queueRoutingKey(in.Queue), in, (*Server).Nack)
+}
+
+func (r *shardRouter) GetCacheStats(ctx context.Context, in *emptypb.Empty) (*store.CacheStats, error) {
+	return route(r, ctx, "", in, (*Server).GetCacheStats)
+}
+
+func (r *shardRouter) GetShardMap(ctx context.Context, in *emptypb.Empty) (*store.ShardMap, error) {
+	return route(r, ctx, "", in, (*Server).GetShardMap)
+}
+
+func (r *shardRouter) WatchEvictions(in *emptypb.Empty, stream grpc.ServerStreamingServer[store.EvictionEvent]) error {
+	s, err := r.server(stream.Context(), "")
+	if err != nil {
+		return err
+	}
+
+	return s.WatchEvictions(in, stream)
+}
+
+func (r *shardRouter) Handshake(ctx context.Context, in *store.PartitionerInfo) (*store.PartitionerInfo, error) {
+	return route(r, ctx, "", in, (*Server).Handshake)
+}
+
+func (r *shardRouter) Ping(ctx context.Context, in *store.GossipMessage) (*store.GossipMessage, error) {
+	return route(r, ctx, "", in, (*Server).Ping)
+}
+
+func (r *shardRouter) PingReq(ctx context.Context, in *store.PingRequest) (*store.GossipMessage, error) {
+	return route(r, ctx, "", in, (*Server).PingReq)
+}
+
+func (r *shardRouter) ClusterStatus(ctx context.Context, in *emptypb.Empty) (*store.ClusterState, error) {
+	return route(r, ctx, "", in, (*Server).ClusterStatus)
+}
+
+func (r *shardRouter) GetPoolStats(ctx context.Context, in *emptypb.Empty) (*store.PoolStats, error) {
+	return route(r, ctx, "", in, (*Server).GetPoolStats)
+}
+
+func (r *shardRouter) GetOwnershipStats(ctx context.Context, in *emptypb.Empty) (*store.OwnershipStats, error) {
+	return route(r, ctx, "", in, (*Server).GetOwnershipStats)
+}
+
+func (r *shardRouter) FindMisplacedKeys(ctx context.Context, in *store.MisplacedKeysRequest) (*store.MisplacedKeys, error) {
+	return route(r, ctx, "", in, (*Server).FindMisplacedKeys)
+}
+
+func (r *shardRouter) CleanupOrphans(ctx context.Context, in *store.OrphanCleanupRequest) (*store.OrphanCleanupReport, error) {
+	return route(r, ctx, "", in, (*Server).CleanupOrphans)
+}
+
+func (r *shardRouter) GetKeyStats(ctx context.Context, in *store.KeyStatsRequest) (*store.KeyStats, error) {
+	return route(r, ctx, "", in, (*Server).GetKeyStats)
+}
+
+func (r *shardRouter) GetHotKeys(ctx context.Context, in *store.HotKeysRequest) (*store.HotKeys, error) {
+	return route(r, ctx, "", in, (*Server).GetHotKeys)
+}
+
+func (r *shardRouter) Backup(ctx context.Context, in *store.BackupRequest) (*store.BackupReport, error) {
+	return route(r, ctx, "", in, (*Server).Backup)
+}
+
+func (r *shardRouter) LookupSession(ctx context.Context, in *store.SessionID) (*store.Session, error) {
+	return route(r, ctx, "", in, (*Server).LookupSession)
+}
+
+func (r *shardRouter) GetReplicationStatus(ctx context.Context, in *emptypb.Empty) (*store.ReplicationStatus, error) {
+	return route(r, ctx, "", in, (*Server).GetReplicationStatus)
+}
+
+func (r *shardRouter) Replicate(stream store.Cluster_ReplicateServer) error {
+	s, err := r.server(stream.Context(), "")
+	if err != nil {
+		return err
+	}
+
+	return s.Replicate(stream)
+}
+
+func (r *shardRouter) StartReshard(ctx context.Context, in *store.Topology) (*store.ReshardStatus, error) {
+	return route(r, ctx, "", in, (*Server).StartReshard)
+}
+
+func (r *shardRouter) GetReshardStatus(ctx context.Context, in *emptypb.Empty) (*store.ReshardStatus, error) {
+	return route(r, ctx, "", in, (*Server).GetReshardStatus)
+}
+
+func (r *shardRouter) PrepareReshard(ctx context.Context, in *store.PrepareReshardRequest) (*emptypb.Empty, error) {
+	return route(r, ctx, "", in, (*Server).PrepareReshard)
+}
+
+func (r *shardRouter) CommitReshard(ctx context.Context, in *store.Epoch) (*emptypb.Empty, error) {
+	return route(r, ctx, "", in, (*Server).CommitReshard)
+}
+
+func (r *shardRouter) AddShard(ctx context.Context, in *store.ShardSpec) (*store.ReshardStatus, error) {
+	return route(r, ctx, "", in, (*Server).AddShard)
+}
+
+func (r *shardRouter) RemoveShard(ctx context.Context, in *store.ShardID) (*store.ReshardStatus, error) {
+	return route(r, ctx, "", in, (*Server).RemoveShard)
+}
+
+func (r *shardRouter) UpdateShard(ctx context.Context, in *store.ShardSpec) (*store.ShardMap, error) {
+	return route(r, ctx, "", in, (*Server).UpdateShard)
+}
+
+func (r *shardRouter) AddReplica(ctx context.Context, in *store.ReplicaRequest) (*store.ShardMap, error) {
+	return route(r, ctx, "", in, (*Server).AddReplica)
+}
+
+func (r *shardRouter) RemoveReplica(ctx context.Context, in *store.ReplicaRequest) (*store.ShardMap, error) {
+	return route(r, ctx, "", in, (*Server).RemoveReplica)
+}
+
+func (r *shardRouter) ApplyTopology(ctx context.Context, in *store.Topology) (*emptypb.Empty, error) {
+	return route(r, ctx, "", in, (*Server).ApplyTopology)
+}
+
+func (r *shardRouter) ImportEntries(ctx context.Context, in *store.EntryBatch) (*store.Count, error) {
+	return route(r, ctx, "", in, (*Server).ImportEntries)
+}
+
+func (r *shardRouter) ExportEntries(ctx context.Context, in *store.EntryKeys) (*store.EntryBatch, error) {
+	return route(r, ctx, "", in, (*Server).ExportEntries)
+}
+
+func (r *shardRouter) DeleteEntries(ctx context.Context, in *store.EntryKeys) (*store.Count, error) {
+	return route(r, ctx, "", in, (*Server).DeleteEntries)
+}
+
+// UnaryServingInterceptor rejects client requests until the node is serving,
+// cluster calls such as the handshake of starting peers pass through.
+func (r *shardRouter) UnaryServingInterceptor(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	if !r.serving.Load() && isStoreMethod(info.FullMethod) {
+		return nil, notServingError()
+	}
+
+	return handler(ctx, req)
+}
+
+func (r *shardRouter) StreamServingInterceptor(srv any, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	if !r.serving.Load() && isStoreMethod(info.FullMethod) {
+		return notServingError()
+	}
+
+	return handler(srv, stream)
+}
+
+func isStoreMethod(method string) bool {
+	return strings.HasPrefix(method, "/"+store.Store_ServiceDesc.ServiceName+"/")
+}
+
+func notServingError() error {
+	return status.Error(codes.Unavailable, "node is verifying partitioner settings with its peers")
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"context"
+
+	"github.com/rs/zerolog/log"
+	"github.com/thenonexistent/nilis/internal/db"
+	"github.com/thenonexistent/nilis/pkg/sharding"
+	"github.com/thenonexistent/nilis/pkg/store"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+const forwardedMetadataKey = "nilis-forwarded"
+
+// writeOwner returns the shard accepting requests for key along with the
+// epoch of the topology it was taken from, which is the target topology while
+// resharding.
+func (s *Server) writeOwner(key string) (sharding.Shard, uint64) {
+	current, target := s.topologies()
+	if target != nil {
+		return target.partitioner.ShardFromKey(key), target.epoch
+	}
+
+	return current.partitioner.ShardFromKey(key), current.epoch
+}
+
+// remoteOwner returns the client of the shard owning key when that shard is
+// not this server. Keys that cannot be forwarded to their owner, because
+// forwarding is disabled or a peer already forwarded the request, go through
+// the ownership check instead, so a topology disagreement cannot bounce a
+// request between nodes.
+func (s *Server) remoteOwner(ctx context.Context, key string) (*ShardClient, error) {
+	if !s.config.Sharding.Enabled {
+		return nil, nil
+	}
+
+	owner, epoch := s.writeOwner(key)
+	if owner.ID == s.shard.ID {
+		return nil, nil
+	}
+
+	if isForwarded(ctx) || !s.config.Sharding.ForwardRequests {
+		return nil, s.misplaced(key, owner, epoch)
+	}
+
+	if s.shardDown(owner) {
+		return nil, shardDownError(owner)
+	}
+
+	client, err := s.peer(owner)
+	if err != nil {
+		log.Error().Str("module", "cluster").Int("shard_id", owner.ID).Err(err).Msg("failed connecting to owner shard")
+		return nil, s.misplaced(key, owner, epoch)
+	}
+
+	return client, nil
+}
+
+// movedError tells a client which shard owns key, so it can retry there and
+// refresh its shard map when the epoch is newer than its own.
+func movedError(key string, owner sharding.Shard, epoch uint64) error {
+	st := status.Newf(codes.FailedPrecondition, "MOVED key %s is owned by shard %d at %s (epoch %d)", key, owner.ID, owner.Address, epoch)
+
+	detailed, err := st.WithDetails(&store.Moved{
+		Key:     key,
+		ShardId: int32(owner.ID),
+		Address: owner.Address,
+		Epoch:   epoch,
+	})
+	if err != nil {
+		return st.Err()
+	}
+
+	return detailed.Err()
+}
+
+// wrongTypeError rejects an operation against a key holding another kind of
+// value, the detail lets clients tell it apart from other failed
+// preconditions.
+func wrongTypeError(key string, message string) error {
+	st := status.New(codes.FailedPrecondition, message)
+
+	detailed, err := st.WithDetails(&store.WrongType{Key: key})
+	if err != nil {
+		return st.Err()
+	}
+
+	return detailed.Err()
+}
+
+// routeKey returns the client of the shard a key request has to be forwarded
+// to, or nil when it is served locally, after claiming the key from its
+// previous owner if needed.
+func (s *Server) routeKey(ctx context.Context, key string) (*ShardClient, error) {
+	if client, err := s.remoteOwner(ctx, key); client != nil || err != nil {
+		return client, err
+	}
+
+	return nil, s.claimKey(ctx, db.NamespaceData, key)
+}
+
+// routeQueue is routeKey for queues, claiming the dead letter queue along
+// with its source queue.
+func (s *Server) routeQueue(ctx context.Context, queue string) (*ShardClient, error) {
+	if client, err := s.remoteOwner(ctx, s.queueRoutingKey(queue)); client != nil || err != nil {
+		return client, err
+	}
+
+	source := s.queueRoutingKey(queue)
+	if err := s.claimKey(ctx, db.NamespaceQueues, source); err != nil {
+		return nil, err
+	}
+
+	if s.config.Queues.DeadLetterSuffix == "" {
+		return nil, nil
+	}
+
+	return nil, s.claimKey(ctx, db.NamespaceQueues, source+s.config.Queues.DeadLetterSuffix)
+}
+
+func forwardContext(ctx context.Context) context.Context {
+	return metadata.AppendToOutgoingContext(ctx, forwardedMetadataKey, "true")
+}
+
+func isForwarded(ctx context.Context) bool {
+	md, ok := metadata.FromIncomingContext(ctx)
+	return ok && len(md.Get(forwardedMetadataKey)) > 0
+}
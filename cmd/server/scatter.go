@@ -0,0 +1,312 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"github.com/thenonexistent/nilis/internal/db"
+	"github.com/thenonexistent/nilis/pkg/sharding"
+	"github.com/thenonexistent/nilis/pkg/store"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	defaultScanLimit = 1000
+	maxScanLimit     = 10000
+)
+
+// MultiGet reads keys from every shard owning one of them. Shards that fail
+// are reported in the response next to the keys the others returned.
+func (s *Server) MultiGet(ctx context.Context, in *store.Keys) (*store.KeyValues, error) {
+	keys := slices.Compact(slices.Sorted(slices.Values(in.Keys)))
+
+	groups := make(map[int][]string)
+	owners := make(map[int]sharding.Shard)
+	out := &store.KeyValues{}
+
+	for _, key := range keys {
+		owner := s.shard
+		if s.config.Sharding.Enabled {
+			var epoch uint64
+			owner, epoch = s.writeOwner(key)
+
+			// a forwarded group is never forwarded again
+			if isForwarded(ctx) && owner.ID != s.shard.ID {
+				if err := s.misplaced(key, owner, epoch); err != nil {
+					out.Errors = append(out.Errors, &store.ShardError{ShardId: int32(s.shard.ID), Error: status.Convert(err).Message()})
+					continue
+				}
+				owner = s.shard
+			}
+		}
+
+		groups[owner.ID] = append(groups[owner.ID], key)
+		owners[owner.ID] = owner
+	}
+
+	var mu sync.Mutex
+
+	clients := make(map[int]*ShardClient)
+	for id, owner := range owners {
+		if id == s.shard.ID {
+			continue
+		}
+
+		client, err := s.peer(owner)
+		if err != nil {
+			out.Errors = append(out.Errors, &store.ShardError{ShardId: int32(id), Error: err.Error()})
+			continue
+		}
+		clients[id] = client
+	}
+
+	failures := s.fanOut(ctx, clients, func(ctx context.Context, id int, client *ShardClient) error {
+		res, err := client.MultiGet(forwardContext(ctx), &store.Keys{Keys: groups[id]})
+		if err != nil {
+			return err
+		}
+
+		mu.Lock()
+		defer mu.Unlock()
+
+		out.Entries = append(out.Entries, res.Entries...)
+		out.Errors = append(out.Errors, res.Errors...)
+		return nil
+	})
+
+	if local := groups[s.shard.ID]; len(local) > 0 {
+		entries, err := s.localMultiGet(ctx, local)
+		if err != nil {
+			failures[s.shard.ID] = err
+		}
+		out.Entries = append(out.Entries, entries...)
+	}
+
+	out.Errors = append(out.Errors, shardErrors(failures)...)
+	sortKeyValues(out)
+
+	return out, nil
+}
+
+func (s *Server) localMultiGet(ctx context.Context, keys []string) ([]*store.KeyValue, error) {
+	for _, key := range keys {
+		if err := s.claimKey(ctx, db.NamespaceData, key); err != nil {
+			return nil, err
+		}
+	}
+
+	entries, err := s.db.GetKeys(keys)
+	if err != nil {
+		log.Error().Str("module", "server").Int("keys", len(keys)).Err(err).Msg("failed getting values from local database")
+		return nil, fmt.Errorf("failed getting data from database")
+	}
+
+	out := make([]*store.KeyValue, 0, len(entries))
+	for _, entry := range entries {
+		if entry.Type == db.TypeString {
+			s.touchCachedKey(entry.Key)
+		}
+		out = append(out, keyValueToProto(entry))
+	}
+
+	return out, nil
+}
+
+// Scan returns keys of a prefix or a [start, end) range across all shards in
+// key order. When more keys follow, next holds the start key of the next page.
+func (s *Server) Scan(ctx context.Context, in *store.ScanRequest) (*store.KeyValues, error) {
+	start, end, err := scanBounds(in)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	limit := int(in.Limit)
+	if limit == 0 {
+		limit = defaultScanLimit
+	}
+	if limit < 0 || limit > maxScanLimit {
+		return nil, status.Errorf(codes.InvalidArgument, "limit must be between 1 and %d", maxScanLimit)
+	}
+
+	out := &store.KeyValues{}
+	more := false
+	var mu sync.Mutex
+
+	failures := make(map[int]error)
+	if s.config.Sharding.Enabled && !isForwarded(ctx) {
+		failures = s.fanOut(ctx, s.peers(), func(ctx context.Context, id int, client *ShardClient) error {
+			res, err := client.Scan(forwardContext(ctx), in)
+			if err != nil {
+				return err
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+
+			out.Entries = append(out.Entries, res.Entries...)
+			out.Errors = append(out.Errors, res.Errors...)
+			more = more || res.Next != ""
+			return nil
+		})
+	}
+
+	entries, localMore, err := s.db.Scan(start, end, limit, in.KeysOnly)
+	if err != nil {
+		log.Error().Str("module", "server").Err(err).Msg("failed scanning local database")
+		failures[s.shard.ID] = fmt.Errorf("failed scanning database")
+	}
+	for _, entry := range entries {
+		out.Entries = append(out.Entries, keyValueToProto(entry))
+	}
+
+	out.Errors = append(out.Errors, shardErrors(failures)...)
+	sortKeyValues(out)
+
+	// during a reshard a key can briefly exist on its old and new owner
+	out.Entries = slices.CompactFunc(out.Entries, func(a, b *store.KeyValue) bool {
+		return a.Key == b.Key
+	})
+
+	if len(out.Entries) > limit {
+		out.Entries = out.Entries[:limit]
+		more = true
+	}
+	if (more || localMore) && len(out.Entries) > 0 {
+		out.Next = out.Entries[len(out.Entries)-1].Key + "\x00"
+	}
+
+	return out, nil
+}
+
+// fanOut calls fn for every client in parallel, at most fanout_concurrency
+// at a time, and returns the errors by shard id. Every call gets an even share
+// of the time left before the request deadline.
+func (s *Server) fanOut(ctx context.Context, clients map[int]*ShardClient, fn func(ctx context.Context, id int, client *ShardClient) error) map[int]error {
+	ids := make([]int, 0, len(clients))
+	for id := range clients {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+
+	failures := make(map[int]error)
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+
+	sem := make(chan struct{}, s.config.Sharding.FanoutConcurrency)
+
+	for i, id := range ids {
+		if client := clients[id]; s.shardDown(client.shard) {
+			mu.Lock()
+			failures[id] = shardDownError(client.shard)
+			mu.Unlock()
+			continue
+		}
+
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+			mu.Lock()
+			for _, skipped := range ids[i:] {
+				failures[skipped] = ctx.Err()
+			}
+			mu.Unlock()
+
+			wg.Wait()
+			return failures
+		}
+
+		callCtx, cancel := s.fanOutContext(ctx, len(ids)-i)
+
+		wg.Add(1)
+		go func(id int, client *ShardClient) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			defer cancel()
+
+			if err := fn(callCtx, id, client); err != nil {
+				log.Warn().Str("module", "server").Int("shard_id", id).Err(err).Msg("shard failed during fan-out")
+
+				mu.Lock()
+				failures[id] = err
+				mu.Unlock()
+			}
+		}(id, clients[id])
+	}
+
+	wg.Wait()
+	return failures
+}
+
+func (s *Server) fanOutContext(ctx context.Context, pending int) (context.Context, context.CancelFunc) {
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		return context.WithCancel(ctx)
+	}
+
+	concurrency := s.config.Sharding.FanoutConcurrency
+	waves := (pending + concurrency - 1) / concurrency
+
+	// a tenth of the remaining time is left for merging and replying
+	budget := time.Until(deadline) * 9 / 10 / time.Duration(waves)
+
+	return context.WithTimeout(ctx, budget)
+}
+
+func scanBounds(in *store.ScanRequest) ([]byte, []byte, error) {
+	if in.End != "" && in.Start >= in.End {
+		return nil, nil, fmt.Errorf("start key must sort before end key")
+	}
+
+	start, end := []byte(in.Start), []byte(in.End)
+
+	if in.Prefix != "" {
+		prefix := []byte(in.Prefix)
+		if bytes.Compare(start, prefix) < 0 {
+			start = prefix
+		}
+
+		prefixEnd := db.PrefixEnd(prefix)
+		if len(prefixEnd) > 0 && (len(end) == 0 || bytes.Compare(prefixEnd, end) < 0) {
+			end = prefixEnd
+		}
+	}
+
+	return start, end, nil
+}
+
+func shardErrors(failures map[int]error) []*store.ShardError {
+	out := make([]*store.ShardError, 0, len(failures))
+	for id, err := range failures {
+		out = append(out, &store.ShardError{
+			ShardId: int32(id),
+			Error:   status.Convert(err).Message(),
+		})
+	}
+
+	return out
+}
+
+func sortKeyValues(out *store.KeyValues) {
+	slices.SortStableFunc(out.Entries, func(a, b *store.KeyValue) int {
+		return strings.Compare(a.Key, b.Key)
+	})
+	slices.SortFunc(out.Errors, func(a, b *store.ShardError) int {
+		return int(a.ShardId - b.ShardId)
+	})
+}
+
+func keyValueToProto(entry db.KeyValue) *store.KeyValue {
+	return &store.KeyValue{
+		Key:   entry.Key,
+		Value: entry.Value,
+		Type:  entry.Type.String(),
+	}
+}
@@ -2,30 +2,67 @@ package main
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"os"
+	"sync"
 
 	"github.com/rs/zerolog/log"
+	"github.com/thenonexistent/nilis/internal/cache"
 	cfg "github.com/thenonexistent/nilis/internal/config"
 	"github.com/thenonexistent/nilis/internal/db"
+	"github.com/thenonexistent/nilis/internal/hotkeys"
+	"github.com/thenonexistent/nilis/internal/membership"
 	"github.com/thenonexistent/nilis/pkg/sharding"
 	"github.com/thenonexistent/nilis/pkg/store"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
-	"google.golang.org/grpc/credentials"
 	"google.golang.org/grpc/status"
 	"google.golang.org/protobuf/types/known/emptypb"
 )
 
 type Server struct {
-	db        *db.Database
-	shard     sharding.Shard
-	shards    []sharding.Shard
-	shardPool map[int]*ShardClient
-	config    *cfg.Config
+	db          *db.Database
+	shard       sharding.Shard
+	config      *cfg.Config
+	sessions    *sessionTable
+	cache       *cache.Tracker
+	evictions   *evictionFeed
+	hotKeys     *hotkeys.Detector
+	follower    *follower
+	replication *replication
+	gossip      *membership.Node
+	shardPool   *shardPool
+	primary     *Server
+	ownership   ownershipCounters
+	cleanupMu   sync.Mutex
+	adoptMu     sync.Mutex
+	ctx         context.Context
+	cancel      context.CancelFunc
+
+	mu        sync.RWMutex
+	current   topology
+	target    *topology
+	migration *migration
+
 	store.StoreServer
+	store.ClusterServer
+}
+
+type ShardClient struct {
+	shard   sharding.Shard
+	conn    *grpc.ClientConn
+	breaker *circuitBreaker
+	cancel  context.CancelFunc
+	store.StoreClient
+	store.ClusterClient
 }
 
-func NewServer(config *cfg.Config, shard sharding.Shard, shards []sharding.Shard) (*Server, func() error, error) {
+// NewServer creates the server of one local shard. Further shards of the same
+// node pass the first one as primary, whose connection pool and failure
+// detection they share. overrideMetadata accepts a database recorded for
+// another shard.
+func NewServer(config *cfg.Config, shard sharding.Shard, partitioner sharding.Partitioner, primary *Server, overrideMetadata bool) (*Server, func() error, error) {
 	if config == nil {
 		return nil, nil, fmt.Errorf("null configuration provided")
 	}
@@ -34,43 +71,194 @@ func NewServer(config *cfg.Config, shard sharding.Shard, shards []sharding.Shard
 		return nil, nil, fmt.Errorf("server shard is not initialized")
 	}
 
-	if len(shards) == 0 {
+	if partitioner == nil {
+		return nil, nil, fmt.Errorf("null shard partitioner provided")
+	}
+
+	if len(partitioner.Shards()) == 0 {
 		return nil, nil, fmt.Errorf("shard list should contain at least one shard")
 
 	}
 
-	database, err := db.NewDatabase(config.Server.DatabaseLocation)
+	if config.Server.DataDirectory != "" {
+		if err := os.MkdirAll(config.Server.DataDirectory, 0o755); err != nil {
+			return nil, nil, fmt.Errorf("failed creating data directory: %w", err)
+		}
+	}
+
+	database, err := db.NewDatabase(cfg.DatabaseLocation(config, shard.ID), db.Options{
+		Stripes:  config.Server.Stripes,
+		Metadata: shardMetadata(shard.ID, topology{epoch: initialEpoch, partitioner: partitioner}),
+	})
 	if err != nil {
 		log.Error().Str("module", "server").Err(err).Msg("failed to create database for store")
 		return nil, nil, err
 	}
 
-	return &Server{
-		db:     database,
-		shard:  shard,
-		shards: shards,
-		config: config,
-	}, database.Close, nil
+	if database.Stripes() != config.Server.Stripes {
+		log.Warn().Str("module", "server").Int("shard_id", shard.ID).Int("stripes", database.Stripes()).Int("configured_stripes", config.Server.Stripes).Msg("database keeps the stripe count it was created with")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	s := &Server{
+		db:       database,
+		shard:    shard,
+		config:   config,
+		sessions: newSessionTable(config.Sessions.MaxMissedHeartbeats),
+		ctx:      ctx,
+		cancel:   cancel,
+		current:  topology{epoch: initialEpoch, partitioner: partitioner},
+		primary:  primary,
+	}
+
+	if primary != nil {
+		s.shardPool = primary.shardPool
+	} else {
+		s.shardPool = newShardPool(ctx, config, s.dialOptions)
+	}
+
+	if config.Sharding.Replica {
+		if err := s.initFollower(); err != nil {
+			cancel()
+			database.Close()
+			return nil, nil, fmt.Errorf("failed initializing replica: %w", err)
+		}
+	}
+
+	if err := s.restoreTopology(); err != nil {
+		cancel()
+		database.Close()
+		return nil, nil, fmt.Errorf("failed restoring persisted topology: %w", err)
+	}
+
+	if err := s.openChangelog(); err != nil {
+		cancel()
+		database.Close()
+		return nil, nil, fmt.Errorf("failed opening changelog: %w", err)
+	}
+
+	if err := s.VerifyMetadata(overrideMetadata); err != nil {
+		cancel()
+		database.Close()
+		return nil, nil, fmt.Errorf("refusing database of another shard, start with -override-metadata for an intentional migration: %w", err)
+	}
+
+	if err := s.initCache(); err != nil {
+		cancel()
+		database.Close()
+		return nil, nil, fmt.Errorf("failed initializing cache: %w", err)
+	}
+
+	if err := s.restoreSessions(); err != nil {
+		cancel()
+		database.Close()
+		return nil, nil, fmt.Errorf("failed restoring sessions: %w", err)
+	}
+
+	// a replica receives session changes from its primary
+	if !s.isReplica() {
+		go s.reapSessions(ctx)
+	}
+
+	if config.HotKeys.Enabled {
+		s.hotKeys = hotkeys.NewDetector(hotkeys.Config{
+			Capacity:   config.HotKeys.Capacity,
+			Window:     config.HotKeys.Window,
+			Buckets:    config.HotKeys.Buckets,
+			SampleRate: config.HotKeys.SampleRate,
+		})
+		go s.logHotKeys(ctx)
+	}
+
+	return s, s.Close, nil
 }
 
 func (s *Server) InitCluster() error {
-	for _, shard := range s.shards {
-		if shard.ID == s.shard.ID.ID {
+	current, target := s.topologies()
+
+	for _, shard := range current.shards() {
+		if shard.ID == s.shard.ID {
 			continue
 		}
 
-		cnOpts := []grpc.DialOption{}
+		if _, err := s.peer(shard); err != nil {
+			return err
+		}
+	}
+
+	if target != nil && !s.isReplica() {
+		if err := s.resumeReshard(); err != nil {
+			return fmt.Errorf("failed resuming reshard: %w", err)
+		}
+	}
+
+	if s.config.Sharding.Enabled {
+		go s.syncTopology(s.ctx)
+	}
+
+	if s.config.Sharding.Enabled && s.config.Orphans.Enabled && !s.isReplica() {
+		go s.cleanupOrphansPeriodically(s.ctx)
+	}
+
+	if s.isReplica() && s.config.Replication.Enabled {
+		go s.follow(s.ctx)
+	}
+
+	if s.replication != nil {
+		go s.trimChangelogPeriodically(s.ctx)
+	}
 
-		if s.config.Server.UseTLS {
-			creds, err := credentials.NewClientTLSFromFile()
+	if s.primary != nil {
+		s.gossip = s.primary.gossip
+	} else if s.config.Sharding.Enabled && s.config.Gossip.Enabled {
+		if err := s.initGossip(); err != nil {
+			return fmt.Errorf("failed starting failure detection: %w", err)
 		}
+	}
+
+	return nil
+}
+
+func (s *Server) Close() error {
+	s.cancel()
 
-		conn, err := grpc.NewClient(shard.Address)
+	if s.primary == nil {
+		s.shardPool.close()
 	}
+
+	return s.db.Close()
 }
 
 func (s *Server) Set(ctx context.Context, in *store.Value) (*emptypb.Empty, error) {
-	err := s.db.SetKey(in.Key, in.Value)
+	client, err := s.routeKey(ctx, in.Key)
+	if err != nil {
+		return nil, err
+	}
+	if client != nil {
+		return client.Set(forwardContext(ctx), in)
+	}
+
+	if !s.fitsCache(in.Key, len(in.Value)) {
+		return nil, status.Errorf(codes.ResourceExhausted, "value for key %s exceeds the cache capacity", in.Key)
+	}
+
+	if in.SessionId != "" {
+		return s.setEphemeral(ctx, in)
+	}
+
+	var victims []string
+	err = s.db.SetKey(in.Key, in.Value, func() {
+		victims = s.admitCachedKey(in.Key, len(in.Value))
+	})
+	s.evictCachedKeys(victims)
+	if err != nil {
+		s.forgetCachedKeys([]string{in.Key})
+	}
+
+	if errors.Is(err, db.ErrWrongType) {
+		return nil, wrongTypeError(in.Key, fmt.Sprintf("key %s holds the wrong kind of value", in.Key))
+	}
 	if err != nil {
 		log.Error().Str("module", "server").Str("key", in.Key).Bytes("value", in.Value).Err(err).Msg("failed setting value in local database")
 		return nil, status.Error(codes.Internal, "failed setting data in database")
@@ -80,7 +268,18 @@ func (s *Server) Set(ctx context.Context, in *store.Value) (*emptypb.Empty, erro
 }
 
 func (s *Server) Get(ctx context.Context, in *store.Key) (*store.Value, error) {
+	client, err := s.routeKey(ctx, in.Key)
+	if err != nil {
+		return nil, err
+	}
+	if client != nil {
+		return client.Get(forwardContext(ctx), in)
+	}
+
 	value, err := s.db.GetKey(in.Key)
+	if errors.Is(err, db.ErrWrongType) {
+		return nil, wrongTypeError(in.Key, fmt.Sprintf("key %s holds the wrong kind of value", in.Key))
+	}
 	if err != nil {
 		log.Error().Str("module", "server").Str("key", in.Key).Err(err).Msg("failed getting value from local database")
 		return nil, status.Error(codes.Internal, "failed getting data from database")
@@ -91,6 +290,8 @@ func (s *Server) Get(ctx context.Context, in *store.Key) (*store.Value, error) {
 		return nil, status.Errorf(codes.NotFound, "key %s not found", in.Key)
 	}
 
+	s.touchCachedKey(in.Key)
+
 	return &store.Value{
 		Key:   in.Key,
 		Value: value,
@@ -98,12 +299,52 @@ func (s *Server) Get(ctx context.Context, in *store.Key) (*store.Value, error) {
 }
 
 func (s *Server) Delete(ctx context.Context, in *store.Key) (*emptypb.Empty, error) {
-	err := s.db.DeleteKey(in.Key)
+	client, err := s.routeKey(ctx, in.Key)
+	if err != nil {
+		return nil, err
+	}
+	if client != nil {
+		return client.Delete(forwardContext(ctx), in)
+	}
+
+	err = s.db.DeleteKey(in.Key)
 	if err != nil {
 		log.Error().Str("module", "server").Str("key", in.Key).Err(err).Msg("failed deleting value from local database")
 		return nil, status.Error(codes.Internal, "failed deleting data from database")
 	}
 
+	s.forgetCachedKeys([]string{in.Key})
+
+	return &emptypb.Empty{}, nil
+}
+
+func (s *Server) setEphemeral(ctx context.Context, in *store.Value) (*emptypb.Empty, error) {
+	if !s.sessions.contains(in.SessionId) {
+		if err := s.adoptSession(ctx, in.SessionId); err != nil {
+			return nil, err
+		}
+	}
+
+	var victims []string
+	err := s.db.SetEphemeralKey(in.SessionId, in.Key, in.Value, func() {
+		victims = s.admitCachedKey(in.Key, len(in.Value))
+	})
+	s.evictCachedKeys(victims)
+	if err != nil {
+		s.forgetCachedKeys([]string{in.Key})
+	}
+
+	if errors.Is(err, db.ErrWrongType) {
+		return nil, wrongTypeError(in.Key, fmt.Sprintf("key %s holds the wrong kind of value", in.Key))
+	}
+	if errors.Is(err, db.ErrSessionNotFound) {
+		return nil, status.Errorf(codes.NotFound, "session %s not found or expired", in.SessionId)
+	}
+	if err != nil {
+		log.Error().Str("module", "server").Str("key", in.Key).Str("session_id", in.SessionId).Err(err).Msg("failed setting ephemeral value in local database")
+		return nil, status.Error(codes.Internal, "failed setting data in database")
+	}
+
 	return &emptypb.Empty{}, nil
 }
 
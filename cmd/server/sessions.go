@@ -0,0 +1,459 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"github.com/thenonexistent/nilis/internal/db"
+	"github.com/thenonexistent/nilis/pkg/sharding"
+	"github.com/thenonexistent/nilis/pkg/store"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/emptypb"
+)
+
+const (
+	sessionReapInterval  = 250 * time.Millisecond
+	sessionLookupTimeout = 2 * time.Second
+)
+
+type session struct {
+	heartbeatInterval time.Duration
+	lastHeartbeat     time.Time
+	// foreign sessions are held by another shard, which owns some of their
+	// keys here. They are kept alive by looking them up at their holder
+	// instead of by heartbeats, lastHeartbeat is the last successful lookup.
+	foreign  bool
+	checking bool
+	// expired sessions stay in the table until their keys were deleted, so a
+	// failed delete is retried on the next reap
+	expired bool
+}
+
+type sessionTable struct {
+	mu        sync.Mutex
+	sessions  map[string]*session
+	maxMissed int
+}
+
+func newSessionTable(maxMissed int) *sessionTable {
+	return &sessionTable{
+		sessions:  make(map[string]*session),
+		maxMissed: maxMissed,
+	}
+}
+
+func (t *sessionTable) add(id string, heartbeatInterval time.Duration) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.sessions[id] = &session{
+		heartbeatInterval: heartbeatInterval,
+		lastHeartbeat:     time.Now(),
+	}
+}
+
+// adopt adds a foreign session, returning false when the session is already
+// known, live or not.
+func (t *sessionTable) adopt(id string, heartbeatInterval time.Duration) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if _, ok := t.sessions[id]; ok {
+		return false
+	}
+
+	t.sessions[id] = &session{
+		heartbeatInterval: heartbeatInterval,
+		lastHeartbeat:     time.Now(),
+		foreign:           true,
+	}
+	return true
+}
+
+func (t *sessionTable) touch(id string) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	sess, ok := t.sessions[id]
+	if !ok || sess.expired || sess.foreign {
+		return false
+	}
+
+	sess.lastHeartbeat = time.Now()
+	return true
+}
+
+func (t *sessionTable) contains(id string) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	sess, ok := t.sessions[id]
+	return ok && !sess.expired
+}
+
+// held returns the heartbeat interval of a live session held by this shard.
+func (t *sessionTable) held(id string) (time.Duration, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	sess, ok := t.sessions[id]
+	if !ok || sess.expired || sess.foreign {
+		return 0, false
+	}
+
+	return sess.heartbeatInterval, true
+}
+
+// expire marks a live session as expired, returning false when it was not.
+func (t *sessionTable) expire(id string) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	sess, ok := t.sessions[id]
+	if !ok || sess.expired {
+		return false
+	}
+
+	sess.expired = true
+	return true
+}
+
+func (t *sessionTable) remove(id string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	delete(t.sessions, id)
+}
+
+func (t *sessionTable) timeout(heartbeatInterval time.Duration) time.Duration {
+	return heartbeatInterval * time.Duration(t.maxMissed)
+}
+
+func (t *sessionTable) expired(now time.Time) []string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	var expired []string
+	for id, sess := range t.sessions {
+		if sess.expired || now.Sub(sess.lastHeartbeat) > t.timeout(sess.heartbeatInterval) {
+			expired = append(expired, id)
+			sess.expired = true
+		}
+	}
+
+	return expired
+}
+
+// due returns the foreign sessions not looked up for a heartbeat interval and
+// marks them as being checked.
+func (t *sessionTable) due(now time.Time) []string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	var due []string
+	for id, sess := range t.sessions {
+		if !sess.foreign || sess.expired || sess.checking || now.Sub(sess.lastHeartbeat) < sess.heartbeatInterval {
+			continue
+		}
+		sess.checking = true
+		due = append(due, id)
+	}
+
+	return due
+}
+
+// checked records the outcome of looking up a foreign session, a failed
+// lookup counts as a missed heartbeat.
+func (t *sessionTable) checked(id string, alive bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	sess, ok := t.sessions[id]
+	if !ok {
+		return
+	}
+
+	sess.checking = false
+	if alive {
+		sess.lastHeartbeat = time.Now()
+	}
+}
+
+func (s *Server) restoreSessions() error {
+	persisted, err := s.db.Sessions()
+	if err != nil {
+		return err
+	}
+
+	// clients get a full timeout after startup to resume heartbeating their sessions
+	for id, heartbeatInterval := range persisted {
+		if holder, ok := sharding.SessionShard(id); ok && holder != s.shard.ID {
+			s.sessions.adopt(id, heartbeatInterval)
+			continue
+		}
+		s.sessions.add(id, heartbeatInterval)
+	}
+
+	if len(persisted) > 0 {
+		log.Info().Str("module", "sessions").Int("count", len(persisted)).Msg("restored persisted sessions")
+	}
+
+	return nil
+}
+
+func (s *Server) reapSessions(ctx context.Context) {
+	ticker := time.NewTicker(sessionReapInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			for _, id := range s.sessions.due(now) {
+				go s.checkForeignSession(ctx, id)
+			}
+			for _, id := range s.sessions.expired(now) {
+				s.expireSession(id, "session timed out")
+			}
+		}
+	}
+}
+
+// expireSession deletes the keys of an expired session, the session is
+// dropped from the table only once they are gone.
+func (s *Server) expireSession(id string, reason string) {
+	deleted, err := s.db.DeleteSession(id)
+	if err != nil && !errors.Is(err, db.ErrSessionNotFound) {
+		log.Error().Str("module", "sessions").Str("session_id", id).Err(err).Msg("failed deleting session keys, retrying on the next reap")
+		return
+	}
+
+	s.sessions.remove(id)
+	s.forgetCachedKeys(deleted)
+
+	log.Info().Str("module", "sessions").Str("session_id", id).Int("deleted_keys", len(deleted)).Msg(reason)
+}
+
+// checkForeignSession looks up a foreign session at its holder and deletes
+// its keys here once the holder no longer knows it. A holder that cannot be
+// reached expires the session like missed heartbeats would.
+func (s *Server) checkForeignSession(ctx context.Context, id string) {
+	ctx, cancel := context.WithTimeout(ctx, sessionLookupTimeout)
+	defer cancel()
+
+	_, err := s.lookupSession(ctx, id)
+	if status.Code(err) == codes.NotFound {
+		s.sessions.checked(id, false)
+		if s.sessions.expire(id) {
+			s.expireSession(id, "session ended on its holding shard")
+		}
+		return
+	}
+	if err != nil {
+		log.Warn().Str("module", "sessions").Str("session_id", id).Err(err).Msg("failed looking up session on its holding shard")
+	}
+
+	s.sessions.checked(id, err == nil)
+}
+
+// adoptSession admits an ephemeral key of a session held by another shard,
+// after the holder confirmed the session is alive.
+func (s *Server) adoptSession(ctx context.Context, id string) error {
+	if holder, ok := sharding.SessionShard(id); !ok || holder == s.shard.ID {
+		return status.Errorf(codes.NotFound, "session %s not found or expired", id)
+	}
+
+	sess, err := s.lookupSession(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	s.adoptMu.Lock()
+	defer s.adoptMu.Unlock()
+
+	if s.sessions.contains(id) {
+		return nil
+	}
+
+	heartbeatInterval := time.Duration(sess.HeartbeatIntervalMs) * time.Millisecond
+	if !s.sessions.adopt(id, heartbeatInterval) {
+		// the session is known but expired, its keys are being deleted
+		return status.Errorf(codes.NotFound, "session %s not found or expired", id)
+	}
+
+	if err := s.db.CreateSession(id, heartbeatInterval); err != nil {
+		s.sessions.remove(id)
+		log.Error().Str("module", "sessions").Str("session_id", id).Err(err).Msg("failed persisting foreign session")
+		return status.Error(codes.Internal, "failed setting data in database")
+	}
+
+	return nil
+}
+
+// admitSessions adopts the sessions of ephemeral keys handed over by another
+// shard, dropping keys whose session ended. A holder that cannot be reached
+// fails the import, the shard handing the keys over retries it.
+func (s *Server) admitSessions(ctx context.Context, entries []db.Entry) ([]db.Entry, error) {
+	ended := make(map[string]bool)
+
+	admitted := entries[:0]
+	for _, entry := range entries {
+		if entry.Session != "" && !s.sessions.contains(entry.Session) {
+			if _, ok := ended[entry.Session]; !ok {
+				err := s.adoptSession(ctx, entry.Session)
+				if err != nil && status.Code(err) != codes.NotFound {
+					return nil, err
+				}
+				ended[entry.Session] = err != nil
+			}
+			if ended[entry.Session] {
+				continue
+			}
+		}
+		admitted = append(admitted, entry)
+	}
+
+	return admitted, nil
+}
+
+// lookupSession asks the shard holding a session whether it is alive.
+func (s *Server) lookupSession(ctx context.Context, id string) (*store.Session, error) {
+	server, client, err := s.sessionHolder(id)
+	if err != nil {
+		return nil, err
+	}
+	if server != nil {
+		return server.LookupSession(ctx, &store.SessionID{Id: id})
+	}
+
+	return client.LookupSession(ctx, &store.SessionID{Id: id})
+}
+
+// sessionHolder resolves the shard holding a session, local shards are
+// returned as server and others as a peer client.
+func (s *Server) sessionHolder(id string) (*Server, *ShardClient, error) {
+	holder, ok := sharding.SessionShard(id)
+	if !ok || holder == s.shard.ID {
+		return s, nil, nil
+	}
+	if s.primary != nil && s.primary.shard.ID == holder {
+		return s.primary, nil, nil
+	}
+
+	current, _ := s.topologies()
+	shard, ok := sharding.FindShardById(current.shards(), holder)
+	if !ok {
+		return nil, nil, status.Errorf(codes.NotFound, "session %s not found, shard %d holding it left the cluster", id, holder)
+	}
+
+	client, err := s.peer(shard)
+	if err != nil {
+		log.Error().Str("module", "sessions").Int("shard_id", holder).Err(err).Msg("failed connecting to shard holding session")
+		return nil, nil, status.Errorf(codes.Unavailable, "shard %d holding session %s is unavailable", holder, id)
+	}
+
+	return nil, client, nil
+}
+
+func (s *Server) CreateSession(ctx context.Context, in *store.SessionRequest) (*store.Session, error) {
+	heartbeatInterval := time.Duration(in.HeartbeatIntervalMs) * time.Millisecond
+	if heartbeatInterval == 0 {
+		heartbeatInterval = s.config.Sessions.DefaultHeartbeatInterval
+	}
+
+	if heartbeatInterval < s.config.Sessions.MinHeartbeatInterval || heartbeatInterval > s.config.Sessions.MaxHeartbeatInterval {
+		return nil, status.Errorf(codes.InvalidArgument, "heartbeat interval must be between %s and %s",
+			s.config.Sessions.MinHeartbeatInterval, s.config.Sessions.MaxHeartbeatInterval)
+	}
+
+	id, err := newSessionID(s.shard.ID)
+	if err != nil {
+		log.Error().Str("module", "sessions").Err(err).Msg("failed generating session id")
+		return nil, status.Error(codes.Internal, "failed creating session")
+	}
+
+	if err := s.db.CreateSession(id, heartbeatInterval); err != nil {
+		log.Error().Str("module", "sessions").Str("session_id", id).Err(err).Msg("failed persisting session")
+		return nil, status.Error(codes.Internal, "failed creating session")
+	}
+
+	s.sessions.add(id, heartbeatInterval)
+
+	return &store.Session{
+		Id:                  id,
+		HeartbeatIntervalMs: heartbeatInterval.Milliseconds(),
+		TimeoutMs:           s.sessions.timeout(heartbeatInterval).Milliseconds(),
+	}, nil
+}
+
+func (s *Server) Heartbeat(ctx context.Context, in *store.SessionID) (*emptypb.Empty, error) {
+	server, client, err := s.sessionHolder(in.Id)
+	if err != nil {
+		return nil, err
+	}
+	if client != nil {
+		return client.Heartbeat(forwardContext(ctx), in)
+	}
+	if server != s {
+		return server.Heartbeat(ctx, in)
+	}
+
+	if !s.sessions.touch(in.Id) {
+		return nil, status.Errorf(codes.NotFound, "session %s not found or expired", in.Id)
+	}
+
+	return &emptypb.Empty{}, nil
+}
+
+// CloseSession deletes the keys of a session held by this shard, shards
+// owning further keys of it delete theirs once their next lookup finds the
+// session gone.
+func (s *Server) CloseSession(ctx context.Context, in *store.SessionID) (*emptypb.Empty, error) {
+	server, client, err := s.sessionHolder(in.Id)
+	if err != nil {
+		return nil, err
+	}
+	if client != nil {
+		return client.CloseSession(forwardContext(ctx), in)
+	}
+	if server != s {
+		return server.CloseSession(ctx, in)
+	}
+
+	if !s.sessions.expire(in.Id) {
+		return nil, status.Errorf(codes.NotFound, "session %s not found or expired", in.Id)
+	}
+
+	s.expireSession(in.Id, "session closed")
+
+	return &emptypb.Empty{}, nil
+}
+
+func (s *Server) LookupSession(ctx context.Context, in *store.SessionID) (*store.Session, error) {
+	heartbeatInterval, ok := s.sessions.held(in.Id)
+	if !ok {
+		return nil, status.Errorf(codes.NotFound, "session %s not found or expired", in.Id)
+	}
+
+	return &store.Session{
+		Id:                  in.Id,
+		HeartbeatIntervalMs: heartbeatInterval.Milliseconds(),
+		TimeoutMs:           s.sessions.timeout(heartbeatInterval).Milliseconds(),
+	}, nil
+}
+
+func newSessionID(shardID int) (string, error) {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+
+	return sharding.SessionID(shardID, hex.EncodeToString(buf)), nil
+}
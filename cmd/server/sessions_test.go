@@ -0,0 +1,162 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	cfg "github.com/thenonexistent/nilis/internal/config"
+	"github.com/thenonexistent/nilis/pkg/sharding"
+	"github.com/thenonexistent/nilis/pkg/store"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// newLocalShards starts a router over two shards served by the same node.
+func newLocalShards(t *testing.T) (*shardRouter, sharding.Partitioner) {
+	t.Helper()
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, "nilis.yaml")
+	yaml := fmt.Sprintf(`
+server:
+  listen_port: 7299
+  bind_address: "127.0.0.1"
+  data_directory: %q
+sharding:
+  enabled: true
+  shard_ids: [0, 1]
+  shards:
+    - id: 0
+      address: "127.0.0.1:7299"
+    - id: 1
+      address: "127.0.0.1:7299"
+gossip:
+  enabled: false
+`, dir)
+	if err := os.WriteFile(path, []byte(yaml), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	var config cfg.Config
+	if err := cfg.LoadConfigFile(path, &config); err != nil {
+		t.Fatal(err)
+	}
+	if err := cfg.ValidateConfig(&config); err != nil {
+		t.Fatal(err)
+	}
+
+	shards := cfg.CreateShards(&config)
+	partitioner, err := cfg.CreatePartitioner(&config, shards)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var servers []*Server
+	for _, shard := range shards {
+		var primary *Server
+		if len(servers) > 0 {
+			primary = servers[0]
+		}
+
+		s, closeFunc, err := NewServer(&config, shard, partitioner, primary, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { closeFunc() })
+
+		servers = append(servers, s)
+	}
+
+	return newShardRouter(servers), partitioner
+}
+
+func keyOnShard(t *testing.T, partitioner sharding.Partitioner, id int) string {
+	t.Helper()
+
+	for i := 0; i < 1000; i++ {
+		key := fmt.Sprintf("key-%d", i)
+		if partitioner.ShardFromKey(key).ID == id {
+			return key
+		}
+	}
+
+	t.Fatalf("no key found on shard %d", id)
+	return ""
+}
+
+func TestEphemeralKeysAcrossLocalShards(t *testing.T) {
+	router, partitioner := newLocalShards(t)
+	ctx := context.Background()
+
+	session, err := router.CreateSession(ctx, &store.SessionRequest{HeartbeatIntervalMs: 500})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	local := keyOnShard(t, partitioner, 0)
+	other := keyOnShard(t, partitioner, 1)
+
+	if _, err := router.Set(ctx, &store.Value{Key: local, Value: []byte("a"), SessionId: session.Id}); err != nil {
+		t.Fatalf("setting ephemeral key on the session's shard: %v", err)
+	}
+	if _, err := router.Set(ctx, &store.Value{Key: other, Value: []byte("b"), SessionId: session.Id}); err != nil {
+		t.Fatalf("setting ephemeral key on another shard: %v", err)
+	}
+
+	plain := "plain"
+	if _, err := router.Set(ctx, &store.Value{Key: plain, Value: []byte("c")}); err != nil {
+		t.Fatalf("setting plain key: %v", err)
+	}
+
+	if _, err := router.Heartbeat(ctx, &store.SessionID{Id: session.Id}); err != nil {
+		t.Fatalf("heartbeat: %v", err)
+	}
+	if _, err := router.CloseSession(ctx, &store.SessionID{Id: session.Id}); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := router.Get(ctx, &store.Key{Key: local}); status.Code(err) != codes.NotFound {
+		t.Fatalf("ephemeral key survived its session: %v", err)
+	}
+
+	// the other shard deletes its keys once its next lookup finds the
+	// session gone
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		_, err := router.Get(ctx, &store.Key{Key: other})
+		if status.Code(err) == codes.NotFound {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("ephemeral key on another shard survived its session: %v", err)
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+
+	if _, err := router.Get(ctx, &store.Key{Key: plain}); err != nil {
+		t.Fatalf("plain key was deleted with the session: %v", err)
+	}
+
+	_, err = router.Set(ctx, &store.Value{Key: other, Value: []byte("b"), SessionId: session.Id})
+	if status.Code(err) != codes.NotFound {
+		t.Fatalf("setting ephemeral key of a closed session: got %v, want NotFound", err)
+	}
+}
+
+func TestEphemeralKeysUnknownSession(t *testing.T) {
+	router, partitioner := newLocalShards(t)
+	ctx := context.Background()
+
+	for _, id := range []string{"missing", "0-missing", "7-missing"} {
+		for shard := 0; shard < 2; shard++ {
+			_, err := router.Set(ctx, &store.Value{Key: keyOnShard(t, partitioner, shard), Value: []byte("a"), SessionId: id})
+			if status.Code(err) != codes.NotFound {
+				t.Fatalf("session %s on shard %d: got %v, want NotFound", id, shard, err)
+			}
+		}
+	}
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"context"
+	"errors"
+
+	"github.com/thenonexistent/nilis/internal/db"
+	"github.com/thenonexistent/nilis/pkg/store"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func (s *Server) SortedSetAdd(ctx context.Context, in *store.ScoredMembers) (*store.Count, error) {
+	client, err := s.routeKey(ctx, in.Key)
+	if err != nil {
+		return nil, err
+	}
+	if client != nil {
+		return client.SortedSetAdd(forwardContext(ctx), in)
+	}
+
+	members := make([]db.ScoredMember, 0, len(in.Members))
+	for _, member := range in.Members {
+		members = append(members, db.ScoredMember{
+			Member: member.Member,
+			Score:  member.Score,
+		})
+	}
+
+	added, err := s.db.SortedSetAdd(in.Key, members)
+	if err != nil {
+		return nil, sortedSetError(err, in.Key, "sorted set add")
+	}
+
+	return &store.Count{Count: int64(added)}, nil
+}
+
+func (s *Server) SortedSetRemove(ctx context.Context, in *store.Members) (*store.Count, error) {
+	client, err := s.routeKey(ctx, in.Key)
+	if err != nil {
+		return nil, err
+	}
+	if client != nil {
+		return client.SortedSetRemove(forwardContext(ctx), in)
+	}
+
+	removed, err := s.db.SortedSetRemove(in.Key, in.Members)
+	if err != nil {
+		return nil, sortedSetError(err, in.Key, "sorted set remove")
+	}
+
+	return &store.Count{Count: int64(removed)}, nil
+}
+
+func (s *Server) SortedSetRank(ctx context.Context, in *store.SortedSetMember) (*store.Rank, error) {
+	client, err := s.routeKey(ctx, in.Key)
+	if err != nil {
+		return nil, err
+	}
+	if client != nil {
+		return client.SortedSetRank(forwardContext(ctx), in)
+	}
+
+	rank, score, found, err := s.db.SortedSetRank(in.Key, in.Member, in.Reverse)
+	if err != nil {
+		return nil, sortedSetError(err, in.Key, "sorted set rank")
+	}
+
+	if !found {
+		return nil, status.Errorf(codes.NotFound, "member not found in sorted set %s", in.Key)
+	}
+
+	return &store.Rank{
+		Rank:  rank,
+		Score: score,
+	}, nil
+}
+
+func (s *Server) SortedSetRangeByRank(ctx context.Context, in *store.RankRangeRequest) (*store.ScoredMembers, error) {
+	client, err := s.routeKey(ctx, in.Key)
+	if err != nil {
+		return nil, err
+	}
+	if client != nil {
+		return client.SortedSetRangeByRank(forwardContext(ctx), in)
+	}
+
+	members, err := s.db.SortedSetRangeByRank(in.Key, in.Start, in.Stop, in.Reverse)
+	if err != nil {
+		return nil, sortedSetError(err, in.Key, "sorted set range by rank")
+	}
+
+	return scoredMembersToProto(in.Key, members), nil
+}
+
+func (s *Server) SortedSetRangeByScore(ctx context.Context, in *store.ScoreRangeRequest) (*store.ScoredMembers, error) {
+	client, err := s.routeKey(ctx, in.Key)
+	if err != nil {
+		return nil, err
+	}
+	if client != nil {
+		return client.SortedSetRangeByScore(forwardContext(ctx), in)
+	}
+
+	if in.Offset < 0 || in.Limit < 0 {
+		return nil, status.Error(codes.InvalidArgument, "offset and limit cannot be negative")
+	}
+
+	members, err := s.db.SortedSetRangeByScore(in.Key, in.Min, in.Max, in.Offset, in.Limit, in.Reverse)
+	if err != nil {
+		return nil, sortedSetError(err, in.Key, "sorted set range by score")
+	}
+
+	return scoredMembersToProto(in.Key, members), nil
+}
+
+func sortedSetError(err error, key string, operation string) error {
+	if errors.Is(err, db.ErrInvalidScore) {
+		return status.Errorf(codes.InvalidArgument, "%s: %v", operation, err)
+	}
+
+	return collectionError(err, key, operation)
+}
+
+func scoredMembersToProto(key string, members []db.ScoredMember) *store.ScoredMembers {
+	out := &store.ScoredMembers{
+		Key:     key,
+		Members: make([]*store.ScoredMember, 0, len(members)),
+	}
+
+	for _, member := range members {
+		out.Members = append(out.Members, &store.ScoredMember{
+			Member: member.Member,
+			Score:  member.Score,
+		})
+	}
+
+	return out
+}
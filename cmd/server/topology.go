@@ -0,0 +1,306 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"slices"
+
+	"github.com/rs/zerolog/log"
+	cfg "github.com/thenonexistent/nilis/internal/config"
+	"github.com/thenonexistent/nilis/pkg/sharding"
+	"github.com/thenonexistent/nilis/pkg/store"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/emptypb"
+)
+
+const (
+	initialEpoch = 1
+
+	currentTopologyKey = "topology"
+	targetTopologyKey  = "target_topology"
+	// claimedKeyPrefix records every key claimed while resharding to the
+	// target topology
+	claimedKeyPrefix = "target_claimed/"
+)
+
+// topology is a versioned shard map, the epoch grows with every committed
+// change so nodes can tell which of two views is newer.
+type topology struct {
+	epoch       uint64
+	partitioner sharding.Partitioner
+}
+
+func (t topology) shards() []sharding.Shard {
+	return append([]sharding.Shard(nil), t.partitioner.Shards()...)
+}
+
+func (t topology) fingerprint() string {
+	return t.partitioner.Settings().Fingerprint(t.partitioner.Shards())
+}
+
+// digest identifies the whole topology including addresses and replicas, it
+// breaks the tie between two different topologies of the same epoch.
+func (t topology) digest() string {
+	encoded := topologyToProto(t)
+	slices.SortFunc(encoded.Shards, func(a, b *store.ShardSpec) int {
+		return cmp.Compare(a.Id, b.Id)
+	})
+	for _, spec := range encoded.Shards {
+		slices.Sort(spec.Replicas)
+	}
+
+	raw, _ := proto.MarshalOptions{Deterministic: true}.Marshal(encoded)
+	sum := sha256.Sum256(raw)
+
+	return hex.EncodeToString(sum[:])
+}
+
+func (t topology) contains(id int) bool {
+	_, ok := sharding.FindShardById(t.partitioner.Shards(), id)
+	return ok
+}
+
+func topologyToProto(t topology) *store.Topology {
+	settings := t.partitioner.Settings()
+
+	out := &store.Topology{
+		Epoch:        t.epoch,
+		Partitioner:  settings.Strategy,
+		HashFunction: settings.HashFunction,
+		VirtualNodes: int32(settings.VirtualNodes),
+		HashTags:     settings.HashTags,
+	}
+
+	for _, shard := range t.partitioner.Shards() {
+		spec := &store.ShardSpec{
+			Id:      int32(shard.ID),
+			Address: shard.Address,
+			Weight:  int32(shard.Weight),
+		}
+		for _, replica := range shard.Replicas {
+			spec.Replicas = append(spec.Replicas, replica.Address)
+		}
+		out.Shards = append(out.Shards, spec)
+	}
+
+	return out
+}
+
+func topologyFromProto(in *store.Topology) (topology, error) {
+	if err := validateTopology(in); err != nil {
+		return topology{}, err
+	}
+
+	shards := make([]sharding.Shard, 0, len(in.Shards))
+	for _, spec := range in.Shards {
+		replicas := make([]sharding.Replica, 0, len(spec.Replicas))
+		for _, address := range spec.Replicas {
+			replicas = append(replicas, sharding.Replica{Address: address})
+		}
+
+		weight := int(spec.Weight)
+		if weight == 0 {
+			weight = 1
+		}
+
+		shards = append(shards, sharding.Shard{
+			ID:       int(spec.Id),
+			Address:  spec.Address,
+			Replicas: replicas,
+			Weight:   weight,
+		})
+	}
+
+	partitioner, err := sharding.NewPartitioner(sharding.PartitionerSettings{
+		Strategy:     in.Partitioner,
+		HashFunction: in.HashFunction,
+		VirtualNodes: int(in.VirtualNodes),
+		HashTags:     in.HashTags,
+	}, shards)
+	if err != nil {
+		return topology{}, err
+	}
+
+	return topology{epoch: in.Epoch, partitioner: partitioner}, nil
+}
+
+func validateTopology(in *store.Topology) error {
+	if len(in.Shards) == 0 {
+		return errors.New("topology must contain at least one shard")
+	}
+
+	// several shards may share an address when a node serves more than one
+	ids := make(map[int32]struct{})
+	replicas := make(map[string]struct{})
+
+	for _, spec := range in.Shards {
+		if spec.Id < 0 {
+			return fmt.Errorf("shard id must be non-negative: %d", spec.Id)
+		}
+		if spec.Address == "" {
+			return fmt.Errorf("shard address cannot be empty for shard id: %d", spec.Id)
+		}
+		if !cfg.IsValidAddressFormat(spec.Address) {
+			return fmt.Errorf("shard address does not follow ip:port format for shard id: %d", spec.Id)
+		}
+		if spec.Weight < 0 {
+			return fmt.Errorf("shard weight must be non-negative for shard id: %d", spec.Id)
+		}
+
+		if _, exists := ids[spec.Id]; exists {
+			return fmt.Errorf("duplicate shard id found: %d", spec.Id)
+		}
+		ids[spec.Id] = struct{}{}
+
+		for _, replica := range spec.Replicas {
+			if !cfg.IsValidAddressFormat(replica) {
+				return fmt.Errorf("replica address does not follow ip:port format for shard id: %d", spec.Id)
+			}
+
+			if _, exists := replicas[replica]; exists {
+				return fmt.Errorf("duplicate replica address found in shard id %d: %s", spec.Id, replica)
+			}
+			replicas[replica] = struct{}{}
+		}
+	}
+
+	if in.Partitioner == sharding.StrategyModulo {
+		for id := range ids {
+			if int(id) >= len(in.Shards) {
+				return fmt.Errorf("modulo partitioner requires shard ids 0 to %d, got: %d", len(in.Shards)-1, id)
+			}
+		}
+	}
+
+	return nil
+}
+
+func (s *Server) topologies() (topology, *topology) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.current, s.target
+}
+
+// restoreTopology prefers the topology persisted by a committed reshard over
+// the shard list of the configuration file, which only describes how the
+// cluster was first set up.
+func (s *Server) restoreTopology() error {
+	persisted, err := s.loadTopology(currentTopologyKey)
+	if err != nil {
+		return err
+	}
+
+	if persisted != nil {
+		if persisted.fingerprint() != s.current.fingerprint() {
+			log.Warn().Str("module", "cluster").
+				Uint64("epoch", persisted.epoch).
+				Msg("shard list in configuration is outdated, using persisted topology")
+		}
+		s.current = *persisted
+	}
+
+	s.target, err = s.loadTopology(targetTopologyKey)
+	return err
+}
+
+func (s *Server) loadTopology(key string) (*topology, error) {
+	raw, err := s.db.GetSystemValue(key)
+	if err != nil || raw == nil {
+		return nil, err
+	}
+
+	var encoded store.Topology
+	if err := proto.Unmarshal(raw, &encoded); err != nil {
+		return nil, fmt.Errorf("failed decoding %s: %w", key, err)
+	}
+
+	t, err := topologyFromProto(&encoded)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s: %w", key, err)
+	}
+
+	return &t, nil
+}
+
+func (s *Server) saveTopology(key string, t topology) error {
+	raw, err := proto.Marshal(topologyToProto(t))
+	if err != nil {
+		return err
+	}
+
+	if err := s.db.SetSystemValue(key, raw); err != nil {
+		return err
+	}
+
+	if key == currentTopologyKey {
+		return s.db.SetMetadata(shardMetadata(s.shard.ID, t))
+	}
+
+	return nil
+}
+
+func (s *Server) peer(shard sharding.Shard) (*ShardClient, error) {
+	return s.shardPool.get(shard)
+}
+
+func (s *Server) dialOptions() ([]grpc.DialOption, error) {
+	if !s.config.Server.UseTLS {
+		return []grpc.DialOption{grpc.WithTransportCredentials(insecure.NewCredentials())}, nil
+	}
+
+	creds, err := newClientTLS(s.config)
+	if err != nil {
+		return nil, fmt.Errorf("failed initiating client mtls: %w", err)
+	}
+
+	return []grpc.DialOption{grpc.WithTransportCredentials(creds)}, nil
+}
+
+// peers returns clients for every other shard of the current topology, and
+// of the target topology while resharding.
+func (s *Server) peers() map[int]*ShardClient {
+	current, target := s.topologies()
+
+	var shards []sharding.Shard
+	if target != nil {
+		shards = target.shards()
+	}
+	shards = append(shards, current.shards()...)
+
+	clients := make(map[int]*ShardClient)
+	for _, shard := range shards {
+		if shard.ID == s.shard.ID {
+			continue
+		}
+		if _, ok := clients[shard.ID]; ok {
+			continue
+		}
+
+		client, err := s.peer(shard)
+		if err != nil {
+			log.Error().Str("module", "cluster").Int("shard_id", shard.ID).Err(err).Msg("failed connecting to peer shard")
+			continue
+		}
+		clients[shard.ID] = client
+	}
+
+	return clients
+}
+
+func (s *Server) GetShardMap(ctx context.Context, in *emptypb.Empty) (*store.ShardMap, error) {
+	current, target := s.topologies()
+
+	out := &store.ShardMap{Current: topologyToProto(current)}
+	if target != nil {
+		out.Target = topologyToProto(*target)
+	}
+
+	return out, nil
+}
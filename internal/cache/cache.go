@@ -0,0 +1,258 @@
+package cache
+
+import (
+	"container/heap"
+	"container/list"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+type Policy string
+
+const (
+	PolicyLRU Policy = "lru"
+	PolicyLFU Policy = "lfu"
+)
+
+var ErrTooLarge = errors.New("entry exceeds the cache capacity")
+
+type Stats struct {
+	Keys      int64
+	Bytes     int64
+	Evictions uint64
+}
+
+type entry struct {
+	key       string
+	size      int64
+	hits      uint64
+	lastTouch uint64
+	element   *list.Element
+	index     int
+}
+
+type evictionPolicy interface {
+	add(e *entry)
+	touch(e *entry)
+	remove(e *entry)
+	victim() *entry
+}
+
+// Tracker keeps access metadata for cached keys in memory and decides which
+// keys to evict once the configured key or byte budget is exceeded. It never
+// touches the database itself, callers delete the keys it hands back. Only
+// plain values are tracked, collections and queues are not counted against
+// the budget and never evicted.
+type Tracker struct {
+	mu        sync.Mutex
+	maxBytes  int64
+	maxKeys   int64
+	bytes     int64
+	clock     uint64
+	evictions uint64
+	entries   map[string]*entry
+	policy    evictionPolicy
+}
+
+func NewTracker(policy Policy, maxBytes int64, maxKeys int64) (*Tracker, error) {
+	t := &Tracker{
+		maxBytes: maxBytes,
+		maxKeys:  maxKeys,
+		entries:  make(map[string]*entry),
+	}
+
+	switch policy {
+	case PolicyLRU:
+		t.policy = &lruPolicy{order: list.New()}
+	case PolicyLFU:
+		t.policy = &lfuPolicy{}
+	default:
+		return nil, fmt.Errorf("unknown eviction policy: %s", policy)
+	}
+
+	return t, nil
+}
+
+func (t *Tracker) Fits(size int64) bool {
+	return t.maxBytes <= 0 || size <= t.maxBytes
+}
+
+// Admit records a write of key with the given size and returns the keys that
+// have to be evicted to bring the cache back within its budget.
+func (t *Tracker) Admit(key string, size int64) ([]string, error) {
+	if !t.Fits(size) {
+		return nil, ErrTooLarge
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.clock++
+
+	e, ok := t.entries[key]
+	if ok {
+		t.bytes += size - e.size
+		e.size = size
+		e.hits++
+		e.lastTouch = t.clock
+		t.policy.touch(e)
+	} else {
+		e = &entry{key: key, size: size, hits: 1, lastTouch: t.clock}
+		t.entries[key] = e
+		t.bytes += size
+		t.policy.add(e)
+	}
+
+	// the admitted key is never its own victim, so it sits out the eviction
+	t.policy.remove(e)
+	defer t.policy.add(e)
+
+	var victims []string
+	for t.overBudget() {
+		victim := t.policy.victim()
+		if victim == nil {
+			break
+		}
+
+		t.removeEntry(victim)
+		t.evictions++
+		victims = append(victims, victim.key)
+	}
+
+	return victims, nil
+}
+
+// Contains reports whether key is tracked, an evicted key that was written
+// again since is tracked anew.
+func (t *Tracker) Contains(key string) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	_, ok := t.entries[key]
+	return ok
+}
+
+func (t *Tracker) Touch(key string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	e, ok := t.entries[key]
+	if !ok {
+		return
+	}
+
+	t.clock++
+	e.hits++
+	e.lastTouch = t.clock
+	t.policy.touch(e)
+}
+
+func (t *Tracker) Remove(key string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if e, ok := t.entries[key]; ok {
+		t.removeEntry(e)
+	}
+}
+
+func (t *Tracker) Stats() Stats {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return Stats{
+		Keys:      int64(len(t.entries)),
+		Bytes:     t.bytes,
+		Evictions: t.evictions,
+	}
+}
+
+func (t *Tracker) overBudget() bool {
+	return (t.maxKeys > 0 && int64(len(t.entries)) > t.maxKeys) ||
+		(t.maxBytes > 0 && t.bytes > t.maxBytes)
+}
+
+func (t *Tracker) removeEntry(e *entry) {
+	t.policy.remove(e)
+	delete(t.entries, e.key)
+	t.bytes -= e.size
+}
+
+type lruPolicy struct {
+	order *list.List
+}
+
+func (p *lruPolicy) add(e *entry) {
+	e.element = p.order.PushFront(e)
+}
+
+func (p *lruPolicy) touch(e *entry) {
+	p.order.MoveToFront(e.element)
+}
+
+func (p *lruPolicy) remove(e *entry) {
+	p.order.Remove(e.element)
+}
+
+func (p *lruPolicy) victim() *entry {
+	back := p.order.Back()
+	if back == nil {
+		return nil
+	}
+
+	return back.Value.(*entry)
+}
+
+// lfuPolicy evicts the least frequently used key, breaking ties by recency.
+type lfuPolicy struct {
+	entries []*entry
+}
+
+func (p *lfuPolicy) Len() int { return len(p.entries) }
+
+func (p *lfuPolicy) Less(i, j int) bool {
+	if p.entries[i].hits != p.entries[j].hits {
+		return p.entries[i].hits < p.entries[j].hits
+	}
+	return p.entries[i].lastTouch < p.entries[j].lastTouch
+}
+
+func (p *lfuPolicy) Swap(i, j int) {
+	p.entries[i], p.entries[j] = p.entries[j], p.entries[i]
+	p.entries[i].index = i
+	p.entries[j].index = j
+}
+
+func (p *lfuPolicy) Push(x any) {
+	e := x.(*entry)
+	e.index = len(p.entries)
+	p.entries = append(p.entries, e)
+}
+
+func (p *lfuPolicy) Pop() any {
+	last := p.entries[len(p.entries)-1]
+	p.entries[len(p.entries)-1] = nil
+	p.entries = p.entries[:len(p.entries)-1]
+	return last
+}
+
+func (p *lfuPolicy) add(e *entry) {
+	heap.Push(p, e)
+}
+
+func (p *lfuPolicy) touch(e *entry) {
+	heap.Fix(p, e.index)
+}
+
+func (p *lfuPolicy) remove(e *entry) {
+	heap.Remove(p, e.index)
+}
+
+func (p *lfuPolicy) victim() *entry {
+	if len(p.entries) == 0 {
+		return nil
+	}
+
+	return p.entries[0]
+}
@@ -4,21 +4,98 @@ import (
 	"errors"
 	"fmt"
 	"regexp"
+	"time"
 
 	"github.com/rs/zerolog/log"
 	"github.com/spf13/viper"
+	"github.com/thenonexistent/nilis/pkg/sharding"
+)
+
+const (
+	ModeDatabase = "database"
+	ModeCache    = "cache"
+
+	OwnershipStrict  = "strict"
+	OwnershipLenient = "lenient"
+
+	ReplicaWritesReject  = "reject"
+	ReplicaWritesForward = "forward"
+
+	OrphansHandOff = "handoff"
+	OrphansDelete  = "delete"
 )
 
 var defaults = map[string]any{
 	"server.listen_port":       6226,
 	"server.bind_address":      "0.0.0.0",
 	"server.database_location": "/opt/nilis/local.db",
+	"server.data_directory":    "",
+	"server.stripes":           1,
 	"server.use_tls":           false,
+	"server.mode":              "database",
+
+	"cache.max_bytes":       0,
+	"cache.max_keys":        0,
+	"cache.eviction_policy": "lru",
+	"cache.emit_events":     false,
+
+	"sharding.enabled":   false,
+	"sharding.shard_id":  0,
+	"sharding.shard_ids": []int{},
+	"sharding.replica":   false,
+	"sharding.shards":    []map[string]any{},
+
+	"sharding.partitioner":   "modulo",
+	"sharding.hash_function": "fnv64",
+	"sharding.virtual_nodes": 128,
+	"sharding.hash_tags":     false,
+
+	"sharding.forward_requests":       true,
+	"sharding.ownership":              "strict",
+	"sharding.replica_writes":         "reject",
+	"sharding.fanout_concurrency":     8,
+	"sharding.topology_sync_interval": "10s",
+	"sharding.handshake_timeout":      "30s",
 
-	"sharding.enabled":  false,
-	"sharding.shard_id": 0,
-	"sharding.replica":  false,
-	"sharding.shards":   []map[string]any{},
+	"pool.failure_threshold":     5,
+	"pool.cooldown":              "10s",
+	"pool.health_check_interval": "5s",
+	"pool.health_check_timeout":  "1s",
+
+	"orphans.enabled":  false,
+	"orphans.interval": "1h",
+	"orphans.mode":     "handoff",
+	"orphans.dry_run":  true,
+
+	"gossip.enabled":           true,
+	"gossip.probe_interval":    "1s",
+	"gossip.probe_timeout":     "300ms",
+	"gossip.indirect_probes":   3,
+	"gossip.suspicion_timeout": "5s",
+
+	"hot_keys.enabled":      false,
+	"hot_keys.sample_rate":  0.01,
+	"hot_keys.capacity":     1000,
+	"hot_keys.window":       "1m",
+	"hot_keys.buckets":      6,
+	"hot_keys.log_interval": "1m",
+	"hot_keys.log_top":      10,
+
+	"replication.enabled":        true,
+	"replication.batch_size":     500,
+	"replication.max_changes":    1000000,
+	"replication.trim_interval":  "10s",
+	"replication.retry_interval": "1s",
+
+	"sessions.default_heartbeat_interval": "5s",
+	"sessions.min_heartbeat_interval":     "500ms",
+	"sessions.max_heartbeat_interval":     "5m",
+	"sessions.max_missed_heartbeats":      3,
+
+	"queues.default_visibility_timeout": "30s",
+	"queues.max_visibility_timeout":     "12h",
+	"queues.max_deliveries":             5,
+	"queues.dead_letter_suffix":         ".dlq",
 
 	"logging.level": "info",
 	"logging.file":  "/var/log/nilis.log",
@@ -29,23 +106,99 @@ type Config struct {
 		ListenPort       int    `mapstructure:"listen_port"`
 		BindAddress      string `mapstructure:"bind_address"`
 		DatabaseLocation string `mapstructure:"database_location"`
+		DataDirectory    string `mapstructure:"data_directory"`
+		Stripes          int    `mapstructure:"stripes"`
 		UseTLS           bool   `mapstructure:"use_tls"`
 		TLSCert          string `mapstructure:"tls_cert"`
 		TLSKey           string `mapstructure:"tls_key"`
 		TLSCA            string `mapstructure:"tls_ca"`
+		Mode             string `mapstructure:"mode"`
 	} `mapstructure:"server"`
 
+	Cache struct {
+		MaxBytes       int64  `mapstructure:"max_bytes"`
+		MaxKeys        int64  `mapstructure:"max_keys"`
+		EvictionPolicy string `mapstructure:"eviction_policy"`
+		EmitEvents     bool   `mapstructure:"emit_events"`
+	} `mapstructure:"cache"`
+
 	Sharding struct {
-		Enabled bool `mapstructure:"enabled"`
-		ShardID int  `mapstructure:"shard_id"`
-		Replica bool `mapstructure:"replica"`
-		Shards  []struct {
+		Enabled              bool          `mapstructure:"enabled"`
+		ShardID              int           `mapstructure:"shard_id"`
+		ShardIDs             []int         `mapstructure:"shard_ids"`
+		Replica              bool          `mapstructure:"replica"`
+		Partitioner          string        `mapstructure:"partitioner"`
+		HashFunction         string        `mapstructure:"hash_function"`
+		VirtualNodes         int           `mapstructure:"virtual_nodes"`
+		HashTags             bool          `mapstructure:"hash_tags"`
+		ForwardRequests      bool          `mapstructure:"forward_requests"`
+		Ownership            string        `mapstructure:"ownership"`
+		ReplicaWrites        string        `mapstructure:"replica_writes"`
+		FanoutConcurrency    int           `mapstructure:"fanout_concurrency"`
+		TopologySyncInterval time.Duration `mapstructure:"topology_sync_interval"`
+		HandshakeTimeout     time.Duration `mapstructure:"handshake_timeout"`
+		Shards               []struct {
 			ID       int      `mapstructure:"id"`
 			Address  string   `mapstructure:"address"`
 			Replicas []string `mapstructure:"replicas"`
+			Weight   int      `mapstructure:"weight"`
 		} `mapstructure:"shards"`
 	} `mapstructure:"sharding"`
 
+	Pool struct {
+		FailureThreshold    int           `mapstructure:"failure_threshold"`
+		Cooldown            time.Duration `mapstructure:"cooldown"`
+		HealthCheckInterval time.Duration `mapstructure:"health_check_interval"`
+		HealthCheckTimeout  time.Duration `mapstructure:"health_check_timeout"`
+	} `mapstructure:"pool"`
+
+	Orphans struct {
+		Enabled  bool          `mapstructure:"enabled"`
+		Interval time.Duration `mapstructure:"interval"`
+		Mode     string        `mapstructure:"mode"`
+		DryRun   bool          `mapstructure:"dry_run"`
+	} `mapstructure:"orphans"`
+
+	Gossip struct {
+		Enabled          bool          `mapstructure:"enabled"`
+		ProbeInterval    time.Duration `mapstructure:"probe_interval"`
+		ProbeTimeout     time.Duration `mapstructure:"probe_timeout"`
+		IndirectProbes   int           `mapstructure:"indirect_probes"`
+		SuspicionTimeout time.Duration `mapstructure:"suspicion_timeout"`
+	} `mapstructure:"gossip"`
+
+	HotKeys struct {
+		Enabled     bool          `mapstructure:"enabled"`
+		SampleRate  float64       `mapstructure:"sample_rate"`
+		Capacity    int           `mapstructure:"capacity"`
+		Window      time.Duration `mapstructure:"window"`
+		Buckets     int           `mapstructure:"buckets"`
+		LogInterval time.Duration `mapstructure:"log_interval"`
+		LogTop      int           `mapstructure:"log_top"`
+	} `mapstructure:"hot_keys"`
+
+	Replication struct {
+		Enabled       bool          `mapstructure:"enabled"`
+		BatchSize     int           `mapstructure:"batch_size"`
+		MaxChanges    uint64        `mapstructure:"max_changes"`
+		TrimInterval  time.Duration `mapstructure:"trim_interval"`
+		RetryInterval time.Duration `mapstructure:"retry_interval"`
+	} `mapstructure:"replication"`
+
+	Sessions struct {
+		DefaultHeartbeatInterval time.Duration `mapstructure:"default_heartbeat_interval"`
+		MinHeartbeatInterval     time.Duration `mapstructure:"min_heartbeat_interval"`
+		MaxHeartbeatInterval     time.Duration `mapstructure:"max_heartbeat_interval"`
+		MaxMissedHeartbeats      int           `mapstructure:"max_missed_heartbeats"`
+	} `mapstructure:"sessions"`
+
+	Queues struct {
+		DefaultVisibilityTimeout time.Duration `mapstructure:"default_visibility_timeout"`
+		MaxVisibilityTimeout     time.Duration `mapstructure:"max_visibility_timeout"`
+		MaxDeliveries            int           `mapstructure:"max_deliveries"`
+		DeadLetterSuffix         string        `mapstructure:"dead_letter_suffix"`
+	} `mapstructure:"queues"`
+
 	Logging struct {
 		Level string `mapstructure:"level"`
 		File  string `mapstructure:"file"`
@@ -53,16 +206,11 @@ type Config struct {
 }
 
 func LoadConfig(config *Config) error {
-	v := viper.New()
+	v := newViper()
 	v.SetConfigName("nilis")
-	v.SetConfigType("yaml")
 	v.AddConfigPath("/etc/nilis")
 	v.AddConfigPath(".")
 
-	for key, value := range defaults {
-		v.SetDefault(key, value)
-	}
-
 	if err := v.ReadInConfig(); err != nil {
 		log.Warn().Err(err).Str("module", "configuration").Msg("could not read config file, using defaults...")
 	}
@@ -74,6 +222,89 @@ func LoadConfig(config *Config) error {
 	return nil
 }
 
+// validateLocalShards makes sure every shard has exactly one owner, all
+// shards served by this node share its address and no other shard does.
+func validateLocalShards(config *Config, shardAddresses map[string][]int) error {
+	local := LocalShardIDs(config)
+	if len(local) > 1 && config.Server.DataDirectory == "" {
+		return errors.New("data directory cannot be empty when serving several shards")
+	}
+
+	address := ""
+	served := make(map[int]struct{})
+	for _, id := range local {
+		if id < 0 {
+			return fmt.Errorf("shard_ids must be non-negative, got: %d", id)
+		}
+		if _, exists := served[id]; exists {
+			return fmt.Errorf("duplicate local shard id found: %d", id)
+		}
+		served[id] = struct{}{}
+
+		shardAddress := ""
+		for _, shard := range config.Sharding.Shards {
+			if shard.ID == id {
+				shardAddress = shard.Address
+			}
+		}
+
+		// unknown shard ids are left to the server, which refuses to start,
+		// tools only reading the shard list never set them
+		if shardAddress == "" {
+			continue
+		}
+		if address != "" && shardAddress != address {
+			return fmt.Errorf("local shards must share one address, shard %d is at %s instead of %s", id, shardAddress, address)
+		}
+		address = shardAddress
+	}
+
+	for _, id := range shardAddresses[address] {
+		if _, ok := served[id]; !ok {
+			return fmt.Errorf("shard %d is at this node's address %s but not listed in shard_ids", id, address)
+		}
+	}
+
+	return nil
+}
+
+// validateReplica makes sure a replica follows exactly one shard and can tell
+// which of its replica addresses it is.
+func validateReplica(config *Config) error {
+	if len(LocalShardIDs(config)) != 1 {
+		return errors.New("a replica follows exactly one shard")
+	}
+
+	_, err := ReplicaAddress(config)
+	return err
+}
+
+func LoadConfigFile(path string, config *Config) error {
+	v := newViper()
+	v.SetConfigFile(path)
+
+	if err := v.ReadInConfig(); err != nil {
+		return fmt.Errorf("error reading config file %s: %w", path, err)
+	}
+
+	if err := v.Unmarshal(config); err != nil {
+		return fmt.Errorf("error unmarshaling config file %s: %w", path, err)
+	}
+
+	return nil
+}
+
+func newViper() *viper.Viper {
+	v := viper.New()
+	v.SetConfigType("yaml")
+
+	for key, value := range defaults {
+		v.SetDefault(key, value)
+	}
+
+	return v
+}
+
 func ValidateConfig(config *Config) error {
 	if config.Server.ListenPort <= 0 || config.Server.ListenPort > 65535 {
 		return fmt.Errorf("invalid listen port: %d", config.Server.ListenPort)
@@ -81,8 +312,11 @@ func ValidateConfig(config *Config) error {
 	if config.Server.BindAddress == "" {
 		return errors.New("bind address cannot be empty")
 	}
-	if config.Server.DatabaseLocation == "" {
-		return errors.New("database location cannot be empty")
+	if config.Server.DatabaseLocation == "" && config.Server.DataDirectory == "" {
+		return errors.New("database location and data directory cannot both be empty")
+	}
+	if config.Server.Stripes <= 0 {
+		return fmt.Errorf("stripes must be positive, got: %d", config.Server.Stripes)
 	}
 
 	if config.Server.UseTLS && config.Server.TLSCert == "" {
@@ -97,6 +331,77 @@ func ValidateConfig(config *Config) error {
 		return errors.New("tls ca certificate location cannot be empty when using tls mode")
 	}
 
+	switch config.Server.Mode {
+	case ModeDatabase:
+	case ModeCache:
+		if config.Cache.MaxBytes <= 0 && config.Cache.MaxKeys <= 0 {
+			return errors.New("cache mode requires max_bytes or max_keys to be set")
+		}
+		if config.Cache.MaxBytes < 0 || config.Cache.MaxKeys < 0 {
+			return errors.New("cache max_bytes and max_keys cannot be negative")
+		}
+		if config.Cache.EvictionPolicy != "lru" && config.Cache.EvictionPolicy != "lfu" {
+			return fmt.Errorf("unknown cache eviction policy: %s", config.Cache.EvictionPolicy)
+		}
+	default:
+		return fmt.Errorf("unknown server mode: %s", config.Server.Mode)
+	}
+
+	if config.HotKeys.Enabled {
+		if config.HotKeys.SampleRate <= 0 || config.HotKeys.SampleRate > 1 {
+			return fmt.Errorf("hot key sample rate must be in (0, 1], got: %g", config.HotKeys.SampleRate)
+		}
+		if config.HotKeys.Capacity <= 0 {
+			return fmt.Errorf("hot key capacity must be positive, got: %d", config.HotKeys.Capacity)
+		}
+		if config.HotKeys.Buckets <= 0 || config.HotKeys.Window < time.Duration(config.HotKeys.Buckets) {
+			return errors.New("hot key window must be positive and split into a positive number of buckets")
+		}
+		if config.HotKeys.LogInterval <= 0 || config.HotKeys.LogTop <= 0 {
+			return errors.New("hot key log interval and log top must be positive")
+		}
+	}
+
+	if config.Replication.Enabled {
+		if config.Replication.BatchSize <= 0 {
+			return fmt.Errorf("replication batch size must be positive, got: %d", config.Replication.BatchSize)
+		}
+		if config.Replication.MaxChanges == 0 {
+			return errors.New("replication max changes must be positive")
+		}
+		if config.Replication.TrimInterval <= 0 || config.Replication.RetryInterval <= 0 {
+			return errors.New("replication trim and retry intervals must be positive")
+		}
+	}
+
+	if config.Sessions.MinHeartbeatInterval <= 0 {
+		return errors.New("minimum session heartbeat interval must be positive")
+	}
+	if config.Sessions.MaxHeartbeatInterval < config.Sessions.MinHeartbeatInterval {
+		return errors.New("maximum session heartbeat interval cannot be less than the minimum")
+	}
+	if config.Sessions.DefaultHeartbeatInterval < config.Sessions.MinHeartbeatInterval ||
+		config.Sessions.DefaultHeartbeatInterval > config.Sessions.MaxHeartbeatInterval {
+		return fmt.Errorf("default session heartbeat interval must be between %s and %s",
+			config.Sessions.MinHeartbeatInterval, config.Sessions.MaxHeartbeatInterval)
+	}
+	if config.Sessions.MaxMissedHeartbeats <= 0 {
+		return fmt.Errorf("max missed heartbeats must be positive, got: %d", config.Sessions.MaxMissedHeartbeats)
+	}
+
+	if config.Queues.DefaultVisibilityTimeout <= 0 {
+		return errors.New("default queue visibility timeout must be positive")
+	}
+	if config.Queues.MaxVisibilityTimeout < config.Queues.DefaultVisibilityTimeout {
+		return errors.New("maximum queue visibility timeout cannot be less than the default")
+	}
+	if config.Queues.MaxDeliveries < 0 {
+		return fmt.Errorf("queue max deliveries cannot be negative, got: %d", config.Queues.MaxDeliveries)
+	}
+	if config.Queues.MaxDeliveries > 0 && config.Queues.DeadLetterSuffix == "" {
+		return errors.New("dead letter suffix cannot be empty when max deliveries is set")
+	}
+
 	if config.Logging.Level == "" {
 		return errors.New("logging level cannot be empty")
 	}
@@ -104,23 +409,30 @@ func ValidateConfig(config *Config) error {
 		return errors.New("logging file path cannot be empty")
 	}
 
+	if config.Sharding.Replica && !config.Sharding.Enabled {
+		return errors.New("replica requires sharding to be enabled")
+	}
+
 	if config.Sharding.Enabled {
 		if config.Sharding.ShardID < 0 {
 			return fmt.Errorf("shard_id must be non-negative")
 		}
 
 		shardIDs := make(map[int]struct{})
-		shardAddresses := make(map[string]struct{})
+		shardAddresses := make(map[string][]int)
 		replicaAddresses := make(map[string]struct{})
 
 		for _, shard := range config.Sharding.Shards {
 			if shard.ID < 0 {
 				return fmt.Errorf("shard id must be non-negative: %d", shard.ID)
 			}
+			if shard.Weight < 0 {
+				return fmt.Errorf("shard weight must be non-negative for shard id: %d", shard.ID)
+			}
 			if shard.Address == "" {
 				return fmt.Errorf("shard address cannot be empty for shard id: %d", shard.ID)
 			}
-			if !isValidAddressFormat(shard.Address) {
+			if !IsValidAddressFormat(shard.Address) {
 				return fmt.Errorf("shard address does not follow ip:port format for shard id: %d", shard.ID)
 			}
 
@@ -129,16 +441,13 @@ func ValidateConfig(config *Config) error {
 			}
 			shardIDs[shard.ID] = struct{}{}
 
-			if _, exists := shardAddresses[shard.Address]; exists {
-				return fmt.Errorf("duplicate shard address found: %s", shard.Address)
-			}
-			shardAddresses[shard.Address] = struct{}{}
+			shardAddresses[shard.Address] = append(shardAddresses[shard.Address], shard.ID)
 
 			for _, replica := range shard.Replicas {
 				if replica == "" {
 					return fmt.Errorf("replica address cannot be empty for shard id: %d", shard.ID)
 				}
-				if !isValidAddressFormat(replica) {
+				if !IsValidAddressFormat(replica) {
 					return fmt.Errorf("replica address does not follow ip:port format for shard id: %d", shard.ID)
 				}
 
@@ -149,9 +458,87 @@ func ValidateConfig(config *Config) error {
 			}
 		}
 
+		if config.Sharding.Replica {
+			if err := validateReplica(config); err != nil {
+				return err
+			}
+		} else if err := validateLocalShards(config, shardAddresses); err != nil {
+			return err
+		}
+
 		numShards := len(config.Sharding.Shards)
-		if numShards == 0 || !isPowerOfTwo(numShards) {
-			return fmt.Errorf("number of shards must be a power of 2, got: %d", numShards)
+		switch config.Sharding.Partitioner {
+		case sharding.StrategyModulo:
+			if numShards == 0 || !isPowerOfTwo(numShards) {
+				return fmt.Errorf("number of shards must be a power of 2, got: %d", numShards)
+			}
+			for id := range shardIDs {
+				if id >= numShards {
+					return fmt.Errorf("modulo partitioner requires shard ids 0 to %d, got: %d", numShards-1, id)
+				}
+			}
+		case sharding.StrategyRing, sharding.StrategyRendezvous, sharding.StrategyJump:
+			if numShards == 0 {
+				return errors.New("at least one shard is required")
+			}
+			if config.Sharding.VirtualNodes <= 0 {
+				return fmt.Errorf("virtual nodes must be positive, got: %d", config.Sharding.VirtualNodes)
+			}
+		default:
+			return fmt.Errorf("unknown partitioner strategy: %s", config.Sharding.Partitioner)
+		}
+
+		if _, err := sharding.HashFunctionByName(config.Sharding.HashFunction); err != nil {
+			return err
+		}
+
+		if config.Sharding.FanoutConcurrency <= 0 {
+			return fmt.Errorf("fanout concurrency must be positive, got: %d", config.Sharding.FanoutConcurrency)
+		}
+
+		if config.Sharding.Ownership != OwnershipStrict && config.Sharding.Ownership != OwnershipLenient {
+			return fmt.Errorf("ownership mode must be %s or %s, got: %s", OwnershipStrict, OwnershipLenient, config.Sharding.Ownership)
+		}
+
+		if config.Sharding.ReplicaWrites != ReplicaWritesReject && config.Sharding.ReplicaWrites != ReplicaWritesForward {
+			return fmt.Errorf("replica writes must be %s or %s, got: %s", ReplicaWritesReject, ReplicaWritesForward, config.Sharding.ReplicaWrites)
+		}
+
+		if config.Sharding.TopologySyncInterval <= 0 {
+			return errors.New("topology sync interval must be positive")
+		}
+
+		if config.Sharding.HandshakeTimeout <= 0 {
+			return errors.New("handshake timeout must be positive")
+		}
+
+		if config.Orphans.Mode != OrphansHandOff && config.Orphans.Mode != OrphansDelete {
+			return fmt.Errorf("orphan cleanup mode must be %s or %s, got: %s", OrphansHandOff, OrphansDelete, config.Orphans.Mode)
+		}
+		if config.Orphans.Enabled && config.Orphans.Interval <= 0 {
+			return errors.New("orphan cleanup interval must be positive")
+		}
+
+		if config.Pool.FailureThreshold <= 0 {
+			return errors.New("pool failure threshold must be positive")
+		}
+		if config.Pool.Cooldown <= 0 {
+			return errors.New("pool cooldown must be positive")
+		}
+		if config.Pool.HealthCheckTimeout <= 0 || config.Pool.HealthCheckInterval <= config.Pool.HealthCheckTimeout {
+			return errors.New("pool health check timeout must be positive and shorter than the health check interval")
+		}
+
+		if config.Gossip.Enabled {
+			if config.Gossip.ProbeTimeout <= 0 || config.Gossip.ProbeInterval <= config.Gossip.ProbeTimeout {
+				return errors.New("gossip probe timeout must be positive and shorter than the probe interval")
+			}
+			if config.Gossip.IndirectProbes < 0 {
+				return errors.New("gossip indirect probes cannot be negative")
+			}
+			if config.Gossip.SuspicionTimeout < config.Gossip.ProbeInterval {
+				return errors.New("gossip suspicion timeout cannot be shorter than the probe interval")
+			}
 		}
 	}
 
@@ -162,7 +549,8 @@ func isPowerOfTwo(n int) bool {
 	return n > 0 && (n&(n-1)) == 0
 }
 
-func isValidAddressFormat(address string) bool {
+// IsValidAddressFormat reports whether address is an ip:port pair.
+func IsValidAddressFormat(address string) bool {
 	addressRegexp := regexp.MustCompile(`\b(?:(?:25[0-5]|2[0-4][0-9]|[01]?[0-9][0-9]?)\.){3}(?:25[0-5]|2[0-4][0-9]|[01]?[0-9][0-9]?):\d{1,5}\b`)
 
 	return addressRegexp.MatchString(address)
@@ -0,0 +1,105 @@
+package config
+
+import (
+	"fmt"
+	"net"
+	"path/filepath"
+	"strconv"
+
+	"github.com/thenonexistent/nilis/pkg/sharding"
+)
+
+func CreateShards(config *Config) []sharding.Shard {
+	shards := make([]sharding.Shard, 0, len(config.Sharding.Shards))
+	for _, cfgShard := range config.Sharding.Shards {
+		replicas := make([]sharding.Replica, 0, len(cfgShard.Replicas))
+
+		for _, replicaAddress := range cfgShard.Replicas {
+			replicas = append(replicas, sharding.Replica{
+				Address: replicaAddress,
+			})
+		}
+
+		weight := cfgShard.Weight
+		if weight == 0 {
+			weight = 1
+		}
+
+		shards = append(shards, sharding.Shard{
+			ID:       cfgShard.ID,
+			Address:  cfgShard.Address,
+			Replicas: replicas,
+			Weight:   weight,
+		})
+	}
+
+	return shards
+}
+
+func PartitionerSettings(config *Config) sharding.PartitionerSettings {
+	return sharding.PartitionerSettings{
+		Strategy:     config.Sharding.Partitioner,
+		HashFunction: config.Sharding.HashFunction,
+		VirtualNodes: config.Sharding.VirtualNodes,
+		HashTags:     config.Sharding.HashTags,
+	}
+}
+
+func CreatePartitioner(config *Config, shards []sharding.Shard) (sharding.Partitioner, error) {
+	return sharding.NewPartitioner(PartitionerSettings(config), shards)
+}
+
+// LocalShardIDs returns the shards served by this node, shard_ids when it is
+// set and shard_id otherwise.
+func LocalShardIDs(config *Config) []int {
+	if len(config.Sharding.ShardIDs) > 0 {
+		return config.Sharding.ShardIDs
+	}
+
+	return []int{config.Sharding.ShardID}
+}
+
+// ReplicaAddress returns the address of this node among the replicas of its
+// shard, the one listening on its port, and on its bind address unless it
+// binds to every interface.
+func ReplicaAddress(config *Config) (string, error) {
+	shardID := LocalShardIDs(config)[0]
+
+	for _, shard := range config.Sharding.Shards {
+		if shard.ID != shardID {
+			continue
+		}
+
+		var matches []string
+		for _, replica := range shard.Replicas {
+			host, port, err := net.SplitHostPort(replica)
+			if err != nil || port != strconv.Itoa(config.Server.ListenPort) {
+				continue
+			}
+			if host == config.Server.BindAddress || net.ParseIP(config.Server.BindAddress).IsUnspecified() {
+				matches = append(matches, replica)
+			}
+		}
+
+		switch len(matches) {
+		case 0:
+			return "", fmt.Errorf("no replica of shard %d listens on %s:%d", shardID, config.Server.BindAddress, config.Server.ListenPort)
+		case 1:
+			return matches[0], nil
+		default:
+			return "", fmt.Errorf("several replicas of shard %d match port %d, bind to the replica address instead", shardID, config.Server.ListenPort)
+		}
+	}
+
+	return "", fmt.Errorf("replica follows unknown shard %d", shardID)
+}
+
+// DatabaseLocation returns the bbolt file of a local shard, every shard gets
+// its own file once a data directory is configured.
+func DatabaseLocation(config *Config, shardID int) string {
+	if config.Server.DataDirectory == "" {
+		return config.Server.DatabaseLocation
+	}
+
+	return filepath.Join(config.Server.DataDirectory, fmt.Sprintf("shard-%d.db", shardID))
+}
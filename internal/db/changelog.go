@@ -0,0 +1,768 @@
+package db
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"sync"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+const (
+	changelogBucketName = "changelog"
+
+	changelogIDKey      = "changelog_id"
+	changelogTrimmedKey = "changelog_trimmed"
+
+	trimBatchSize = 10000
+)
+
+var (
+	ErrChangelogDisabled = errors.New("changelog is disabled")
+	ErrChangesTrimmed    = errors.New("changes were trimmed from the changelog")
+)
+
+// Change is the state of a top level key of a namespace after a committed
+// write, or of a single field of it when Field is set, a queue message or a
+// collection member. Entry is nil when the key or field no longer exists.
+// Applying changes in sequence order reproduces the database, and applying
+// one again is harmless.
+type Change struct {
+	Sequence  uint64
+	Namespace string
+	Key       []byte
+	Field     []byte
+	Entry     *Entry
+	// BucketSequence is the sequence of the bucket of Key when Field is set.
+	BucketSequence uint64
+	// Collection is the type of the collection Key holds when Field is a
+	// member of it, TypeNone once the collection is gone.
+	Collection ValueType
+}
+
+// changelog numbers the changes of every stripe in one sequence. Sequence
+// numbers are taken inside the write transaction, so transactions of
+// different stripes commit out of order, changes are only read up to the
+// last sequence below every transaction still in flight.
+type changelog struct {
+	id string
+
+	mu        sync.Mutex
+	last      uint64
+	trimmed   uint64
+	pending   map[uint64]struct{}
+	committed chan struct{}
+}
+
+// OpenChangelog continues the sequence recorded in the stripes, writes may
+// run meanwhile. A database opened without a changelog drops its id, as
+// writes made meanwhile are not recorded and readers of the old changelog
+// must start over. Opening an open changelog does nothing.
+func (db *Database) OpenChangelog(enabled bool) error {
+	db.changelogMu.Lock()
+	defer db.changelogMu.Unlock()
+
+	if db.changelog.Load() != nil {
+		return nil
+	}
+
+	if err := db.createBucket(changelogBucketName); err != nil {
+		return err
+	}
+
+	if !enabled {
+		return db.DeleteSystemValue(changelogIDKey)
+	}
+
+	c := &changelog{
+		pending:   make(map[uint64]struct{}),
+		committed: make(chan struct{}),
+	}
+
+	for _, stripe := range db.stripes {
+		err := stripe.View(func(tx *bolt.Tx) error {
+			c.last = max(c.last, tx.Bucket([]byte(changelogBucketName)).Sequence())
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	raw, err := db.GetSystemValue(changelogTrimmedKey)
+	if err != nil {
+		return err
+	}
+	if len(raw) == 8 {
+		c.trimmed = binary.BigEndian.Uint64(raw)
+	}
+
+	id, err := db.GetSystemValue(changelogIDKey)
+	if err != nil {
+		return err
+	}
+	if id == nil {
+		random := make([]byte, 16)
+		if _, err := rand.Read(random); err != nil {
+			return err
+		}
+		id = []byte(hex.EncodeToString(random))
+
+		if err := db.SetSystemValue(changelogIDKey, id); err != nil {
+			return err
+		}
+	}
+	c.id = string(id)
+
+	// no write records changes before this point, so the sequence read above
+	// is still the last one
+	db.writers.Lock()
+	db.changelog.Store(c)
+	db.writers.Unlock()
+
+	return nil
+}
+
+func (c *changelog) reserve(count int) uint64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	first := c.last + 1
+	c.last += uint64(count)
+	c.pending[first] = struct{}{}
+
+	return first
+}
+
+func (c *changelog) release(first uint64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	delete(c.pending, first)
+	close(c.committed)
+	c.committed = make(chan struct{})
+}
+
+// readable returns the last sequence every change up to has committed, and a
+// channel closed on the next commit.
+func (c *changelog) readable() (uint64, <-chan struct{}) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	last := c.last
+	for first := range c.pending {
+		last = min(last, first-1)
+	}
+
+	return last, c.committed
+}
+
+// changeSet collects what a write transaction touched, a nil set records
+// nothing.
+type changeSet struct {
+	touched []changedKey
+	seen    map[string]struct{}
+}
+
+type changedKey struct {
+	namespace string
+	key       []byte
+	field     []byte
+}
+
+func (c *changeSet) touch(namespace string, key []byte) {
+	c.touchField(namespace, key, nil)
+}
+
+func (c *changeSet) touchField(namespace string, key []byte, field []byte) {
+	if c == nil {
+		return
+	}
+
+	id := namespace + "\x00" + strconv.Itoa(len(key)) + "\x00" + string(key)
+	if field != nil {
+		id += "\x01" + string(field)
+	}
+	if _, ok := c.seen[id]; ok {
+		return
+	}
+
+	if c.seen == nil {
+		c.seen = make(map[string]struct{})
+	}
+	c.seen[id] = struct{}{}
+	c.touched = append(c.touched, changedKey{namespace: namespace, key: bytes.Clone(key), field: bytes.Clone(field)})
+}
+
+// write runs a write transaction on a stripe and records the state of what
+// fn touched in the changelog within the same transaction.
+func (db *Database) write(stripe *bolt.DB, fn func(tx *bolt.Tx, changes *changeSet) error) error {
+	db.writers.RLock()
+	defer db.writers.RUnlock()
+
+	c := db.changelog.Load()
+	if c == nil {
+		return stripe.Update(func(tx *bolt.Tx) error {
+			return fn(tx, nil)
+		})
+	}
+
+	var first uint64
+	err := stripe.Update(func(tx *bolt.Tx) error {
+		changes := &changeSet{}
+		if err := fn(tx, changes); err != nil {
+			return err
+		}
+		if len(changes.touched) == 0 {
+			return nil
+		}
+
+		first = c.reserve(len(changes.touched))
+		return recordChanges(tx, first, changes.touched)
+	})
+	if first != 0 {
+		c.release(first)
+	}
+
+	return err
+}
+
+func recordChanges(tx *bolt.Tx, first uint64, touched []changedKey) error {
+	records := tx.Bucket([]byte(changelogBucketName))
+
+	for i, changed := range touched {
+		b, err := namespaceBucket(tx, changed.namespace)
+		if err != nil {
+			return err
+		}
+
+		change := Change{Namespace: changed.namespace, Key: changed.key, Field: changed.field}
+
+		if changed.field == nil {
+			// ephemeral keys are replicated as plain values, the primary
+			// records their deletion when the session ends
+			k, v := b.Cursor().Seek(changed.key)
+			if bytes.Equal(k, changed.key) {
+				entry := exportEntry(b, k, v)
+				change.Entry = &entry
+			}
+		} else if changed.namespace == NamespaceData {
+			if _, valueType := lookupKey(b, changed.key); valueType != TypeNone && valueType != TypeString {
+				change.Collection = valueType
+				if v := b.Bucket(changed.key).Bucket(collectionItemsKey).Get(changed.field); v != nil {
+					change.Entry = &Entry{Key: bytes.Clone(changed.field), Value: bytes.Clone(v)}
+				}
+			}
+		} else if parent := b.Bucket(changed.key); parent != nil {
+			change.BucketSequence = parent.Sequence()
+			if v := parent.Get(changed.field); v != nil {
+				change.Entry = &Entry{Key: changed.field, Value: bytes.Clone(v)}
+			}
+		}
+
+		if err := records.Put(encodeUint64(first+uint64(i)), encodeChange(change)); err != nil {
+			return err
+		}
+	}
+
+	return records.SetSequence(first + uint64(len(touched)) - 1)
+}
+
+// ChangelogID identifies the changelog of this database, a reader holding a
+// position in another changelog has to start over.
+func (db *Database) ChangelogID() string {
+	c := db.changelog.Load()
+	if c == nil {
+		return ""
+	}
+
+	return c.id
+}
+
+// LastSequence returns the sequence of the last readable change.
+func (db *Database) LastSequence() uint64 {
+	c := db.changelog.Load()
+	if c == nil {
+		return 0
+	}
+
+	last, _ := c.readable()
+	return last
+}
+
+// WaitForChanges blocks until a change after the given sequence is readable
+// or ctx is done.
+func (db *Database) WaitForChanges(ctx context.Context, after uint64) error {
+	c := db.changelog.Load()
+	if c == nil {
+		return ErrChangelogDisabled
+	}
+
+	for {
+		last, committed := c.readable()
+		if last > after {
+			return nil
+		}
+
+		select {
+		case <-committed:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// ChangesSince returns up to limit readable changes following the given
+// sequence, in sequence order. It fails with ErrChangesTrimmed once changes
+// following it are no longer kept.
+func (db *Database) ChangesSince(after uint64, limit int) ([]Change, error) {
+	c := db.changelog.Load()
+	if c == nil {
+		return nil, ErrChangelogDisabled
+	}
+
+	last, _ := c.readable()
+	if after > last {
+		return nil, fmt.Errorf("sequence %d is ahead of the changelog at %d: %w", after, last, ErrChangesTrimmed)
+	}
+
+	var changes []Change
+	for _, stripe := range db.stripes {
+		err := stripe.View(func(tx *bolt.Tx) error {
+			cursor := tx.Bucket([]byte(changelogBucketName)).Cursor()
+
+			read := 0
+			for k, v := cursor.Seek(encodeUint64(after + 1)); k != nil && read < limit; k, v = cursor.Next() {
+				sequence := binary.BigEndian.Uint64(k)
+				if sequence > last {
+					break
+				}
+
+				change, err := decodeChange(v)
+				if err != nil {
+					return fmt.Errorf("failed decoding change %d: %w", sequence, err)
+				}
+				change.Sequence = sequence
+
+				changes = append(changes, change)
+				read++
+			}
+
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// checked after reading, trimming raises the mark before deleting
+	c.mu.Lock()
+	trimmed := c.trimmed
+	c.mu.Unlock()
+
+	if after < trimmed {
+		return nil, fmt.Errorf("changes through %d were trimmed: %w", trimmed, ErrChangesTrimmed)
+	}
+
+	sort.Slice(changes, func(i, j int) bool {
+		return changes[i].Sequence < changes[j].Sequence
+	})
+
+	if len(changes) > limit {
+		changes = changes[:limit]
+	}
+
+	return changes, nil
+}
+
+// TrimChanges deletes the changes up to and including through, returning how
+// many were deleted.
+func (db *Database) TrimChanges(through uint64) (int, error) {
+	c := db.changelog.Load()
+	if c == nil {
+		return 0, ErrChangelogDisabled
+	}
+
+	c.mu.Lock()
+	if through <= c.trimmed {
+		c.mu.Unlock()
+		return 0, nil
+	}
+	c.trimmed = through
+	c.mu.Unlock()
+
+	if err := db.SetSystemValue(changelogTrimmedKey, encodeUint64(through)); err != nil {
+		return 0, err
+	}
+
+	deleted := 0
+	for _, stripe := range db.stripes {
+		for {
+			batch := 0
+
+			err := db.update(stripe, func(tx *bolt.Tx) error {
+				cursor := tx.Bucket([]byte(changelogBucketName)).Cursor()
+				for k, _ := cursor.First(); k != nil && batch < trimBatchSize; k, _ = cursor.First() {
+					if binary.BigEndian.Uint64(k) > through {
+						break
+					}
+					if err := cursor.Delete(); err != nil {
+						return err
+					}
+					batch++
+				}
+
+				return nil
+			})
+			deleted += batch
+			if err != nil {
+				return deleted, err
+			}
+
+			if batch < trimBatchSize {
+				break
+			}
+		}
+	}
+
+	return deleted, nil
+}
+
+// ApplyChanges writes changes read from the changelog of another database,
+// in the order given.
+func (db *Database) ApplyChanges(changes []Change) error {
+	for stripe, changes := range groupByStripe(db, changes, func(change Change) string { return string(change.Key) }) {
+		err := db.update(stripe, func(tx *bolt.Tx) error {
+			for _, change := range changes {
+				if err := applyChange(tx, change); err != nil {
+					return fmt.Errorf("failed applying change %d: %w", change.Sequence, err)
+				}
+			}
+
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func applyChange(tx *bolt.Tx, change Change) error {
+	b, err := namespaceBucket(tx, change.Namespace)
+	if err != nil {
+		return err
+	}
+
+	if change.Field != nil && change.Namespace == NamespaceData {
+		return applyMember(tx, change)
+	}
+
+	if change.Field != nil {
+		if change.Entry == nil {
+			if parent := b.Bucket(change.Key); parent != nil {
+				return parent.Delete(change.Field)
+			}
+			return nil
+		}
+
+		parent, err := b.CreateBucketIfNotExists(change.Key)
+		if err != nil {
+			return err
+		}
+		if err := parent.SetSequence(max(parent.Sequence(), change.BucketSequence)); err != nil {
+			return err
+		}
+		return parent.Put(change.Field, change.Entry.Value)
+	}
+
+	if err := deleteEntry(b, change.Key); err != nil {
+		return err
+	}
+
+	if change.Entry == nil {
+		return nil
+	}
+
+	return importEntry(b, *change.Entry)
+}
+
+// applyMember applies the state of a single collection member, keeping the
+// length and the score index of sorted sets in step. The collection is
+// created with the recorded type and dropped with its last member, as it is
+// on the primary.
+func applyMember(tx *bolt.Tx, change Change) error {
+	key := string(change.Key)
+	data := tx.Bucket([]byte(defaultBucketName))
+
+	_, existing := lookupKey(data, change.Key)
+
+	if change.Entry == nil {
+		if existing == TypeNone || existing == TypeString {
+			return nil
+		}
+
+		c, err := openCollection(tx, key, existing)
+		if err != nil {
+			return err
+		}
+
+		previous := c.items.Get(change.Field)
+		if previous == nil {
+			return nil
+		}
+		if c.scores != nil {
+			if err := c.scores.Delete(scoreIndexKey(previous, change.Field)); err != nil {
+				return err
+			}
+		}
+		if err := c.items.Delete(change.Field); err != nil {
+			return err
+		}
+		if err := c.setLength(c.length() - 1); err != nil {
+			return err
+		}
+
+		return dropIfEmpty(tx, key, c)
+	}
+
+	if change.Collection == TypeNone || change.Collection == TypeString {
+		return fmt.Errorf("member of %s recorded without a collection type", key)
+	}
+
+	// a change sent again after a snapshot may find the key holding a later
+	// value of another type, the changes following it restore that value
+	if existing != TypeNone && existing != change.Collection {
+		if err := deleteEntry(data, change.Key); err != nil {
+			return err
+		}
+	}
+
+	c, err := createCollection(tx, key, change.Collection)
+	if err != nil {
+		return err
+	}
+
+	previous := c.items.Get(change.Field)
+	if c.scores != nil {
+		if previous != nil {
+			if err := c.scores.Delete(scoreIndexKey(previous, change.Field)); err != nil {
+				return err
+			}
+		}
+		if err := c.scores.Put(scoreIndexKey(change.Entry.Value, change.Field), []byte{}); err != nil {
+			return err
+		}
+	}
+	if err := c.items.Put(change.Field, change.Entry.Value); err != nil {
+		return err
+	}
+
+	if previous == nil {
+		return c.setLength(c.length() + 1)
+	}
+
+	return nil
+}
+
+// deleteEntry removes a top level key, a plain value or a nested bucket.
+func deleteEntry(b *bolt.Bucket, key []byte) error {
+	k, v := b.Cursor().Seek(key)
+	if !bytes.Equal(k, key) {
+		return nil
+	}
+
+	if v == nil {
+		return b.DeleteBucket(key)
+	}
+
+	return b.Delete(key)
+}
+
+// DropNamespace deletes every entry of a namespace.
+func (db *Database) DropNamespace(namespace string) error {
+	for _, stripe := range db.stripes {
+		err := db.write(stripe, func(tx *bolt.Tx, changes *changeSet) error {
+			b, err := namespaceBucket(tx, namespace)
+			if err != nil {
+				return err
+			}
+
+			var keys [][]byte
+			b.ForEach(func(k, _ []byte) error {
+				keys = append(keys, bytes.Clone(k))
+				return nil
+			})
+
+			for _, key := range keys {
+				changes.touch(namespace, key)
+
+				if b.Bucket(key) != nil {
+					err = b.DeleteBucket(key)
+				} else {
+					err = b.Delete(key)
+				}
+				if err != nil {
+					return err
+				}
+			}
+
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func encodeChange(change Change) []byte {
+	var encoded []byte
+	encoded = appendBytes(encoded, []byte(change.Namespace))
+	encoded = appendBytes(encoded, change.Key)
+	encoded = appendOptional(encoded, change.Field)
+	encoded = binary.AppendUvarint(encoded, change.BucketSequence)
+	encoded = append(encoded, byte(change.Collection))
+
+	if change.Entry == nil {
+		return append(encoded, 0)
+	}
+
+	return appendEntry(append(encoded, 1), *change.Entry)
+}
+
+func appendBytes(encoded []byte, value []byte) []byte {
+	encoded = binary.AppendUvarint(encoded, uint64(len(value)))
+	return append(encoded, value...)
+}
+
+func appendOptional(encoded []byte, value []byte) []byte {
+	if value == nil {
+		return append(encoded, 0)
+	}
+
+	return appendBytes(append(encoded, 1), value)
+}
+
+func appendEntry(encoded []byte, entry Entry) []byte {
+	if !entry.Bucket {
+		encoded = append(encoded, 0)
+		encoded = appendBytes(encoded, entry.Key)
+		return appendBytes(encoded, entry.Value)
+	}
+
+	encoded = append(encoded, 1)
+	encoded = appendBytes(encoded, entry.Key)
+	encoded = binary.AppendUvarint(encoded, entry.Sequence)
+	encoded = binary.AppendUvarint(encoded, uint64(len(entry.Children)))
+	for _, child := range entry.Children {
+		encoded = appendEntry(encoded, child)
+	}
+
+	return encoded
+}
+
+var errCorruptedChange = errors.New("corrupted change")
+
+type changeReader struct {
+	raw []byte
+	err error
+}
+
+func (r *changeReader) uvarint() uint64 {
+	if r.err != nil {
+		return 0
+	}
+
+	value, n := binary.Uvarint(r.raw)
+	if n <= 0 {
+		r.err = errCorruptedChange
+		return 0
+	}
+	r.raw = r.raw[n:]
+
+	return value
+}
+
+func (r *changeReader) byte() byte {
+	if r.err != nil {
+		return 0
+	}
+	if len(r.raw) == 0 {
+		r.err = errCorruptedChange
+		return 0
+	}
+
+	value := r.raw[0]
+	r.raw = r.raw[1:]
+
+	return value
+}
+
+func (r *changeReader) flag() bool {
+	return r.byte() == 1
+}
+
+func (r *changeReader) bytes() []byte {
+	length := r.uvarint()
+	if r.err != nil {
+		return nil
+	}
+	if uint64(len(r.raw)) < length {
+		r.err = errCorruptedChange
+		return nil
+	}
+
+	value := bytes.Clone(r.raw[:length])
+	if value == nil {
+		value = []byte{}
+	}
+	r.raw = r.raw[length:]
+
+	return value
+}
+
+func (r *changeReader) entry() Entry {
+	if !r.flag() {
+		return Entry{Key: r.bytes(), Value: r.bytes()}
+	}
+
+	entry := Entry{Key: r.bytes(), Bucket: true, Sequence: r.uvarint()}
+
+	count := r.uvarint()
+	for i := uint64(0); i < count && r.err == nil; i++ {
+		entry.Children = append(entry.Children, r.entry())
+	}
+
+	return entry
+}
+
+func decodeChange(raw []byte) (Change, error) {
+	r := &changeReader{raw: raw}
+
+	change := Change{Namespace: string(r.bytes()), Key: r.bytes()}
+	if r.flag() {
+		change.Field = r.bytes()
+	}
+	change.BucketSequence = r.uvarint()
+	change.Collection = ValueType(r.byte())
+	if r.flag() {
+		entry := r.entry()
+		change.Entry = &entry
+	}
+
+	if r.err != nil {
+		return Change{}, r.err
+	}
+
+	return change, nil
+}
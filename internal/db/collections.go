@@ -0,0 +1,497 @@
+package db
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+type ValueType byte
+
+const (
+	TypeNone ValueType = iota
+	TypeString
+	TypeHash
+	TypeList
+	TypeSet
+	TypeSortedSet
+)
+
+func (t ValueType) String() string {
+	switch t {
+	case TypeNone:
+		return "none"
+	case TypeString:
+		return "string"
+	case TypeHash:
+		return "hash"
+	case TypeList:
+		return "list"
+	case TypeSet:
+		return "set"
+	case TypeSortedSet:
+		return "sorted set"
+	default:
+		return fmt.Sprintf("unknown(%d)", byte(t))
+	}
+}
+
+var ErrWrongType = errors.New("operation against a key holding the wrong kind of value")
+
+var (
+	collectionTypeKey   = []byte("type")
+	collectionLengthKey = []byte("length")
+	collectionItemsKey  = []byte("items")
+	collectionScoresKey = []byte("scores")
+)
+
+const listMidpoint = uint64(1) << 63
+
+// collection is a typed value stored as a nested bucket under its key in the
+// default bucket, holding its type, its element count and an items bucket.
+// Sorted sets additionally keep a scores bucket ordered by score.
+type collection struct {
+	bucket *bolt.Bucket
+	items  *bolt.Bucket
+	scores *bolt.Bucket
+}
+
+func (c *collection) length() uint64 {
+	return binary.BigEndian.Uint64(c.bucket.Get(collectionLengthKey))
+}
+
+func (c *collection) setLength(length uint64) error {
+	encoded := make([]byte, 8)
+	binary.BigEndian.PutUint64(encoded, length)
+	return c.bucket.Put(collectionLengthKey, encoded)
+}
+
+func lookupKey(data *bolt.Bucket, key []byte) ([]byte, ValueType) {
+	k, v := data.Cursor().Seek(key)
+	if !bytes.Equal(k, key) {
+		return nil, TypeNone
+	}
+
+	if v != nil {
+		return v, TypeString
+	}
+
+	meta := data.Bucket(key).Get(collectionTypeKey)
+	if len(meta) != 1 {
+		return nil, TypeNone
+	}
+
+	return nil, ValueType(meta[0])
+}
+
+func openCollection(tx *bolt.Tx, key string, valueType ValueType) (*collection, error) {
+	data := tx.Bucket([]byte(defaultBucketName))
+
+	_, existing := lookupKey(data, []byte(key))
+	if existing == TypeNone {
+		return nil, nil
+	}
+	if existing != valueType {
+		return nil, ErrWrongType
+	}
+
+	bucket := data.Bucket([]byte(key))
+	return &collection{
+		bucket: bucket,
+		items:  bucket.Bucket(collectionItemsKey),
+		scores: bucket.Bucket(collectionScoresKey),
+	}, nil
+}
+
+func createCollection(tx *bolt.Tx, key string, valueType ValueType) (*collection, error) {
+	c, err := openCollection(tx, key, valueType)
+	if err != nil || c != nil {
+		return c, err
+	}
+
+	bucket, err := tx.Bucket([]byte(defaultBucketName)).CreateBucket([]byte(key))
+	if err != nil {
+		return nil, err
+	}
+
+	if err := bucket.Put(collectionTypeKey, []byte{byte(valueType)}); err != nil {
+		return nil, err
+	}
+
+	items, err := bucket.CreateBucket(collectionItemsKey)
+	if err != nil {
+		return nil, err
+	}
+
+	c = &collection{bucket: bucket, items: items}
+
+	if valueType == TypeSortedSet {
+		if c.scores, err = bucket.CreateBucket(collectionScoresKey); err != nil {
+			return nil, err
+		}
+	}
+
+	return c, c.setLength(0)
+}
+
+// dropIfEmpty removes a collection once its last element is gone, so an empty
+// collection never lingers as a typed key.
+func dropIfEmpty(tx *bolt.Tx, key string, c *collection) error {
+	if c.length() > 0 {
+		return nil
+	}
+
+	return tx.Bucket([]byte(defaultBucketName)).DeleteBucket([]byte(key))
+}
+
+func (db *Database) KeyType(key string) (ValueType, error) {
+	var valueType ValueType
+
+	err := db.stripe(key).View(func(tx *bolt.Tx) error {
+		_, valueType = lookupKey(tx.Bucket([]byte(defaultBucketName)), []byte(key))
+		return nil
+	})
+
+	return valueType, err
+}
+
+func (db *Database) HashSet(key string, fields map[string][]byte) (int, error) {
+	added := 0
+
+	err := db.write(db.stripe(key), func(tx *bolt.Tx, changes *changeSet) error {
+		c, err := createCollection(tx, key, TypeHash)
+		if err != nil {
+			return err
+		}
+
+		for field, value := range fields {
+			changes.touchField(NamespaceData, []byte(key), []byte(field))
+
+			if c.items.Get([]byte(field)) == nil {
+				added++
+			}
+			if err := c.items.Put([]byte(field), value); err != nil {
+				return err
+			}
+		}
+
+		if err := c.setLength(c.length() + uint64(added)); err != nil {
+			return err
+		}
+
+		return dropIfEmpty(tx, key, c)
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return added, nil
+}
+
+func (db *Database) HashGet(key string, field string) ([]byte, error) {
+	var value []byte
+
+	err := db.stripe(key).View(func(tx *bolt.Tx) error {
+		c, err := openCollection(tx, key, TypeHash)
+		if err != nil || c == nil {
+			return err
+		}
+
+		if v := c.items.Get([]byte(field)); v != nil {
+			value = bytes.Clone(v)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return value, nil
+}
+
+func (db *Database) HashGetAll(key string) (map[string][]byte, error) {
+	fields := make(map[string][]byte)
+
+	err := db.stripe(key).View(func(tx *bolt.Tx) error {
+		c, err := openCollection(tx, key, TypeHash)
+		if err != nil || c == nil {
+			return err
+		}
+
+		return c.items.ForEach(func(k, v []byte) error {
+			fields[string(k)] = bytes.Clone(v)
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return fields, nil
+}
+
+func (db *Database) HashDelete(key string, fields []string) (int, error) {
+	removed := 0
+
+	err := db.write(db.stripe(key), func(tx *bolt.Tx, changes *changeSet) error {
+		c, err := openCollection(tx, key, TypeHash)
+		if err != nil || c == nil {
+			return err
+		}
+
+		for _, field := range fields {
+			if c.items.Get([]byte(field)) == nil {
+				continue
+			}
+			changes.touchField(NamespaceData, []byte(key), []byte(field))
+
+			if err := c.items.Delete([]byte(field)); err != nil {
+				return err
+			}
+			removed++
+		}
+
+		if err := c.setLength(c.length() - uint64(removed)); err != nil {
+			return err
+		}
+
+		return dropIfEmpty(tx, key, c)
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return removed, nil
+}
+
+func (db *Database) ListPush(key string, values [][]byte, left bool) (int, error) {
+	var length uint64
+
+	err := db.write(db.stripe(key), func(tx *bolt.Tx, changes *changeSet) error {
+		c, err := createCollection(tx, key, TypeList)
+		if err != nil {
+			return err
+		}
+
+		cursor := c.items.Cursor()
+		for _, value := range values {
+			index := listMidpoint
+			if left {
+				if k, _ := cursor.First(); k != nil {
+					index = binary.BigEndian.Uint64(k) - 1
+				}
+			} else {
+				if k, _ := cursor.Last(); k != nil {
+					index = binary.BigEndian.Uint64(k) + 1
+				}
+			}
+
+			changes.touchField(NamespaceData, []byte(key), encodeUint64(index))
+
+			if err := c.items.Put(encodeUint64(index), value); err != nil {
+				return err
+			}
+		}
+
+		length = c.length() + uint64(len(values))
+		if err := c.setLength(length); err != nil {
+			return err
+		}
+
+		return dropIfEmpty(tx, key, c)
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return int(length), nil
+}
+
+func (db *Database) ListPop(key string, left bool) ([]byte, error) {
+	var value []byte
+
+	err := db.write(db.stripe(key), func(tx *bolt.Tx, changes *changeSet) error {
+		c, err := openCollection(tx, key, TypeList)
+		if err != nil || c == nil {
+			return err
+		}
+
+		cursor := c.items.Cursor()
+		var k, v []byte
+		if left {
+			k, v = cursor.First()
+		} else {
+			k, v = cursor.Last()
+		}
+		if k == nil {
+			return nil
+		}
+
+		changes.touchField(NamespaceData, []byte(key), k)
+
+		value = bytes.Clone(v)
+		if err := cursor.Delete(); err != nil {
+			return err
+		}
+
+		if err := c.setLength(c.length() - 1); err != nil {
+			return err
+		}
+
+		return dropIfEmpty(tx, key, c)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return value, nil
+}
+
+// ListRange follows redis LRANGE semantics: both bounds are inclusive and
+// negative indices count from the end of the list.
+func (db *Database) ListRange(key string, start int64, stop int64) ([][]byte, error) {
+	var values [][]byte
+
+	err := db.stripe(key).View(func(tx *bolt.Tx) error {
+		c, err := openCollection(tx, key, TypeList)
+		if err != nil || c == nil {
+			return err
+		}
+
+		start, stop, ok := normalizeRange(start, stop, int64(c.length()))
+		if !ok {
+			return nil
+		}
+
+		cursor := c.items.Cursor()
+		index := int64(0)
+		for k, v := cursor.First(); k != nil && index <= stop; k, v = cursor.Next() {
+			if index >= start {
+				values = append(values, bytes.Clone(v))
+			}
+			index++
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return values, nil
+}
+
+func (db *Database) SetAdd(key string, members [][]byte) (int, error) {
+	added := 0
+
+	err := db.write(db.stripe(key), func(tx *bolt.Tx, changes *changeSet) error {
+		c, err := createCollection(tx, key, TypeSet)
+		if err != nil {
+			return err
+		}
+
+		for _, member := range members {
+			if c.items.Get(member) != nil {
+				continue
+			}
+			changes.touchField(NamespaceData, []byte(key), member)
+
+			if err := c.items.Put(member, []byte{}); err != nil {
+				return err
+			}
+			added++
+		}
+
+		if err := c.setLength(c.length() + uint64(added)); err != nil {
+			return err
+		}
+
+		return dropIfEmpty(tx, key, c)
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return added, nil
+}
+
+func (db *Database) SetRemove(key string, members [][]byte) (int, error) {
+	removed := 0
+
+	err := db.write(db.stripe(key), func(tx *bolt.Tx, changes *changeSet) error {
+		c, err := openCollection(tx, key, TypeSet)
+		if err != nil || c == nil {
+			return err
+		}
+
+		for _, member := range members {
+			if c.items.Get(member) == nil {
+				continue
+			}
+			changes.touchField(NamespaceData, []byte(key), member)
+
+			if err := c.items.Delete(member); err != nil {
+				return err
+			}
+			removed++
+		}
+
+		if err := c.setLength(c.length() - uint64(removed)); err != nil {
+			return err
+		}
+
+		return dropIfEmpty(tx, key, c)
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return removed, nil
+}
+
+func (db *Database) SetMembers(key string) ([][]byte, error) {
+	var members [][]byte
+
+	err := db.stripe(key).View(func(tx *bolt.Tx) error {
+		c, err := openCollection(tx, key, TypeSet)
+		if err != nil || c == nil {
+			return err
+		}
+
+		return c.items.ForEach(func(k, _ []byte) error {
+			members = append(members, bytes.Clone(k))
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return members, nil
+}
+
+func encodeUint64(index uint64) []byte {
+	encoded := make([]byte, 8)
+	binary.BigEndian.PutUint64(encoded, index)
+	return encoded
+}
+
+func normalizeRange(start int64, stop int64, length int64) (int64, int64, bool) {
+	if start < 0 {
+		start += length
+	}
+	if stop < 0 {
+		stop += length
+	}
+	if start < 0 {
+		start = 0
+	}
+	if stop >= length {
+		stop = length - 1
+	}
+
+	return start, stop, start <= stop && length > 0
+}
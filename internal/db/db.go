@@ -1,25 +1,86 @@
 package db
 
 import (
+	"bytes"
+	"errors"
 	"fmt"
+	"sync"
+	"sync/atomic"
 
 	bolt "go.etcd.io/bbolt"
 )
 
 const defaultBucketName = "nilis"
 
+// Database spreads the keyspace across a fixed number of bbolt files, each
+// with its own writer. Keys, collections and queues live in the stripe their
+// name hashes to, system values and session records in the first one.
 type Database struct {
-	database *bolt.DB
+	stripes []*bolt.DB
+
+	// writers is held shared by every write transaction and exclusively while
+	// a backup starts reading, so a backup sees one point in time across all
+	// stripes, or while the changelog opens
+	writers sync.RWMutex
+
+	// changelog records every committed change of keys and queues, nil
+	// until it is opened. It is set while writers is held exclusively, so
+	// every write is either recorded or committed before it opened.
+	changelog   atomic.Pointer[changelog]
+	changelogMu sync.Mutex
 }
 
-func NewDatabase(path string) (*Database, error) {
-	localdb, err := bolt.Open(path, 0600, nil)
+type Options struct {
+	// Stripes is the number of files the keyspace is spread across, an
+	// existing database keeps the stripe count it was created with.
+	Stripes int
+	// Metadata is recorded when the database is created.
+	Metadata map[string]string
+}
+
+// NewDatabase opens the database at path, creating it when it does not
+// exist.
+func NewDatabase(path string, options Options) (*Database, error) {
+	if options.Stripes < 1 {
+		return nil, fmt.Errorf("stripe count must be positive, got: %d", options.Stripes)
+	}
+
+	first, err := bolt.Open(path, 0600, nil)
 	if err != nil {
 		return nil, err
 	}
 
 	database := &Database{
-		database: localdb,
+		stripes: []*bolt.DB{first},
+	}
+
+	count, created, err := stripeCount(first, options.Stripes)
+	if err != nil {
+		database.Close()
+		return nil, fmt.Errorf("failed reading stripe count: %w", err)
+	}
+
+	for index := 1; index < count; index++ {
+		stripe, err := openStripe(path, index, count, created)
+		if err != nil {
+			database.Close()
+			return nil, fmt.Errorf("failed opening stripe %d: %w", index, err)
+		}
+		database.stripes = append(database.stripes, stripe)
+	}
+
+	for index, stripe := range database.stripes {
+		if err := markStripe(stripe, index, count, created); err != nil {
+			database.Close()
+			return nil, fmt.Errorf("failed verifying stripe %d: %w", index, err)
+		}
+	}
+
+	if created {
+		if err := recordCreation(first, count, options.Metadata); err != nil {
+			database.Close()
+			return nil, fmt.Errorf("failed recording database metadata: %w", err)
+		}
 	}
 
 	if err := database.createDefaultBucket(); err != nil {
@@ -27,29 +88,75 @@ func NewDatabase(path string) (*Database, error) {
 		return nil, fmt.Errorf("failed creating default bucket: %w", err)
 	}
 
+	if err := database.createSessionBuckets(); err != nil {
+		database.Close()
+		return nil, fmt.Errorf("failed creating session buckets: %w", err)
+	}
+
+	if err := database.createQueuesBucket(); err != nil {
+		database.Close()
+		return nil, fmt.Errorf("failed creating queues bucket: %w", err)
+	}
+
 	return database, nil
 }
 
+// createBucket creates a top level bucket in every stripe.
+func (db *Database) createBucket(name string) error {
+	for _, stripe := range db.stripes {
+		err := stripe.Update(func(tx *bolt.Tx) error {
+			_, err := tx.CreateBucketIfNotExists([]byte(name))
+			return err
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
 func (db *Database) createDefaultBucket() error {
-	return db.database.Update(func(tx *bolt.Tx) error {
-		_, err := tx.CreateBucketIfNotExists([]byte(defaultBucketName))
-		return err
-	})
+	return db.createBucket(defaultBucketName)
 }
 
-func (db *Database) SetKey(key string, value []byte) error {
-	return db.database.Update(func(tx *bolt.Tx) error {
+// SetKey stores a plain value. written, when not nil, is called inside the
+// write transaction once the value is stored.
+func (db *Database) SetKey(key string, value []byte, written func()) error {
+	return db.write(db.stripe(key), func(tx *bolt.Tx, changes *changeSet) error {
+		changes.touch(NamespaceData, []byte(key))
+
+		if err := releaseEphemeralKey(tx, key); err != nil {
+			return err
+		}
+
 		b := tx.Bucket([]byte(defaultBucketName))
-		return b.Put([]byte(key), value)
+		if _, valueType := lookupKey(b, []byte(key)); valueType != TypeNone && valueType != TypeString {
+			return ErrWrongType
+		}
+
+		if err := b.Put([]byte(key), value); err != nil {
+			return err
+		}
+
+		if written != nil {
+			written()
+		}
+		return nil
 	})
 }
 
 func (db *Database) GetKey(key string) ([]byte, error) {
 	var value []byte
 
-	err := db.database.View(func(tx *bolt.Tx) error {
+	err := db.stripe(key).View(func(tx *bolt.Tx) error {
 		b := tx.Bucket([]byte(defaultBucketName))
-		value = b.Get([]byte(key))
+		v, valueType := lookupKey(b, []byte(key))
+		if valueType != TypeNone && valueType != TypeString {
+			return ErrWrongType
+		}
+
+		value = bytes.Clone(v)
 		return nil
 	})
 
@@ -61,12 +168,170 @@ func (db *Database) GetKey(key string) ([]byte, error) {
 }
 
 func (db *Database) DeleteKey(key string) error {
-	return db.database.Update(func(tx *bolt.Tx) error {
+	return db.write(db.stripe(key), func(tx *bolt.Tx, changes *changeSet) error {
+		changes.touch(NamespaceData, []byte(key))
+
+		if err := releaseEphemeralKey(tx, key); err != nil {
+			return err
+		}
+
 		b := tx.Bucket([]byte(defaultBucketName))
+		if _, valueType := lookupKey(b, []byte(key)); valueType != TypeNone && valueType != TypeString {
+			return b.DeleteBucket([]byte(key))
+		}
+
 		return b.Delete([]byte(key))
 	})
 }
 
 func (db *Database) Close() error {
-	return db.database.Close()
+	var errs []error
+	for _, stripe := range db.stripes {
+		errs = append(errs, stripe.Close())
+	}
+
+	return errors.Join(errs...)
+}
+
+// DeleteKeys deletes plain values. When evicted is not nil it is asked inside
+// the write transaction whether a key is still to be deleted, keys it rejects
+// are kept.
+func (db *Database) DeleteKeys(keys []string, evicted func(key string) bool) error {
+	for stripe, keys := range groupByStripe(db, keys, stringKey) {
+		err := db.write(stripe, func(tx *bolt.Tx, changes *changeSet) error {
+			b := tx.Bucket([]byte(defaultBucketName))
+
+			for _, key := range keys {
+				if evicted != nil && !evicted(key) {
+					continue
+				}
+				changes.touch(NamespaceData, []byte(key))
+
+				if err := releaseEphemeralKey(tx, key); err != nil {
+					return err
+				}
+				if _, valueType := lookupKey(b, []byte(key)); valueType != TypeString {
+					continue
+				}
+				if err := b.Delete([]byte(key)); err != nil {
+					return err
+				}
+			}
+
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// ForEachKey calls fn with every plain string key and the size of its value,
+// collections are skipped. Keys are ordered within a stripe only.
+func (db *Database) ForEachKey(fn func(key string, size int) error) error {
+	for _, stripe := range db.stripes {
+		err := stripe.View(func(tx *bolt.Tx) error {
+			return tx.Bucket([]byte(defaultBucketName)).ForEach(func(k, v []byte) error {
+				if v == nil {
+					return nil
+				}
+				return fn(string(k), len(v))
+			})
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// DeleteRange deletes every key in [start, end) in transactions of at most
+// batchSize keys, so a large range never holds the write lock for long. An
+// empty end deletes through the last key. onBatch is called with the keys of
+// each committed batch.
+func (db *Database) DeleteRange(start []byte, end []byte, batchSize int, onBatch func(keys []string)) (int, error) {
+	deleted := 0
+
+	for _, stripe := range db.stripes {
+		n, err := db.deleteStripeRange(stripe, start, end, batchSize, onBatch)
+		deleted += n
+		if err != nil {
+			return deleted, err
+		}
+	}
+
+	return deleted, nil
+}
+
+func (db *Database) deleteStripeRange(stripe *bolt.DB, start []byte, end []byte, batchSize int, onBatch func(keys []string)) (int, error) {
+	deleted := 0
+	from := start
+
+	for {
+		var batch []string
+
+		err := db.write(stripe, func(tx *bolt.Tx, changes *changeSet) error {
+			b := tx.Bucket([]byte(defaultBucketName))
+
+			cursor := b.Cursor()
+			for k, _ := cursor.Seek(from); k != nil && len(batch) < batchSize; k, _ = cursor.Next() {
+				if len(end) > 0 && bytes.Compare(k, end) >= 0 {
+					break
+				}
+				batch = append(batch, string(k))
+			}
+
+			for _, key := range batch {
+				changes.touch(NamespaceData, []byte(key))
+
+				if err := releaseEphemeralKey(tx, key); err != nil {
+					return err
+				}
+
+				_, valueType := lookupKey(b, []byte(key))
+				if valueType != TypeString {
+					if err := b.DeleteBucket([]byte(key)); err != nil {
+						return err
+					}
+					continue
+				}
+				if err := b.Delete([]byte(key)); err != nil {
+					return err
+				}
+			}
+
+			return nil
+		})
+		if err != nil {
+			return deleted, err
+		}
+
+		deleted += len(batch)
+		if len(batch) > 0 && onBatch != nil {
+			onBatch(batch)
+		}
+
+		if len(batch) < batchSize {
+			return deleted, nil
+		}
+
+		from = []byte(batch[len(batch)-1] + "\x00")
+	}
+}
+
+// PrefixEnd returns the smallest key greater than every key with the given
+// prefix, or nil when no such key exists.
+func PrefixEnd(prefix []byte) []byte {
+	end := bytes.Clone(prefix)
+	for i := len(end) - 1; i >= 0; i-- {
+		if end[i] < 0xff {
+			end[i]++
+			return end[:i+1]
+		}
+	}
+
+	return nil
 }
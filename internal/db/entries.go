@@ -0,0 +1,348 @@
+package db
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+const (
+	NamespaceData   = "data"
+	NamespaceQueues = "queues"
+)
+
+// Entry is a raw top level record of a namespace, a plain value or a nested
+// bucket with its children, used to move keys between nodes regardless of
+// their type.
+type Entry struct {
+	Key      []byte
+	Value    []byte
+	Bucket   bool
+	Sequence uint64
+	Children []Entry
+	// Session owns an ephemeral key, only set on top level entries of the
+	// data namespace.
+	Session string
+}
+
+func namespaceBucket(tx *bolt.Tx, namespace string) (*bolt.Bucket, error) {
+	switch namespace {
+	case NamespaceData:
+		return tx.Bucket([]byte(defaultBucketName)), nil
+	case NamespaceQueues:
+		return tx.Bucket([]byte(queuesBucketName)), nil
+	default:
+		return nil, fmt.Errorf("unknown namespace: %s", namespace)
+	}
+}
+
+// ExportRange returns up to limit entries starting at from whose key passes
+// the filter, together with the key to resume from, which is nil once the
+// namespace is exhausted. Ephemeral keys carry the id of their session.
+func (db *Database) ExportRange(namespace string, from []byte, limit int, filter func(key []byte) bool) ([]Entry, []byte, error) {
+	var keys [][]byte
+
+	for _, stripe := range db.stripes {
+		stripeKeys, err := rangeKeys(stripe, namespace, from, limit+1, filter)
+		if err != nil {
+			return nil, nil, err
+		}
+		keys = append(keys, stripeKeys...)
+	}
+
+	sort.Slice(keys, func(i, j int) bool {
+		return bytes.Compare(keys[i], keys[j]) < 0
+	})
+
+	var next []byte
+	if len(keys) > limit {
+		next = keys[limit]
+		keys = keys[:limit]
+	}
+
+	entries, err := db.ExportKeys(namespace, keys)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return entries, next, nil
+}
+
+// SnapshotRange is ExportRange for every key, for a replica that serves
+// ephemeral keys as long as their session lives on the primary.
+func (db *Database) SnapshotRange(namespace string, from []byte, limit int) ([]Entry, []byte, error) {
+	return db.ExportRange(namespace, from, limit, nil)
+}
+
+// rangeKeys returns up to limit keys of a stripe starting at from that pass
+// the filter.
+func rangeKeys(stripe *bolt.DB, namespace string, from []byte, limit int, filter func(key []byte) bool) ([][]byte, error) {
+	var keys [][]byte
+
+	err := stripe.View(func(tx *bolt.Tx) error {
+		b, err := namespaceBucket(tx, namespace)
+		if err != nil {
+			return err
+		}
+
+		cursor := b.Cursor()
+		for k, _ := cursor.Seek(from); k != nil && len(keys) < limit; k, _ = cursor.Next() {
+			if filter != nil && !filter(k) {
+				continue
+			}
+
+			keys = append(keys, bytes.Clone(k))
+		}
+
+		return nil
+	})
+
+	return keys, err
+}
+
+// ForEachEntryKey calls fn with every top level key of a namespace inside a
+// single read transaction per stripe, stopping at the first error fn returns.
+// Keys are ordered within a stripe only.
+func (db *Database) ForEachEntryKey(namespace string, fn func(key []byte) error) error {
+	for _, stripe := range db.stripes {
+		err := stripe.View(func(tx *bolt.Tx) error {
+			b, err := namespaceBucket(tx, namespace)
+			if err != nil {
+				return err
+			}
+
+			return b.ForEach(func(k, _ []byte) error {
+				return fn(k)
+			})
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// ForEachEntrySize is ForEachEntryKey passing the number of bytes taken by
+// each key and its value, including every nested bucket of a collection.
+func (db *Database) ForEachEntrySize(namespace string, fn func(key []byte, size int) error) error {
+	for _, stripe := range db.stripes {
+		err := stripe.View(func(tx *bolt.Tx) error {
+			b, err := namespaceBucket(tx, namespace)
+			if err != nil {
+				return err
+			}
+
+			return b.ForEach(func(k, v []byte) error {
+				size := len(k) + len(v)
+				if v == nil {
+					size += bucketSize(b.Bucket(k))
+				}
+
+				return fn(k, size)
+			})
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func bucketSize(b *bolt.Bucket) int {
+	size := 0
+	b.ForEach(func(k, v []byte) error {
+		size += len(k) + len(v)
+		if v == nil {
+			size += bucketSize(b.Bucket(k))
+		}
+		return nil
+	})
+
+	return size
+}
+
+// ExportKeys returns the entries of the given keys that exist, in the order
+// of keys.
+func (db *Database) ExportKeys(namespace string, keys [][]byte) ([]Entry, error) {
+	found := make(map[string]Entry, len(keys))
+
+	for stripe, keys := range groupByStripe(db, keys, func(key []byte) string { return string(key) }) {
+		err := stripe.View(func(tx *bolt.Tx) error {
+			b, err := namespaceBucket(tx, namespace)
+			if err != nil {
+				return err
+			}
+
+			ephemeral := tx.Bucket([]byte(ephemeralKeysBucketName))
+
+			for _, key := range keys {
+				k, v := b.Cursor().Seek(key)
+				if !bytes.Equal(k, key) {
+					continue
+				}
+				entry := exportEntry(b, k, v)
+				if namespace == NamespaceData {
+					entry.Session = string(ephemeral.Get(k))
+				}
+				found[string(key)] = entry
+			}
+
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var entries []Entry
+	for _, key := range keys {
+		if entry, ok := found[string(key)]; ok {
+			entries = append(entries, entry)
+			delete(found, string(key))
+		}
+	}
+
+	return entries, nil
+}
+
+// ImportEntries stores entries whose key does not exist yet, an existing key
+// is always newer than an imported copy of it. Ephemeral keys are skipped
+// unless their session is known. It returns the number of entries that were
+// stored.
+func (db *Database) ImportEntries(namespace string, entries []Entry) (int, error) {
+	imported := 0
+
+	for stripe, entries := range groupByStripe(db, entries, func(entry Entry) string { return string(entry.Key) }) {
+		err := db.write(stripe, func(tx *bolt.Tx, changes *changeSet) error {
+			b, err := namespaceBucket(tx, namespace)
+			if err != nil {
+				return err
+			}
+
+			for _, entry := range entries {
+				if k, _ := b.Cursor().Seek(entry.Key); bytes.Equal(k, entry.Key) {
+					continue
+				}
+
+				var sessionKeys *bolt.Bucket
+				if entry.Session != "" {
+					if sessionKeys = tx.Bucket([]byte(sessionKeysBucketName)).Bucket([]byte(entry.Session)); sessionKeys == nil {
+						continue
+					}
+				}
+				changes.touch(namespace, entry.Key)
+
+				if err := importEntry(b, entry); err != nil {
+					return fmt.Errorf("failed importing key %q: %w", entry.Key, err)
+				}
+				if sessionKeys != nil {
+					if err := tx.Bucket([]byte(ephemeralKeysBucketName)).Put(entry.Key, []byte(entry.Session)); err != nil {
+						return err
+					}
+					if err := sessionKeys.Put(entry.Key, []byte{}); err != nil {
+						return err
+					}
+				}
+				imported++
+			}
+
+			return nil
+		})
+		if err != nil {
+			return imported, err
+		}
+	}
+
+	return imported, nil
+}
+
+func (db *Database) DeleteEntries(namespace string, keys [][]byte) (int, error) {
+	deleted := 0
+
+	for stripe, keys := range groupByStripe(db, keys, func(key []byte) string { return string(key) }) {
+		err := db.write(stripe, func(tx *bolt.Tx, changes *changeSet) error {
+			b, err := namespaceBucket(tx, namespace)
+			if err != nil {
+				return err
+			}
+
+			for _, key := range keys {
+				k, v := b.Cursor().Seek(key)
+				if !bytes.Equal(k, key) {
+					continue
+				}
+				changes.touch(namespace, key)
+
+				if namespace == NamespaceData {
+					if err := releaseEphemeralKey(tx, string(key)); err != nil {
+						return err
+					}
+				}
+
+				if v == nil {
+					err = b.DeleteBucket(key)
+				} else {
+					err = b.Delete(key)
+				}
+				if err != nil {
+					return err
+				}
+				deleted++
+			}
+
+			return nil
+		})
+		if err != nil {
+			return deleted, err
+		}
+	}
+
+	return deleted, nil
+}
+
+func exportEntry(parent *bolt.Bucket, k []byte, v []byte) Entry {
+	if v != nil {
+		return Entry{Key: bytes.Clone(k), Value: bytes.Clone(v)}
+	}
+
+	bucket := parent.Bucket(k)
+	entry := Entry{
+		Key:      bytes.Clone(k),
+		Bucket:   true,
+		Sequence: bucket.Sequence(),
+	}
+
+	bucket.ForEach(func(ck, cv []byte) error {
+		entry.Children = append(entry.Children, exportEntry(bucket, ck, cv))
+		return nil
+	})
+
+	return entry
+}
+
+func importEntry(parent *bolt.Bucket, entry Entry) error {
+	if !entry.Bucket {
+		return parent.Put(entry.Key, entry.Value)
+	}
+
+	bucket, err := parent.CreateBucket(entry.Key)
+	if err != nil {
+		return err
+	}
+
+	if err := bucket.SetSequence(entry.Sequence); err != nil {
+		return err
+	}
+
+	for _, child := range entry.Children {
+		if err := importEntry(bucket, child); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,53 @@
+package db
+
+import (
+	bolt "go.etcd.io/bbolt"
+)
+
+const metadataBucketName = "metadata"
+
+// Metadata returns the values describing what the database holds, which is
+// empty for databases created before metadata was recorded.
+func (db *Database) Metadata() (map[string]string, error) {
+	metadata := make(map[string]string)
+
+	err := db.meta().View(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(metadataBucketName))
+		if b == nil {
+			return nil
+		}
+
+		return b.ForEach(func(k, v []byte) error {
+			metadata[string(k)] = string(v)
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return metadata, nil
+}
+
+// SetMetadata stores the given values, leaving other recorded values as they
+// are.
+func (db *Database) SetMetadata(values map[string]string) error {
+	return db.update(db.meta(), func(tx *bolt.Tx) error {
+		return putMetadata(tx, values)
+	})
+}
+
+func putMetadata(tx *bolt.Tx, values map[string]string) error {
+	b, err := tx.CreateBucketIfNotExists([]byte(metadataBucketName))
+	if err != nil {
+		return err
+	}
+
+	for key, value := range values {
+		if err := b.Put([]byte(key), []byte(value)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,320 @@
+package db
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+const queuesBucketName = "queues"
+
+var (
+	ErrInvalidReceipt = errors.New("malformed receipt handle")
+	ErrReceiptExpired = errors.New("receipt handle is no longer valid")
+)
+
+const queueRecordHeaderSize = 12
+
+type QueueMessage struct {
+	ID            uint64
+	Body          []byte
+	ReceiptHandle string
+	DeliveryCount uint32
+}
+
+type DequeueOptions struct {
+	MaxMessages       int
+	VisibilityTimeout time.Duration
+	MaxDeliveries     uint32
+	DeadLetterQueue   string
+}
+
+func (db *Database) createQueuesBucket() error {
+	return db.createBucket(queuesBucketName)
+}
+
+func (db *Database) Enqueue(queue string, messages [][]byte) ([]uint64, error) {
+	ids := make([]uint64, 0, len(messages))
+
+	err := db.write(db.stripe(queue), func(tx *bolt.Tx, changes *changeSet) error {
+		q, err := tx.Bucket([]byte(queuesBucketName)).CreateBucketIfNotExists([]byte(queue))
+		if err != nil {
+			return err
+		}
+
+		for _, body := range messages {
+			id, err := enqueueMessage(q, 0, body)
+			if err != nil {
+				return err
+			}
+			ids = append(ids, id)
+			changes.touchField(NamespaceQueues, []byte(queue), encodeUint64(id))
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return ids, nil
+}
+
+// Dequeue hands out the oldest visible messages of a queue and hides them for
+// the visibility timeout. Messages that were already delivered MaxDeliveries
+// times are moved to the dead letter queue instead of being handed out.
+func (db *Database) Dequeue(queue string, opts DequeueOptions) ([]QueueMessage, error) {
+	stripe := db.stripe(queue)
+
+	// a dead letter queue in another stripe cannot be written in the same
+	// transaction, its messages stay hidden in the queue until they were
+	// copied, so a failure in between delivers them to it twice at worst
+	remote := opts.DeadLetterQueue != "" && db.stripe(opts.DeadLetterQueue) != stripe
+
+	var messages []QueueMessage
+	var moving []deadLetterMessage
+
+	err := db.write(stripe, func(tx *bolt.Tx, changes *changeSet) error {
+		queues := tx.Bucket([]byte(queuesBucketName))
+
+		q := queues.Bucket([]byte(queue))
+		if q == nil {
+			return nil
+		}
+
+		now := time.Now()
+
+		type visibleMessage struct {
+			key          []byte
+			deliveries   uint32
+			body         []byte
+			deadLettered bool
+		}
+
+		var visible []visibleMessage
+		deliverable := 0
+		cursor := q.Cursor()
+		for k, v := cursor.First(); k != nil && deliverable < opts.MaxMessages; k, v = cursor.Next() {
+			deliveries, visibleAt, body := decodeQueueRecord(v)
+			if visibleAt > now.UnixNano() {
+				continue
+			}
+
+			if opts.MaxDeliveries > 0 && deliveries >= opts.MaxDeliveries {
+				if remote {
+					moving = append(moving, deadLetterMessage{
+						key:    bytes.Clone(k),
+						record: encodeQueueRecord(deliveries, now.Add(opts.VisibilityTimeout).UnixNano(), body),
+					})
+					continue
+				}
+
+				if err := deadLetter(queues, opts.DeadLetterQueue, body, changes); err != nil {
+					return err
+				}
+				visible = append(visible, visibleMessage{key: bytes.Clone(k), deadLettered: true})
+				continue
+			}
+
+			deliverable++
+			visible = append(visible, visibleMessage{
+				key:        bytes.Clone(k),
+				deliveries: deliveries + 1,
+				body:       bytes.Clone(body),
+			})
+		}
+
+		for _, message := range moving {
+			changes.touchField(NamespaceQueues, []byte(queue), message.key)
+			if err := q.Put(message.key, message.record); err != nil {
+				return err
+			}
+		}
+
+		for _, message := range visible {
+			changes.touchField(NamespaceQueues, []byte(queue), message.key)
+			if message.deadLettered {
+				if err := q.Delete(message.key); err != nil {
+					return err
+				}
+				continue
+			}
+
+			id := binary.BigEndian.Uint64(message.key)
+			record := encodeQueueRecord(message.deliveries, now.Add(opts.VisibilityTimeout).UnixNano(), message.body)
+			if err := q.Put(message.key, record); err != nil {
+				return err
+			}
+
+			messages = append(messages, QueueMessage{
+				ID:            id,
+				Body:          message.body,
+				ReceiptHandle: encodeReceipt(id, message.deliveries),
+				DeliveryCount: message.deliveries,
+			})
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if len(moving) > 0 {
+		if err := db.moveToDeadLetterQueue(stripe, queue, opts.DeadLetterQueue, moving); err != nil {
+			return nil, fmt.Errorf("failed dead lettering messages: %w", err)
+		}
+	}
+
+	return messages, nil
+}
+
+type deadLetterMessage struct {
+	key    []byte
+	record []byte
+}
+
+// moveToDeadLetterQueue enqueues hidden messages to a dead letter queue of
+// another stripe and then removes them from their queue, unless they changed
+// in the meantime.
+func (db *Database) moveToDeadLetterQueue(stripe *bolt.DB, queue string, deadLetterQueue string, messages []deadLetterMessage) error {
+	bodies := make([][]byte, 0, len(messages))
+	for _, message := range messages {
+		_, _, body := decodeQueueRecord(message.record)
+		bodies = append(bodies, body)
+	}
+
+	if _, err := db.Enqueue(deadLetterQueue, bodies); err != nil {
+		return err
+	}
+
+	return db.write(stripe, func(tx *bolt.Tx, changes *changeSet) error {
+		q := tx.Bucket([]byte(queuesBucketName)).Bucket([]byte(queue))
+		if q == nil {
+			return nil
+		}
+
+		for _, message := range messages {
+			if !bytes.Equal(q.Get(message.key), message.record) {
+				continue
+			}
+			changes.touchField(NamespaceQueues, []byte(queue), message.key)
+			if err := q.Delete(message.key); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+func (db *Database) Ack(queue string, receipt string) error {
+	return db.write(db.stripe(queue), func(tx *bolt.Tx, changes *changeSet) error {
+		q, k, _, err := lookupReceipt(tx, queue, receipt)
+		if err != nil {
+			return err
+		}
+		changes.touchField(NamespaceQueues, []byte(queue), k)
+
+		return q.Delete(k)
+	})
+}
+
+// Nack makes a delivered message visible again after delay, keeping its
+// delivery count so repeated failures still end in the dead letter queue.
+func (db *Database) Nack(queue string, receipt string, delay time.Duration) error {
+	return db.write(db.stripe(queue), func(tx *bolt.Tx, changes *changeSet) error {
+		q, k, v, err := lookupReceipt(tx, queue, receipt)
+		if err != nil {
+			return err
+		}
+		changes.touchField(NamespaceQueues, []byte(queue), k)
+
+		deliveries, _, body := decodeQueueRecord(v)
+		return q.Put(k, encodeQueueRecord(deliveries, time.Now().Add(delay).UnixNano(), body))
+	})
+}
+
+func lookupReceipt(tx *bolt.Tx, queue string, receipt string) (*bolt.Bucket, []byte, []byte, error) {
+	id, deliveries, err := decodeReceipt(receipt)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	q := tx.Bucket([]byte(queuesBucketName)).Bucket([]byte(queue))
+	if q == nil {
+		return nil, nil, nil, ErrReceiptExpired
+	}
+
+	k := encodeUint64(id)
+	v := q.Get(k)
+	if v == nil {
+		return nil, nil, nil, ErrReceiptExpired
+	}
+
+	// a newer delivery of the same message invalidates older receipts
+	if current, _, _ := decodeQueueRecord(v); current != deliveries {
+		return nil, nil, nil, ErrReceiptExpired
+	}
+
+	return q, k, bytes.Clone(v), nil
+}
+
+func deadLetter(queues *bolt.Bucket, deadLetterQueue string, body []byte, changes *changeSet) error {
+	if deadLetterQueue == "" {
+		return nil
+	}
+
+	dlq, err := queues.CreateBucketIfNotExists([]byte(deadLetterQueue))
+	if err != nil {
+		return err
+	}
+
+	id, err := enqueueMessage(dlq, 0, bytes.Clone(body))
+	if err != nil {
+		return err
+	}
+
+	changes.touchField(NamespaceQueues, []byte(deadLetterQueue), encodeUint64(id))
+	return nil
+}
+
+func enqueueMessage(q *bolt.Bucket, deliveries uint32, body []byte) (uint64, error) {
+	id, err := q.NextSequence()
+	if err != nil {
+		return 0, err
+	}
+
+	return id, q.Put(encodeUint64(id), encodeQueueRecord(deliveries, 0, body))
+}
+
+func encodeQueueRecord(deliveries uint32, visibleAt int64, body []byte) []byte {
+	record := make([]byte, queueRecordHeaderSize, queueRecordHeaderSize+len(body))
+	binary.BigEndian.PutUint32(record[0:4], deliveries)
+	binary.BigEndian.PutUint64(record[4:12], uint64(visibleAt))
+	return append(record, body...)
+}
+
+func decodeQueueRecord(record []byte) (uint32, int64, []byte) {
+	return binary.BigEndian.Uint32(record[0:4]),
+		int64(binary.BigEndian.Uint64(record[4:12])),
+		record[queueRecordHeaderSize:]
+}
+
+func encodeReceipt(id uint64, deliveries uint32) string {
+	return fmt.Sprintf("%016x%08x", id, deliveries)
+}
+
+func decodeReceipt(receipt string) (uint64, uint32, error) {
+	raw, err := hex.DecodeString(receipt)
+	if err != nil || len(raw) != 12 {
+		return 0, 0, ErrInvalidReceipt
+	}
+
+	return binary.BigEndian.Uint64(raw[0:8]), binary.BigEndian.Uint32(raw[8:12]), nil
+}
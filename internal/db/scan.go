@@ -0,0 +1,95 @@
+package db
+
+import (
+	"bytes"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+type KeyValue struct {
+	Key   string
+	Value []byte
+	Type  ValueType
+}
+
+// GetKeys looks up several keys with one transaction per stripe, leaving out
+// missing ones. Collections are reported with their type and without a value.
+func (db *Database) GetKeys(keys []string) ([]KeyValue, error) {
+	found := make(map[string]KeyValue, len(keys))
+
+	for stripe, keys := range groupByStripe(db, keys, stringKey) {
+		err := stripe.View(func(tx *bolt.Tx) error {
+			b := tx.Bucket([]byte(defaultBucketName))
+
+			for _, key := range keys {
+				v, valueType := lookupKey(b, []byte(key))
+				if valueType == TypeNone {
+					continue
+				}
+
+				found[key] = KeyValue{Key: key, Value: bytes.Clone(v), Type: valueType}
+			}
+
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var out []KeyValue
+	for _, key := range keys {
+		if entry, ok := found[key]; ok {
+			out = append(out, entry)
+			delete(found, key)
+		}
+	}
+
+	return out, nil
+}
+
+// Scan returns up to limit keys in [start, end) in key order, an empty end
+// scanning to the last key, and whether more keys follow. Every stripe is
+// read up to limit and the results are merged.
+func (db *Database) Scan(start []byte, end []byte, limit int, keysOnly bool) ([]KeyValue, bool, error) {
+	results := make([][]KeyValue, 0, len(db.stripes))
+
+	for _, stripe := range db.stripes {
+		result, err := scanStripe(stripe, start, end, limit+1, keysOnly)
+		if err != nil {
+			return nil, false, err
+		}
+		results = append(results, result)
+	}
+
+	out, more := mergeKeyValues(results, limit)
+	return out, more, nil
+}
+
+func scanStripe(stripe *bolt.DB, start []byte, end []byte, limit int, keysOnly bool) ([]KeyValue, error) {
+	var out []KeyValue
+
+	err := stripe.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(defaultBucketName))
+		c := b.Cursor()
+
+		for k, v := c.Seek(start); k != nil && len(out) < limit; k, v = c.Next() {
+			if len(end) > 0 && bytes.Compare(k, end) >= 0 {
+				break
+			}
+
+			entry := KeyValue{Key: string(k), Type: TypeString}
+			if v == nil {
+				_, entry.Type = lookupKey(b, k)
+			} else if !keysOnly {
+				entry.Value = bytes.Clone(v)
+			}
+
+			out = append(out, entry)
+		}
+
+		return nil
+	})
+
+	return out, err
+}
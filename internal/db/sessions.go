@@ -0,0 +1,198 @@
+package db
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+const (
+	sessionsBucketName      = "sessions"
+	sessionKeysBucketName   = "session_keys"
+	ephemeralKeysBucketName = "ephemeral_keys"
+)
+
+var ErrSessionNotFound = errors.New("session not found")
+
+func (db *Database) createSessionBuckets() error {
+	for _, name := range []string{sessionsBucketName, sessionKeysBucketName, ephemeralKeysBucketName} {
+		if err := db.createBucket(name); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// CreateSession records a session in the first stripe and gives it a key
+// index in every stripe, so an ephemeral key and its index entry are always
+// written in one transaction. The record is written last, a session whose
+// creation failed is never restored.
+func (db *Database) CreateSession(id string, heartbeatInterval time.Duration) error {
+	err := db.meta().View(func(tx *bolt.Tx) error {
+		if tx.Bucket([]byte(sessionsBucketName)).Get([]byte(id)) != nil {
+			return fmt.Errorf("session %s already exists", id)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, stripe := range db.stripes {
+		err := db.update(stripe, func(tx *bolt.Tx) error {
+			_, err := tx.Bucket([]byte(sessionKeysBucketName)).CreateBucketIfNotExists([]byte(id))
+			return err
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return db.update(db.meta(), func(tx *bolt.Tx) error {
+		sessions := tx.Bucket([]byte(sessionsBucketName))
+		if sessions.Get([]byte(id)) != nil {
+			return fmt.Errorf("session %s already exists", id)
+		}
+
+		encoded := make([]byte, 8)
+		binary.BigEndian.PutUint64(encoded, uint64(heartbeatInterval))
+		return sessions.Put([]byte(id), encoded)
+	})
+}
+
+func (db *Database) Sessions() (map[string]time.Duration, error) {
+	sessions := make(map[string]time.Duration)
+
+	err := db.meta().View(func(tx *bolt.Tx) error {
+		return tx.Bucket([]byte(sessionsBucketName)).ForEach(func(k, v []byte) error {
+			if len(v) != 8 {
+				return fmt.Errorf("corrupted session record for %s", k)
+			}
+			sessions[string(k)] = time.Duration(binary.BigEndian.Uint64(v))
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return sessions, nil
+}
+
+// SetEphemeralKey stores a plain value owned by a session. written, when not
+// nil, is called inside the write transaction once the value is stored.
+func (db *Database) SetEphemeralKey(session string, key string, value []byte, written func()) error {
+	return db.write(db.stripe(key), func(tx *bolt.Tx, changes *changeSet) error {
+		sessionKeys := tx.Bucket([]byte(sessionKeysBucketName)).Bucket([]byte(session))
+		if sessionKeys == nil {
+			return ErrSessionNotFound
+		}
+		changes.touch(NamespaceData, []byte(key))
+
+		data := tx.Bucket([]byte(defaultBucketName))
+		if _, valueType := lookupKey(data, []byte(key)); valueType != TypeNone && valueType != TypeString {
+			return ErrWrongType
+		}
+
+		if err := releaseEphemeralKey(tx, key); err != nil {
+			return err
+		}
+
+		if err := data.Put([]byte(key), value); err != nil {
+			return err
+		}
+
+		if err := tx.Bucket([]byte(ephemeralKeysBucketName)).Put([]byte(key), []byte(session)); err != nil {
+			return err
+		}
+
+		if err := sessionKeys.Put([]byte(key), []byte{}); err != nil {
+			return err
+		}
+
+		if written != nil {
+			written()
+		}
+		return nil
+	})
+}
+
+// DeleteSession deletes the ephemeral keys of a session stripe by stripe and
+// then its record, a failure in between leaves the record to retry with.
+func (db *Database) DeleteSession(session string) ([]string, error) {
+	var deleted []string
+	found := false
+
+	for _, stripe := range db.stripes {
+		err := db.write(stripe, func(tx *bolt.Tx, changes *changeSet) error {
+			allSessionKeys := tx.Bucket([]byte(sessionKeysBucketName))
+			sessionKeys := allSessionKeys.Bucket([]byte(session))
+			if sessionKeys == nil {
+				return nil
+			}
+			found = true
+
+			data := tx.Bucket([]byte(defaultBucketName))
+			ephemeral := tx.Bucket([]byte(ephemeralKeysBucketName))
+
+			err := sessionKeys.ForEach(func(k, _ []byte) error {
+				if string(ephemeral.Get(k)) != session {
+					return nil
+				}
+				if err := ephemeral.Delete(k); err != nil {
+					return err
+				}
+				deleted = append(deleted, string(k))
+				changes.touch(NamespaceData, k)
+				return data.Delete(k)
+			})
+			if err != nil {
+				return err
+			}
+
+			return allSessionKeys.DeleteBucket([]byte(session))
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	err := db.update(db.meta(), func(tx *bolt.Tx) error {
+		sessions := tx.Bucket([]byte(sessionsBucketName))
+		if sessions.Get([]byte(session)) != nil {
+			found = true
+		}
+
+		return sessions.Delete([]byte(session))
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if !found {
+		return nil, ErrSessionNotFound
+	}
+
+	return deleted, nil
+}
+
+func releaseEphemeralKey(tx *bolt.Tx, key string) error {
+	ephemeral := tx.Bucket([]byte(ephemeralKeysBucketName))
+
+	owner := ephemeral.Get([]byte(key))
+	if owner == nil {
+		return nil
+	}
+
+	if sessionKeys := tx.Bucket([]byte(sessionKeysBucketName)).Bucket(owner); sessionKeys != nil {
+		if err := sessionKeys.Delete([]byte(key)); err != nil {
+			return err
+		}
+	}
+
+	return ephemeral.Delete([]byte(key))
+}
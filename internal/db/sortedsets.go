@@ -0,0 +1,287 @@
+package db
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"math"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+var ErrInvalidScore = errors.New("score is not a number")
+
+type ScoredMember struct {
+	Member []byte
+	Score  float64
+}
+
+func (db *Database) SortedSetAdd(key string, members []ScoredMember) (int, error) {
+	for _, member := range members {
+		if math.IsNaN(member.Score) {
+			return 0, ErrInvalidScore
+		}
+	}
+
+	added := 0
+
+	err := db.write(db.stripe(key), func(tx *bolt.Tx, changes *changeSet) error {
+		c, err := createCollection(tx, key, TypeSortedSet)
+		if err != nil {
+			return err
+		}
+
+		for _, member := range members {
+			changes.touchField(NamespaceData, []byte(key), member.Member)
+
+			if previous := c.items.Get(member.Member); previous != nil {
+				if err := c.scores.Delete(scoreIndexKey(previous, member.Member)); err != nil {
+					return err
+				}
+			} else {
+				added++
+			}
+
+			encoded := encodeScore(member.Score)
+			if err := c.items.Put(member.Member, encoded); err != nil {
+				return err
+			}
+			if err := c.scores.Put(scoreIndexKey(encoded, member.Member), []byte{}); err != nil {
+				return err
+			}
+		}
+
+		if err := c.setLength(c.length() + uint64(added)); err != nil {
+			return err
+		}
+
+		return dropIfEmpty(tx, key, c)
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return added, nil
+}
+
+func (db *Database) SortedSetRemove(key string, members [][]byte) (int, error) {
+	removed := 0
+
+	err := db.write(db.stripe(key), func(tx *bolt.Tx, changes *changeSet) error {
+		c, err := openCollection(tx, key, TypeSortedSet)
+		if err != nil || c == nil {
+			return err
+		}
+
+		for _, member := range members {
+			encoded := c.items.Get(member)
+			if encoded == nil {
+				continue
+			}
+			changes.touchField(NamespaceData, []byte(key), member)
+
+			if err := c.scores.Delete(scoreIndexKey(encoded, member)); err != nil {
+				return err
+			}
+			if err := c.items.Delete(member); err != nil {
+				return err
+			}
+			removed++
+		}
+
+		if err := c.setLength(c.length() - uint64(removed)); err != nil {
+			return err
+		}
+
+		return dropIfEmpty(tx, key, c)
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return removed, nil
+}
+
+// SortedSetRank returns the zero based position of member ordered by ascending
+// score, or by descending score when reverse is set.
+func (db *Database) SortedSetRank(key string, member []byte, reverse bool) (int64, float64, bool, error) {
+	var rank int64
+	var score float64
+	var found bool
+
+	err := db.stripe(key).View(func(tx *bolt.Tx) error {
+		c, err := openCollection(tx, key, TypeSortedSet)
+		if err != nil || c == nil {
+			return err
+		}
+
+		encoded := c.items.Get(member)
+		if encoded == nil {
+			return nil
+		}
+
+		target := scoreIndexKey(encoded, member)
+		cursor := c.scores.Cursor()
+		for k, _ := cursor.First(); k != nil && !bytes.Equal(k, target); k, _ = cursor.Next() {
+			rank++
+		}
+
+		if reverse {
+			rank = int64(c.length()) - 1 - rank
+		}
+		score = decodeScore(encoded)
+		found = true
+		return nil
+	})
+	if err != nil {
+		return 0, 0, false, err
+	}
+
+	return rank, score, found, nil
+}
+
+// SortedSetRangeByRank follows the same inclusive, negative-aware index
+// semantics as ListRange.
+func (db *Database) SortedSetRangeByRank(key string, start int64, stop int64, reverse bool) ([]ScoredMember, error) {
+	var members []ScoredMember
+
+	err := db.stripe(key).View(func(tx *bolt.Tx) error {
+		c, err := openCollection(tx, key, TypeSortedSet)
+		if err != nil || c == nil {
+			return err
+		}
+
+		start, stop, ok := normalizeRange(start, stop, int64(c.length()))
+		if !ok {
+			return nil
+		}
+
+		cursor := c.scores.Cursor()
+		first, next := cursor.First, cursor.Next
+		if reverse {
+			first, next = cursor.Last, cursor.Prev
+		}
+
+		index := int64(0)
+		for k, _ := first(); k != nil && index <= stop; k, _ = next() {
+			if index >= start {
+				members = append(members, decodeScoreIndexKey(k))
+			}
+			index++
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return members, nil
+}
+
+// SortedSetRangeByScore returns members with min <= score <= max, skipping
+// offset matches and returning at most limit of them when limit is positive.
+func (db *Database) SortedSetRangeByScore(key string, min float64, max float64, offset int64, limit int64, reverse bool) ([]ScoredMember, error) {
+	if math.IsNaN(min) || math.IsNaN(max) {
+		return nil, ErrInvalidScore
+	}
+
+	var members []ScoredMember
+
+	err := db.stripe(key).View(func(tx *bolt.Tx) error {
+		c, err := openCollection(tx, key, TypeSortedSet)
+		if err != nil || c == nil || min > max {
+			return err
+		}
+
+		lower := encodeScore(min)
+		upper := encodeScore(max)
+
+		cursor := c.scores.Cursor()
+		var k []byte
+		var next func() ([]byte, []byte)
+		var inRange func(score []byte) bool
+
+		if reverse {
+			k = seekLastAtOrBelow(cursor, upper)
+			next = cursor.Prev
+			inRange = func(score []byte) bool { return bytes.Compare(score, lower) >= 0 }
+		} else {
+			k, _ = cursor.Seek(lower)
+			next = cursor.Next
+			inRange = func(score []byte) bool { return bytes.Compare(score, upper) <= 0 }
+		}
+
+		skipped := int64(0)
+		for ; k != nil && inRange(k[:8]); k, _ = next() {
+			if skipped < offset {
+				skipped++
+				continue
+			}
+			if limit > 0 && int64(len(members)) >= limit {
+				break
+			}
+			members = append(members, decodeScoreIndexKey(k))
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return members, nil
+}
+
+func seekLastAtOrBelow(cursor *bolt.Cursor, encodedScore []byte) []byte {
+	bound := binary.BigEndian.Uint64(encodedScore)
+	if bound == math.MaxUint64 {
+		k, _ := cursor.Last()
+		return k
+	}
+
+	if k, _ := cursor.Seek(encodeUint64(bound + 1)); k == nil {
+		k, _ = cursor.Last()
+		return k
+	}
+
+	k, _ := cursor.Prev()
+	return k
+}
+
+// encodeScore maps a float64 onto 8 bytes whose big endian ordering matches
+// the numeric ordering of the scores, so score ranges become cursor scans.
+func encodeScore(score float64) []byte {
+	bits := math.Float64bits(score)
+	if bits&(1<<63) != 0 {
+		bits = ^bits
+	} else {
+		bits |= 1 << 63
+	}
+
+	return encodeUint64(bits)
+}
+
+func decodeScore(encoded []byte) float64 {
+	bits := binary.BigEndian.Uint64(encoded)
+	if bits&(1<<63) != 0 {
+		bits &^= 1 << 63
+	} else {
+		bits = ^bits
+	}
+
+	return math.Float64frombits(bits)
+}
+
+func scoreIndexKey(encodedScore []byte, member []byte) []byte {
+	k := make([]byte, 0, len(encodedScore)+len(member))
+	k = append(k, encodedScore...)
+	return append(k, member...)
+}
+
+func decodeScoreIndexKey(k []byte) ScoredMember {
+	return ScoredMember{
+		Member: bytes.Clone(k[8:]),
+		Score:  decodeScore(k[:8]),
+	}
+}
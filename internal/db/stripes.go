@@ -0,0 +1,238 @@
+package db
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/thenonexistent/nilis/pkg/sharding"
+	bolt "go.etcd.io/bbolt"
+)
+
+const (
+	stripesKey     = "stripes"
+	stripeIndexKey = "stripe_index"
+)
+
+// stripePath returns the file of a stripe, the first stripe keeps the path of
+// the database so databases created before striping open unchanged.
+func stripePath(path string, index int) string {
+	if index == 0 {
+		return path
+	}
+
+	return fmt.Sprintf("%s.%d", path, index)
+}
+
+// stripeCount returns the stripe count recorded in the first stripe, or the
+// requested one and true when the database is new. A database holding data
+// without a recorded count predates striping and has a single stripe.
+func stripeCount(first *bolt.DB, requested int) (int, bool, error) {
+	count := requested
+	created := true
+
+	err := first.View(func(tx *bolt.Tx) error {
+		if system := tx.Bucket([]byte(systemBucketName)); system != nil {
+			if raw := system.Get([]byte(stripesKey)); raw != nil {
+				if len(raw) != 8 {
+					return errors.New("corrupted stripe count")
+				}
+				count = int(binary.BigEndian.Uint64(raw))
+				created = false
+				return nil
+			}
+		}
+
+		if tx.Bucket([]byte(defaultBucketName)) != nil {
+			count = 1
+			created = false
+		}
+
+		return nil
+	})
+	if err != nil {
+		return 0, false, err
+	}
+
+	if count < 1 {
+		return 0, false, fmt.Errorf("invalid stripe count: %d", count)
+	}
+
+	return count, created, nil
+}
+
+// recordCreation fixes the stripe count and metadata of the database, they
+// are written last so a database whose creation was interrupted is created
+// again.
+func recordCreation(first *bolt.DB, count int, metadata map[string]string) error {
+	return first.Update(func(tx *bolt.Tx) error {
+		if err := putMetadata(tx, metadata); err != nil {
+			return err
+		}
+
+		return tx.Bucket([]byte(systemBucketName)).Put([]byte(stripesKey), encodeUint64(uint64(count)))
+	})
+}
+
+func openStripe(path string, index int, count int, created bool) (*bolt.DB, error) {
+	file := stripePath(path, index)
+
+	if !created {
+		if _, err := os.Stat(file); err != nil {
+			return nil, fmt.Errorf("stripe %d of %d is missing: %w", index, count, err)
+		}
+	}
+
+	return bolt.Open(file, 0600, nil)
+}
+
+// markStripe records the position of a stripe in its own file and checks it on
+// later opens, so files that were swapped or left over from another database
+// are never served.
+func markStripe(stripe *bolt.DB, index int, count int, created bool) error {
+	return stripe.Update(func(tx *bolt.Tx) error {
+		system, err := tx.CreateBucketIfNotExists([]byte(systemBucketName))
+		if err != nil {
+			return err
+		}
+
+		file := filepath.Base(stripe.Path())
+
+		raw := system.Get([]byte(stripeIndexKey))
+		if raw == nil {
+			if !created && index > 0 {
+				return fmt.Errorf("%s is not a stripe of this database", file)
+			}
+			return system.Put([]byte(stripeIndexKey), encodeStripe(index, count))
+		}
+
+		if !bytes.Equal(raw, encodeStripe(index, count)) {
+			return fmt.Errorf("%s is not stripe %d of %d", file, index, count)
+		}
+
+		return nil
+	})
+}
+
+func encodeStripe(index int, count int) []byte {
+	encoded := make([]byte, 16)
+	binary.BigEndian.PutUint64(encoded[0:8], uint64(index))
+	binary.BigEndian.PutUint64(encoded[8:16], uint64(count))
+	return encoded
+}
+
+// Stripes returns the number of files the keyspace is spread across.
+func (db *Database) Stripes() int {
+	return len(db.stripes)
+}
+
+// stripeSeed salts the stripe hash. Shards place keys by a hash modulo the
+// shard count as well, unsalted every shard would only ever fill the stripes
+// matching its own id.
+const stripeSeed = 0x6e696c6973747270
+
+// stripe returns the file holding a key. The placement must never change, as
+// the stripe count is fixed for the lifetime of a database.
+func (db *Database) stripe(key string) *bolt.DB {
+	if len(db.stripes) == 1 {
+		return db.stripes[0]
+	}
+
+	h := fnv.New64a()
+	h.Write([]byte(key))
+	return db.stripes[sharding.Mix64(h.Sum64()^stripeSeed)%uint64(len(db.stripes))]
+}
+
+// meta returns the stripe holding system values and session records.
+func (db *Database) meta() *bolt.DB {
+	return db.stripes[0]
+}
+
+// update runs a write transaction on a stripe, writers of different stripes
+// run in parallel.
+func (db *Database) update(stripe *bolt.DB, fn func(tx *bolt.Tx) error) error {
+	db.writers.RLock()
+	defer db.writers.RUnlock()
+
+	return stripe.Update(fn)
+}
+
+// groupByStripe splits items by the stripe holding their key, keeping their
+// order.
+func groupByStripe[T any](db *Database, items []T, key func(T) string) map[*bolt.DB][]T {
+	groups := make(map[*bolt.DB][]T)
+	for _, item := range items {
+		stripe := db.stripe(key(item))
+		groups[stripe] = append(groups[stripe], item)
+	}
+
+	return groups
+}
+
+func stringKey(key string) string {
+	return key
+}
+
+// Backup writes a copy of every stripe next to path, which can be opened as a
+// database afterwards. The copies are taken at one point in time across all
+// stripes, and the database stays writable while they are written. It returns
+// the number of bytes written.
+func (db *Database) Backup(path string) (int64, error) {
+	for index := range db.stripes {
+		if _, err := os.Stat(stripePath(path, index)); err == nil {
+			return 0, fmt.Errorf("backup file %s: %w", stripePath(path, index), os.ErrExist)
+		}
+	}
+
+	txs := make([]*bolt.Tx, 0, len(db.stripes))
+	defer func() {
+		for _, tx := range txs {
+			tx.Rollback()
+		}
+	}()
+
+	db.writers.Lock()
+	for _, stripe := range db.stripes {
+		tx, err := stripe.Begin(false)
+		if err != nil {
+			db.writers.Unlock()
+			return 0, err
+		}
+		txs = append(txs, tx)
+	}
+	db.writers.Unlock()
+
+	var written int64
+	for index, tx := range txs {
+		if err := tx.CopyFile(stripePath(path, index), 0600); err != nil {
+			return written, fmt.Errorf("failed copying stripe %d: %w", index, err)
+		}
+		written += tx.Size()
+	}
+
+	return written, nil
+}
+
+// mergeKeyValues merges the ordered results of every stripe into up to limit
+// entries in key order, and whether more entries follow.
+func mergeKeyValues(results [][]KeyValue, limit int) ([]KeyValue, bool) {
+	var merged []KeyValue
+	for _, result := range results {
+		merged = append(merged, result...)
+	}
+
+	sort.Slice(merged, func(i, j int) bool {
+		return merged[i].Key < merged[j].Key
+	})
+
+	if len(merged) > limit {
+		return merged[:limit], true
+	}
+
+	return merged, false
+}
@@ -0,0 +1,66 @@
+package db
+
+import (
+	"bytes"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+const systemBucketName = "system"
+
+func (db *Database) GetSystemValue(key string) ([]byte, error) {
+	var value []byte
+
+	err := db.meta().View(func(tx *bolt.Tx) error {
+		value = bytes.Clone(tx.Bucket([]byte(systemBucketName)).Get([]byte(key)))
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return value, nil
+}
+
+func (db *Database) SetSystemValue(key string, value []byte) error {
+	return db.update(db.meta(), func(tx *bolt.Tx) error {
+		return tx.Bucket([]byte(systemBucketName)).Put([]byte(key), value)
+	})
+}
+
+func (db *Database) DeleteSystemValue(key string) error {
+	return db.update(db.meta(), func(tx *bolt.Tx) error {
+		return tx.Bucket([]byte(systemBucketName)).Delete([]byte(key))
+	})
+}
+
+// SystemKeys returns the keys of the system values starting with prefix.
+func (db *Database) SystemKeys(prefix string) ([]string, error) {
+	var keys []string
+
+	err := db.meta().View(func(tx *bolt.Tx) error {
+		cursor := tx.Bucket([]byte(systemBucketName)).Cursor()
+		for k, _ := cursor.Seek([]byte(prefix)); k != nil && bytes.HasPrefix(k, []byte(prefix)); k, _ = cursor.Next() {
+			keys = append(keys, string(k))
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return keys, nil
+}
+
+// DeleteSystemKeys deletes every system value starting with prefix.
+func (db *Database) DeleteSystemKeys(prefix string) error {
+	return db.update(db.meta(), func(tx *bolt.Tx) error {
+		cursor := tx.Bucket([]byte(systemBucketName)).Cursor()
+		for k, _ := cursor.Seek([]byte(prefix)); k != nil && bytes.HasPrefix(k, []byte(prefix)); k, _ = cursor.Seek([]byte(prefix)) {
+			if err := cursor.Delete(); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
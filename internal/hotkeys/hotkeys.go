@@ -0,0 +1,253 @@
+package hotkeys
+
+import (
+	"container/heap"
+	"math/rand/v2"
+	"sort"
+	"sync"
+	"time"
+)
+
+type Op int
+
+const (
+	Read Op = iota
+	Write
+)
+
+type Order string
+
+const (
+	ByTotal  Order = "total"
+	ByReads  Order = "reads"
+	ByWrites Order = "writes"
+)
+
+type Config struct {
+	// Capacity is the number of keys counted per bucket and operation, keys
+	// beyond it replace the least counted one.
+	Capacity   int
+	Window     time.Duration
+	Buckets    int
+	SampleRate float64
+}
+
+// KeyStats holds the estimated accesses of a key, scaled up from the sample.
+type KeyStats struct {
+	Key    string
+	Reads  uint64
+	Writes uint64
+}
+
+// Detector estimates the most accessed keys of a sliding window by running
+// the space-saving algorithm over a sample of the accesses. The window is
+// split into buckets that expire one at a time, so it covers between
+// Window-Window/Buckets and Window of history.
+type Detector struct {
+	config Config
+	width  time.Duration
+
+	mu      sync.Mutex
+	buckets []bucket
+	current int
+	start   time.Time
+}
+
+type bucket struct {
+	reads  *summary
+	writes *summary
+}
+
+func NewDetector(config Config) *Detector {
+	d := &Detector{
+		config:  config,
+		width:   config.Window / time.Duration(config.Buckets),
+		buckets: make([]bucket, config.Buckets),
+		start:   time.Now(),
+	}
+
+	for i := range d.buckets {
+		d.buckets[i] = bucket{
+			reads:  newSummary(config.Capacity),
+			writes: newSummary(config.Capacity),
+		}
+	}
+
+	return d
+}
+
+// Sample decides whether an access is recorded, callers skip any further
+// work for accesses that are not.
+func (d *Detector) Sample() bool {
+	return d.config.SampleRate >= 1 || rand.Float64() < d.config.SampleRate
+}
+
+func (d *Detector) Record(key string, op Op) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.advance(time.Now())
+
+	b := d.buckets[d.current]
+	if op == Read {
+		b.reads.add(key)
+	} else {
+		b.writes.add(key)
+	}
+}
+
+// Top returns up to n keys of the window with the most accesses in order.
+func (d *Detector) Top(n int, order Order) []KeyStats {
+	d.mu.Lock()
+	d.advance(time.Now())
+
+	merged := make(map[string]*KeyStats)
+	stats := func(key string) *KeyStats {
+		if _, ok := merged[key]; !ok {
+			merged[key] = &KeyStats{Key: key}
+		}
+		return merged[key]
+	}
+
+	for _, b := range d.buckets {
+		for key, c := range b.reads.counters {
+			stats(key).Reads += c.count
+		}
+		for key, c := range b.writes.counters {
+			stats(key).Writes += c.count
+		}
+	}
+	d.mu.Unlock()
+
+	out := make([]KeyStats, 0, len(merged))
+	for _, s := range merged {
+		s.Reads = d.scale(s.Reads)
+		s.Writes = d.scale(s.Writes)
+		out = append(out, *s)
+	}
+
+	rank := func(s KeyStats) uint64 {
+		switch order {
+		case ByReads:
+			return s.Reads
+		case ByWrites:
+			return s.Writes
+		default:
+			return s.Reads + s.Writes
+		}
+	}
+
+	sort.Slice(out, func(i, j int) bool {
+		if ri, rj := rank(out[i]), rank(out[j]); ri != rj {
+			return ri > rj
+		}
+		return out[i].Key < out[j].Key
+	})
+
+	for len(out) > 0 && rank(out[len(out)-1]) == 0 {
+		out = out[:len(out)-1]
+	}
+
+	return out[:min(n, len(out))]
+}
+
+func (d *Detector) Window() time.Duration {
+	return d.config.Window
+}
+
+func (d *Detector) SampleRate() float64 {
+	return d.config.SampleRate
+}
+
+func (d *Detector) scale(count uint64) uint64 {
+	return uint64(float64(count) / min(d.config.SampleRate, 1))
+}
+
+// advance moves to the bucket covering now, clearing the buckets it expires.
+func (d *Detector) advance(now time.Time) {
+	steps := int(now.Sub(d.start) / d.width)
+	if steps <= 0 {
+		return
+	}
+
+	for i := 0; i < min(steps, len(d.buckets)); i++ {
+		d.current = (d.current + 1) % len(d.buckets)
+		d.buckets[d.current].reads.reset()
+		d.buckets[d.current].writes.reset()
+	}
+
+	d.start = d.start.Add(time.Duration(steps) * d.width)
+}
+
+type counter struct {
+	key   string
+	count uint64
+	index int
+}
+
+// summary implements the space-saving algorithm, its counts overestimate a
+// key by at most the count of the key it replaced.
+type summary struct {
+	capacity int
+	counters map[string]*counter
+	order    counterHeap
+}
+
+func newSummary(capacity int) *summary {
+	return &summary{
+		capacity: capacity,
+		counters: make(map[string]*counter, capacity),
+	}
+}
+
+func (s *summary) add(key string) {
+	if c, ok := s.counters[key]; ok {
+		c.count++
+		heap.Fix(&s.order, c.index)
+		return
+	}
+
+	if len(s.counters) < s.capacity {
+		c := &counter{key: key, count: 1}
+		s.counters[key] = c
+		heap.Push(&s.order, c)
+		return
+	}
+
+	c := s.order[0]
+	delete(s.counters, c.key)
+	c.key = key
+	c.count++
+	s.counters[key] = c
+	heap.Fix(&s.order, 0)
+}
+
+func (s *summary) reset() {
+	clear(s.counters)
+	s.order = s.order[:0]
+}
+
+type counterHeap []*counter
+
+func (h counterHeap) Len() int           { return len(h) }
+func (h counterHeap) Less(i, j int) bool { return h[i].count < h[j].count }
+
+func (h counterHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index = i
+	h[j].index = j
+}
+
+func (h *counterHeap) Push(x any) {
+	c := x.(*counter)
+	c.index = len(*h)
+	*h = append(*h, c)
+}
+
+func (h *counterHeap) Pop() any {
+	old := *h
+	c := old[len(old)-1]
+	old[len(old)-1] = nil
+	*h = old[:len(old)-1]
+	return c
+}
@@ -0,0 +1,455 @@
+// Package membership implements SWIM style failure detection. Every probe
+// interval a node pings one member, asks a few others to ping it on its
+// behalf when it does not answer, and only declares it dead after it stayed
+// suspect for the suspicion timeout. State changes are piggybacked on the
+// probe messages, so every node converges on the same view.
+package membership
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"math/rand/v2"
+	"sort"
+	"sync"
+	"time"
+)
+
+type State int
+
+const (
+	StateAlive State = iota
+	StateSuspect
+	StateDead
+)
+
+func (s State) String() string {
+	switch s {
+	case StateAlive:
+		return "alive"
+	case StateSuspect:
+		return "suspect"
+	case StateDead:
+		return "dead"
+	default:
+		return fmt.Sprintf("unknown(%d)", int(s))
+	}
+}
+
+func ParseState(name string) (State, error) {
+	switch name {
+	case "alive":
+		return StateAlive, nil
+	case "suspect":
+		return StateSuspect, nil
+	case "dead":
+		return StateDead, nil
+	default:
+		return 0, fmt.Errorf("unknown member state: %s", name)
+	}
+}
+
+const (
+	maxPiggyback   = 8
+	retransmitMult = 3
+)
+
+type Member struct {
+	Address     string
+	State       State
+	Incarnation uint64
+	Since       time.Time
+}
+
+type Config struct {
+	Address string
+	// Peers returns the addresses to watch, it is called every probe interval
+	// so members follow topology changes.
+	Peers     func() []string
+	Transport Transport
+
+	ProbeInterval    time.Duration
+	ProbeTimeout     time.Duration
+	IndirectProbes   int
+	SuspicionTimeout time.Duration
+
+	// OnChange is called without locks held whenever a member changes state.
+	OnChange func(Member)
+}
+
+type Node struct {
+	config Config
+
+	mu          sync.Mutex
+	incarnation uint64
+	members     map[string]*Member
+	order       []string
+	next        int
+	broadcasts  map[string]*broadcast
+}
+
+type broadcast struct {
+	update    Update
+	transmits int
+}
+
+func NewNode(config Config) *Node {
+	// a restarted node starts with a higher incarnation than any it used
+	// before, so its aliveness wins over old suspicions about it
+	return &Node{
+		config:      config,
+		incarnation: uint64(time.Now().UnixNano()),
+		members:     make(map[string]*Member),
+		broadcasts:  make(map[string]*broadcast),
+	}
+}
+
+func (n *Node) Run(ctx context.Context) {
+	ticker := time.NewTicker(n.config.ProbeInterval)
+	defer ticker.Stop()
+
+	for {
+		n.syncPeers()
+		n.expireSuspects()
+		n.probe(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// State returns the state of a member, members not watched yet count as alive.
+func (n *Node) State(address string) State {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	if m, ok := n.members[address]; ok {
+		return m.State
+	}
+	return StateAlive
+}
+
+func (n *Node) Members() []Member {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	out := make([]Member, 0, len(n.members))
+	for _, m := range n.members {
+		out = append(out, *m)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Address < out[j].Address })
+
+	return out
+}
+
+func (n *Node) Incarnation() uint64 {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	return n.incarnation
+}
+
+func (n *Node) HandlePing(msg Message) Message {
+	n.merge(msg)
+	return n.message()
+}
+
+// HandlePingReq probes target for a member that could not reach it and
+// relays the answer.
+func (n *Node) HandlePingReq(ctx context.Context, target string, msg Message) (Message, error) {
+	n.merge(msg)
+
+	ack, err := n.config.Transport.Ping(ctx, target, n.message())
+	if err != nil {
+		return Message{}, err
+	}
+
+	n.merge(ack)
+	return ack, nil
+}
+
+func (n *Node) syncPeers() {
+	peers := make(map[string]struct{})
+	for _, address := range n.config.Peers() {
+		if address != n.config.Address {
+			peers[address] = struct{}{}
+		}
+	}
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	for address := range n.members {
+		if _, ok := peers[address]; !ok {
+			delete(n.members, address)
+			delete(n.broadcasts, address)
+		}
+	}
+
+	for address := range peers {
+		if _, ok := n.members[address]; !ok {
+			n.members[address] = &Member{Address: address, State: StateAlive, Since: time.Now()}
+		}
+	}
+}
+
+func (n *Node) probe(ctx context.Context) {
+	target := n.nextTarget()
+	if target == "" {
+		return
+	}
+
+	pingCtx, cancel := context.WithTimeout(ctx, n.config.ProbeTimeout)
+	ack, err := n.config.Transport.Ping(pingCtx, target, n.message())
+	cancel()
+
+	if err == nil {
+		n.merge(ack)
+		return
+	}
+
+	if ctx.Err() != nil {
+		return
+	}
+
+	if ack, ok := n.probeIndirect(ctx, target); ok {
+		n.merge(ack)
+		return
+	}
+
+	n.suspect(target)
+}
+
+func (n *Node) probeIndirect(ctx context.Context, target string) (Message, bool) {
+	helpers := n.randomAlive(n.config.IndirectProbes, target)
+	if len(helpers) == 0 {
+		return Message{}, false
+	}
+
+	timeout := max(n.config.ProbeInterval-n.config.ProbeTimeout, n.config.ProbeTimeout)
+	indirectCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	acks := make(chan Message, len(helpers))
+	var wg sync.WaitGroup
+
+	for _, helper := range helpers {
+		wg.Add(1)
+		go func(helper string) {
+			defer wg.Done()
+
+			ack, err := n.config.Transport.PingReq(indirectCtx, helper, target, n.message())
+			if err == nil {
+				acks <- ack
+			}
+		}(helper)
+	}
+
+	go func() {
+		wg.Wait()
+		close(acks)
+	}()
+
+	ack, ok := <-acks
+	return ack, ok
+}
+
+// nextTarget walks the members in a shuffled round robin, which bounds the
+// time until every member is probed. Dead members are probed too, so they
+// are noticed when they come back.
+func (n *Node) nextTarget() string {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	if len(n.members) == 0 {
+		return ""
+	}
+
+	for attempts := 0; attempts <= len(n.order); attempts++ {
+		if n.next >= len(n.order) {
+			n.order = n.order[:0]
+			for address := range n.members {
+				n.order = append(n.order, address)
+			}
+			rand.Shuffle(len(n.order), func(i, j int) {
+				n.order[i], n.order[j] = n.order[j], n.order[i]
+			})
+			n.next = 0
+		}
+
+		target := n.order[n.next]
+		n.next++
+
+		if _, ok := n.members[target]; ok {
+			return target
+		}
+	}
+
+	return ""
+}
+
+func (n *Node) randomAlive(count int, exclude string) []string {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	var candidates []string
+	for address, m := range n.members {
+		if address != exclude && m.State == StateAlive {
+			candidates = append(candidates, address)
+		}
+	}
+
+	rand.Shuffle(len(candidates), func(i, j int) {
+		candidates[i], candidates[j] = candidates[j], candidates[i]
+	})
+
+	return candidates[:min(count, len(candidates))]
+}
+
+func (n *Node) suspect(address string) {
+	n.mu.Lock()
+
+	m, ok := n.members[address]
+	if !ok || m.State != StateAlive {
+		n.mu.Unlock()
+		return
+	}
+
+	changed := n.setState(m, StateSuspect, m.Incarnation)
+	n.mu.Unlock()
+
+	n.notify(changed)
+}
+
+func (n *Node) expireSuspects() {
+	var changed []Member
+
+	n.mu.Lock()
+	for _, m := range n.members {
+		if m.State == StateSuspect && time.Since(m.Since) >= n.config.SuspicionTimeout {
+			changed = append(changed, n.setState(m, StateDead, m.Incarnation)...)
+		}
+	}
+	n.mu.Unlock()
+
+	n.notify(changed)
+}
+
+// merge applies the updates a message carries. Receiving a message from a
+// member directly also proves it is alive.
+func (n *Node) merge(msg Message) {
+	var changed []Member
+
+	n.mu.Lock()
+
+	if m, ok := n.members[msg.From]; ok && msg.Incarnation >= m.Incarnation {
+		if m.State != StateAlive || msg.Incarnation > m.Incarnation {
+			changed = append(changed, n.setState(m, StateAlive, msg.Incarnation)...)
+		}
+	}
+
+	for _, update := range msg.Updates {
+		changed = append(changed, n.apply(update)...)
+	}
+
+	n.mu.Unlock()
+
+	n.notify(changed)
+}
+
+func (n *Node) apply(update Update) []Member {
+	if update.Address == n.config.Address {
+		// refute suspicion about ourselves by outliving its incarnation
+		if update.State != StateAlive && update.Incarnation >= n.incarnation {
+			n.incarnation = update.Incarnation + 1
+			n.queue(Update{Address: n.config.Address, State: StateAlive, Incarnation: n.incarnation})
+		}
+		return nil
+	}
+
+	m, ok := n.members[update.Address]
+	if !ok {
+		return nil
+	}
+
+	var overrides bool
+	switch update.State {
+	case StateAlive:
+		overrides = update.Incarnation > m.Incarnation
+	case StateSuspect:
+		overrides = update.Incarnation > m.Incarnation ||
+			(update.Incarnation == m.Incarnation && m.State == StateAlive)
+	case StateDead:
+		overrides = update.Incarnation > m.Incarnation ||
+			(update.Incarnation == m.Incarnation && m.State != StateDead)
+	}
+
+	if !overrides {
+		return nil
+	}
+
+	return n.setState(m, update.State, update.Incarnation)
+}
+
+func (n *Node) setState(m *Member, state State, incarnation uint64) []Member {
+	stateChanged := m.State != state
+
+	m.Incarnation = incarnation
+	if stateChanged {
+		m.State = state
+		m.Since = time.Now()
+	}
+
+	n.queue(Update{Address: m.Address, State: state, Incarnation: incarnation})
+
+	if !stateChanged {
+		return nil
+	}
+	return []Member{*m}
+}
+
+func (n *Node) queue(update Update) {
+	n.broadcasts[update.Address] = &broadcast{update: update}
+}
+
+func (n *Node) notify(changed []Member) {
+	if n.config.OnChange == nil {
+		return
+	}
+
+	for _, m := range changed {
+		n.config.OnChange(m)
+	}
+}
+
+// message builds an outgoing message carrying the least transmitted updates.
+// Each update is sent a few times per doubling of the cluster size, enough
+// for it to reach every member with high probability.
+func (n *Node) message() Message {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	msg := Message{From: n.config.Address, Incarnation: n.incarnation}
+
+	pending := make([]*broadcast, 0, len(n.broadcasts))
+	for _, b := range n.broadcasts {
+		pending = append(pending, b)
+	}
+	sort.Slice(pending, func(i, j int) bool { return pending[i].transmits < pending[j].transmits })
+
+	limit := retransmitMult * int(math.Ceil(math.Log2(float64(len(n.members)+2))))
+
+	for _, b := range pending[:min(maxPiggyback, len(pending))] {
+		msg.Updates = append(msg.Updates, b.update)
+
+		b.transmits++
+		if b.transmits >= limit {
+			delete(n.broadcasts, b.update.Address)
+		}
+	}
+
+	return msg
+}
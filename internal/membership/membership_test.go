@@ -0,0 +1,231 @@
+package membership
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+)
+
+const (
+	testProbeInterval    = 10 * time.Millisecond
+	testSuspicionTimeout = 200 * time.Millisecond
+	testDeadline         = 10 * time.Second
+)
+
+// transitions records the state changes every node observed.
+type transitions struct {
+	mu      sync.Mutex
+	changes map[string][]Update
+}
+
+func (r *transitions) record(observer string, m Member) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.changes[observer] = append(r.changes[observer], Update{Address: m.Address, State: m.State, Incarnation: m.Incarnation})
+}
+
+// states returns the states observer saw address enter, in order.
+func (r *transitions) states(observer string, address string) []State {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var states []State
+	for _, change := range r.changes[observer] {
+		if change.Address == address {
+			states = append(states, change.State)
+		}
+	}
+	return states
+}
+
+type testCluster struct {
+	network     *MemoryNetwork
+	nodes       map[string]*Node
+	transitions *transitions
+}
+
+func newTestCluster(t *testing.T, size int, loss float64) *testCluster {
+	t.Helper()
+
+	var addresses []string
+	for i := 0; i < size; i++ {
+		addresses = append(addresses, fmt.Sprintf("node-%d", i))
+	}
+
+	c := &testCluster{
+		network:     NewMemoryNetwork(loss),
+		nodes:       make(map[string]*Node),
+		transitions: &transitions{changes: make(map[string][]Update)},
+	}
+
+	for _, address := range addresses {
+		node := NewNode(Config{
+			Address:          address,
+			Peers:            func() []string { return addresses },
+			Transport:        c.network.Transport(address),
+			ProbeInterval:    testProbeInterval,
+			ProbeTimeout:     testProbeInterval / 2,
+			IndirectProbes:   3,
+			SuspicionTimeout: testSuspicionTimeout,
+			OnChange: func(m Member) {
+				c.transitions.record(address, m)
+			},
+		})
+		node.syncPeers()
+
+		c.network.Register(address, node)
+		c.nodes[address] = node
+	}
+
+	return c
+}
+
+func (c *testCluster) run(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	var wg sync.WaitGroup
+	for _, node := range c.nodes {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			node.Run(ctx)
+		}()
+	}
+
+	t.Cleanup(func() {
+		cancel()
+		wg.Wait()
+	})
+}
+
+// converged reports whether every node that is up sees address in state.
+func (c *testCluster) converged(address string, state State, down ...string) bool {
+	for observer, node := range c.nodes {
+		if observer == address || slices.Contains(down, observer) {
+			continue
+		}
+		if node.State(address) != state {
+			return false
+		}
+	}
+	return true
+}
+
+func (c *testCluster) allAlive() bool {
+	for address := range c.nodes {
+		if !c.converged(address, StateAlive) {
+			return false
+		}
+	}
+	return true
+}
+
+func eventually(t *testing.T, what string, condition func() bool) {
+	t.Helper()
+
+	deadline := time.Now().Add(testDeadline)
+	for !condition() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting until %s", what)
+		}
+		time.Sleep(testProbeInterval)
+	}
+}
+
+func TestConvergesUnderPacketLoss(t *testing.T) {
+	c := newTestCluster(t, 5, 0.1)
+	c.run(t)
+
+	// lost probes cause false suspicions, which are refuted
+	time.Sleep(20 * testProbeInterval)
+
+	eventually(t, "all members are alive everywhere", c.allAlive)
+}
+
+func TestFailedMemberSuspectedThenDead(t *testing.T) {
+	c := newTestCluster(t, 5, 0.1)
+	c.run(t)
+
+	eventually(t, "all members are alive everywhere", c.allAlive)
+
+	failed := "node-4"
+	c.network.SetDown(failed, true)
+
+	eventually(t, "the failed member is dead everywhere", func() bool {
+		return c.converged(failed, StateDead, failed)
+	})
+
+	// the first node to notice suspects the member itself, the others may
+	// learn about the suspicion and the death from gossip in one go
+	var suspected bool
+	for observer := range c.nodes {
+		if observer == failed {
+			continue
+		}
+
+		states := c.transitions.states(observer, failed)
+		if len(states) == 0 || states[len(states)-1] != StateDead {
+			t.Fatalf("%s saw %s go through %v, want it to end dead", observer, failed, states)
+		}
+		if len(states) >= 2 && states[len(states)-2] == StateSuspect {
+			suspected = true
+		}
+	}
+	if !suspected {
+		t.Fatalf("no member suspected %s before declaring it dead", failed)
+	}
+
+	c.network.SetDown(failed, false)
+
+	eventually(t, "the recovered member is alive everywhere", func() bool {
+		return c.converged(failed, StateAlive)
+	})
+}
+
+func TestSuspicionRefuted(t *testing.T) {
+	c := newTestCluster(t, 5, 0.1)
+
+	accused, accuser := "node-0", "node-1"
+	incarnation := c.nodes[accused].Incarnation()
+
+	// the accuser believes a rumour about the accused and gossips it
+	c.nodes[accuser].merge(Message{
+		From:    "node-2",
+		Updates: []Update{{Address: accused, State: StateSuspect, Incarnation: incarnation}},
+	})
+	if state := c.nodes[accuser].State(accused); state != StateSuspect {
+		t.Fatalf("accuser sees %s as %s, want suspect", accused, state)
+	}
+
+	c.nodes[accused].HandlePing(c.nodes[accuser].message())
+
+	refuted := c.nodes[accused].Incarnation()
+	if refuted <= incarnation {
+		t.Fatalf("incarnation of %s is %d, want it raised above %d to refute the suspicion", accused, refuted, incarnation)
+	}
+
+	c.run(t)
+
+	eventually(t, "the refutation reached every member", func() bool {
+		for observer, node := range c.nodes {
+			if observer == accused {
+				continue
+			}
+			for _, m := range node.Members() {
+				if m.Address == accused && (m.State != StateAlive || m.Incarnation < refuted) {
+					return false
+				}
+			}
+		}
+		return true
+	})
+
+	states := c.transitions.states(accuser, accused)
+	if len(states) < 2 || states[0] != StateSuspect || states[1] != StateAlive {
+		t.Fatalf("%s saw %s go through %v, want suspect then alive", accuser, accused, states)
+	}
+}
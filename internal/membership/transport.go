@@ -0,0 +1,134 @@
+package membership
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"sync"
+)
+
+type Update struct {
+	Address     string
+	State       State
+	Incarnation uint64
+}
+
+type Message struct {
+	From        string
+	Incarnation uint64
+	Updates     []Update
+}
+
+// Transport delivers probes between members. Ping returns the acknowledgement
+// of target, PingReq asks via to ping target and relays its acknowledgement.
+type Transport interface {
+	Ping(ctx context.Context, target string, msg Message) (Message, error)
+	PingReq(ctx context.Context, via string, target string, msg Message) (Message, error)
+}
+
+var ErrPacketLost = errors.New("packet lost")
+
+// MemoryNetwork connects nodes of one process, dropping messages with the
+// configured probability and cutting off members marked down. It lets the
+// protocol run without sockets under simulated loss.
+type MemoryNetwork struct {
+	mu    sync.RWMutex
+	nodes map[string]*Node
+	down  map[string]bool
+	loss  float64
+}
+
+func NewMemoryNetwork(loss float64) *MemoryNetwork {
+	return &MemoryNetwork{
+		nodes: make(map[string]*Node),
+		down:  make(map[string]bool),
+		loss:  loss,
+	}
+}
+
+func (m *MemoryNetwork) Register(address string, node *Node) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.nodes[address] = node
+}
+
+func (m *MemoryNetwork) SetLoss(loss float64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.loss = loss
+}
+
+func (m *MemoryNetwork) SetDown(address string, down bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.down[address] = down
+}
+
+// Transport returns the transport the member at address sends through.
+func (m *MemoryNetwork) Transport(address string) Transport {
+	return &memoryTransport{network: m, from: address}
+}
+
+// deliver returns the node at target, or an error when either end is down
+// or the message is lost.
+func (m *MemoryNetwork) deliver(from string, target string) (*Node, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	if m.down[from] || m.down[target] {
+		return nil, ErrPacketLost
+	}
+
+	node, ok := m.nodes[target]
+	if !ok {
+		return nil, fmt.Errorf("no member at %s", target)
+	}
+
+	if m.loss > 0 && rand.Float64() < m.loss {
+		return nil, ErrPacketLost
+	}
+
+	return node, nil
+}
+
+type memoryTransport struct {
+	network *MemoryNetwork
+	from    string
+}
+
+func (t *memoryTransport) Ping(ctx context.Context, target string, msg Message) (Message, error) {
+	node, err := t.network.deliver(t.from, target)
+	if err != nil {
+		return Message{}, err
+	}
+
+	ack := node.HandlePing(msg)
+
+	if _, err := t.network.deliver(target, t.from); err != nil {
+		return Message{}, err
+	}
+
+	return ack, ctx.Err()
+}
+
+func (t *memoryTransport) PingReq(ctx context.Context, via string, target string, msg Message) (Message, error) {
+	node, err := t.network.deliver(t.from, via)
+	if err != nil {
+		return Message{}, err
+	}
+
+	ack, err := node.HandlePingReq(ctx, target, msg)
+	if err != nil {
+		return Message{}, err
+	}
+
+	if _, err := t.network.deliver(via, t.from); err != nil {
+		return Message{}, err
+	}
+
+	return ack, nil
+}
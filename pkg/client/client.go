@@ -0,0 +1,413 @@
+// Package client is a Go client for nilis clusters. It keeps a shard map,
+// sends every request straight to the shard owning its key and follows MOVED
+// redirects when the map turns out to be stale.
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/thenonexistent/nilis/pkg/sharding"
+	"github.com/thenonexistent/nilis/pkg/store"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/emptypb"
+)
+
+const (
+	DefaultTimeout          = 5 * time.Second
+	DefaultMaxRetries       = 3
+	DefaultRetryBackoff     = 50 * time.Millisecond
+	DefaultMaxRetryBackoff  = 2 * time.Second
+	DefaultDeadLetterSuffix = ".dlq"
+
+	maxRedirects = 5
+)
+
+type Config struct {
+	// Seeds are addresses of cluster nodes the shard map is fetched from.
+	Seeds []string
+
+	// Shards and Partitioner configure a static shard map instead, which is
+	// replaced by the cluster's map once a node reports a newer epoch.
+	Shards      []sharding.Shard
+	Partitioner sharding.PartitionerSettings
+
+	// TLSCert, TLSKey and TLSCA enable mutual TLS, like the server options
+	// of the same name.
+	TLSCert string
+	TLSKey  string
+	TLSCA   string
+
+	// Timeout bounds each attempt of a call unless WithTimeout overrides it,
+	// zero uses DefaultTimeout.
+	Timeout time.Duration
+
+	// MaxRetries bounds how often idempotent calls are retried on an
+	// unavailable shard. Zero uses DefaultMaxRetries, a negative value
+	// disables retries.
+	MaxRetries       int
+	RetryBackoff     time.Duration
+	MaxRetryBackoff  time.Duration
+	DeadLetterSuffix string
+
+	DialOptions []grpc.DialOption
+}
+
+type Client struct {
+	config Config
+	creds  credentials.TransportCredentials
+
+	mu     sync.RWMutex
+	routes *shardMap
+	conns  map[string]*grpc.ClientConn
+	closed bool
+}
+
+type shardMap struct {
+	epoch       uint64
+	partitioner sharding.Partitioner
+}
+
+func New(ctx context.Context, config Config) (*Client, error) {
+	if len(config.Seeds) == 0 && len(config.Shards) == 0 {
+		return nil, errors.New("either seed addresses or a shard list is required")
+	}
+
+	if config.Timeout == 0 {
+		config.Timeout = DefaultTimeout
+	}
+	if config.MaxRetries == 0 {
+		config.MaxRetries = DefaultMaxRetries
+	}
+	if config.RetryBackoff == 0 {
+		config.RetryBackoff = DefaultRetryBackoff
+	}
+	if config.MaxRetryBackoff == 0 {
+		config.MaxRetryBackoff = DefaultMaxRetryBackoff
+	}
+	if config.DeadLetterSuffix == "" {
+		config.DeadLetterSuffix = DefaultDeadLetterSuffix
+	}
+
+	c := &Client{
+		config: config,
+		creds:  insecure.NewCredentials(),
+		conns:  make(map[string]*grpc.ClientConn),
+	}
+
+	if config.TLSCert != "" || config.TLSKey != "" || config.TLSCA != "" {
+		creds, err := loadTLS(config.TLSCert, config.TLSKey, config.TLSCA)
+		if err != nil {
+			return nil, err
+		}
+		c.creds = creds
+	}
+
+	if len(config.Shards) > 0 {
+		settings := config.Partitioner
+		if settings.Strategy == "" {
+			settings.Strategy = sharding.StrategyModulo
+		}
+		if settings.HashFunction == "" {
+			settings.HashFunction = sharding.HashFNV64
+		}
+		if settings.VirtualNodes == 0 {
+			settings.VirtualNodes = sharding.DefaultVirtualNodes
+		}
+
+		partitioner, err := sharding.NewPartitioner(settings, config.Shards)
+		if err != nil {
+			return nil, fmt.Errorf("failed creating partitioner: %w", err)
+		}
+		c.routes = &shardMap{partitioner: partitioner}
+
+		return c, nil
+	}
+
+	if err := c.Refresh(ctx); err != nil {
+		c.Close()
+		return nil, err
+	}
+
+	return c, nil
+}
+
+func (c *Client) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.closed = true
+
+	var errs []error
+	for address, conn := range c.conns {
+		if err := conn.Close(); err != nil {
+			errs = append(errs, fmt.Errorf("failed closing connection to %s: %w", address, err))
+		}
+	}
+	c.conns = make(map[string]*grpc.ClientConn)
+
+	return errors.Join(errs...)
+}
+
+// Epoch returns the epoch of the shard map requests are routed with, zero for
+// a static map that has not been refreshed yet.
+func (c *Client) Epoch() uint64 {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	if c.routes == nil {
+		return 0
+	}
+	return c.routes.epoch
+}
+
+// Refresh fetches the shard map from the first seed or known shard that
+// answers. While the cluster is resharding requests are routed with the
+// target topology, which is where nodes accept them.
+func (c *Client) Refresh(ctx context.Context) error {
+	var errs []error
+
+	for _, address := range c.refreshAddresses() {
+		conn, err := c.conn(address)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+
+		callCtx, cancel := context.WithTimeout(ctx, c.config.Timeout)
+		out, err := store.NewStoreClient(conn).GetShardMap(callCtx, &emptypb.Empty{})
+		cancel()
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", address, err))
+			continue
+		}
+
+		topology := out.Current
+		if out.Target != nil {
+			topology = out.Target
+		}
+
+		routes, err := shardMapFromProto(topology)
+		if err != nil {
+			return fmt.Errorf("invalid shard map from %s: %w", address, err)
+		}
+
+		c.mu.Lock()
+		if c.routes == nil || routes.epoch >= c.routes.epoch {
+			c.routes = routes
+		}
+		c.mu.Unlock()
+
+		return nil
+	}
+
+	return fmt.Errorf("failed fetching shard map: %w", errors.Join(errs...))
+}
+
+func (c *Client) refreshAddresses() []string {
+	addresses := append([]string(nil), c.config.Seeds...)
+
+	c.mu.RLock()
+	if c.routes != nil {
+		for _, shard := range c.routes.partitioner.Shards() {
+			addresses = append(addresses, shard.Address)
+		}
+	}
+	c.mu.RUnlock()
+
+	return addresses
+}
+
+func (c *Client) conn(address string) (*grpc.ClientConn, error) {
+	c.mu.RLock()
+	conn, ok := c.conns[address]
+	closed := c.closed
+	c.mu.RUnlock()
+
+	if closed {
+		return nil, ErrClosed
+	}
+	if ok {
+		return conn, nil
+	}
+
+	opts := append([]grpc.DialOption{grpc.WithTransportCredentials(c.creds)}, c.config.DialOptions...)
+
+	conn, err := grpc.NewClient(address, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("failed creating connection to %s: %w", address, err)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.closed {
+		conn.Close()
+		return nil, ErrClosed
+	}
+	if existing, ok := c.conns[address]; ok {
+		conn.Close()
+		return existing, nil
+	}
+
+	c.conns[address] = conn
+	return conn, nil
+}
+
+func (c *Client) addressOf(key string) (string, uint64) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	return c.routes.partitioner.ShardFromKey(key).Address, c.routes.epoch
+}
+
+func (c *Client) addressOfShard(id int) (string, uint64, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	shard, ok := sharding.FindShardById(c.routes.partitioner.Shards(), id)
+	return shard.Address, c.routes.epoch, ok
+}
+
+// anyAddress is used by requests the receiving node fans out by itself.
+func (c *Client) anyAddress() (string, uint64) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	shards := c.routes.partitioner.Shards()
+	return shards[rand.IntN(len(shards))].Address, c.routes.epoch
+}
+
+func (c *Client) queueRoutingKey(queue string) string {
+	return strings.TrimSuffix(queue, c.config.DeadLetterSuffix)
+}
+
+func (c *Client) backoff(attempt int) time.Duration {
+	backoff := c.config.RetryBackoff << attempt
+	if backoff <= 0 || backoff > c.config.MaxRetryBackoff {
+		backoff = c.config.MaxRetryBackoff
+	}
+
+	// full jitter keeps clients that failed together from retrying together
+	return time.Duration(rand.Int64N(int64(backoff) + 1))
+}
+
+// invoke runs fn against the shard picked by route, following MOVED
+// redirects and retrying unavailable shards with backoff.
+func invoke[T any](ctx context.Context, c *Client, route func() (string, uint64), opts []CallOption, fn func(context.Context, store.StoreClient) (T, error)) (T, error) {
+	return call(ctx, c, route, c.callOptions(opts), fn)
+}
+
+// invokeOnce is invoke for calls that change state on every run. An
+// unavailable shard may have applied them before failing, so they are never
+// retried, MOVED redirects are still followed.
+func invokeOnce[T any](ctx context.Context, c *Client, route func() (string, uint64), opts []CallOption, fn func(context.Context, store.StoreClient) (T, error)) (T, error) {
+	options := c.callOptions(opts)
+	options.retries = 0
+
+	return call(ctx, c, route, options, fn)
+}
+
+func call[T any](ctx context.Context, c *Client, route func() (string, uint64), options callOptions, fn func(context.Context, store.StoreClient) (T, error)) (T, error) {
+	var zero T
+
+	var redirect string
+	var lastErr error
+
+	for retries, redirects := 0, 0; ; {
+		address, epoch := route()
+		if redirect != "" {
+			address = redirect
+		}
+
+		conn, err := c.conn(address)
+		if err != nil {
+			return zero, err
+		}
+
+		callCtx, cancel := context.WithTimeout(ctx, options.timeout)
+		out, err := fn(callCtx, store.NewStoreClient(conn))
+		cancel()
+
+		if err == nil {
+			return out, nil
+		}
+		lastErr = err
+
+		st := status.Convert(err)
+
+		// a redirected call was not applied, so it is followed regardless
+		// of retries
+		if moved := movedDetails(st); moved != nil && redirects < maxRedirects {
+			redirects++
+			redirect = moved.Address
+			if moved.Epoch > epoch {
+				// the redirect is followed even if the refresh fails
+				_ = c.Refresh(ctx)
+			}
+			continue
+		}
+
+		if st.Code() != codes.Unavailable || retries >= options.retries {
+			break
+		}
+
+		redirect = ""
+
+		select {
+		case <-ctx.Done():
+			return zero, ctx.Err()
+		case <-time.After(c.backoff(retries)):
+		}
+		retries++
+	}
+
+	return zero, translateError(lastErr)
+}
+
+func shardMapFromProto(in *store.Topology) (*shardMap, error) {
+	if in == nil || len(in.Shards) == 0 {
+		return nil, errors.New("shard map contains no shards")
+	}
+
+	shards := make([]sharding.Shard, 0, len(in.Shards))
+	for _, spec := range in.Shards {
+		replicas := make([]sharding.Replica, 0, len(spec.Replicas))
+		for _, address := range spec.Replicas {
+			replicas = append(replicas, sharding.Replica{Address: address})
+		}
+
+		weight := int(spec.Weight)
+		if weight == 0 {
+			weight = 1
+		}
+
+		shards = append(shards, sharding.Shard{
+			ID:       int(spec.Id),
+			Address:  spec.Address,
+			Replicas: replicas,
+			Weight:   weight,
+		})
+	}
+
+	partitioner, err := sharding.NewPartitioner(sharding.PartitionerSettings{
+		Strategy:     in.Partitioner,
+		HashFunction: in.HashFunction,
+		VirtualNodes: int(in.VirtualNodes),
+		HashTags:     in.HashTags,
+	}, shards)
+	if err != nil {
+		return nil, err
+	}
+
+	return &shardMap{epoch: in.Epoch, partitioner: partitioner}, nil
+}
@@ -0,0 +1,184 @@
+package client
+
+import (
+	"context"
+
+	"github.com/thenonexistent/nilis/pkg/store"
+)
+
+type ScoredMember struct {
+	Member []byte
+	Score  float64
+}
+
+func (c *Client) HashSet(ctx context.Context, key string, fields map[string][]byte, opts ...CallOption) (int64, error) {
+	return count(invoke(ctx, c, c.byKey(key), opts, func(ctx context.Context, client store.StoreClient) (*store.Count, error) {
+		return client.HashSet(ctx, &store.HashSetRequest{Key: key, Fields: fields})
+	}))
+}
+
+func (c *Client) HashGet(ctx context.Context, key string, field string, opts ...CallOption) ([]byte, error) {
+	out, err := invoke(ctx, c, c.byKey(key), opts, func(ctx context.Context, client store.StoreClient) (*store.HashField, error) {
+		return client.HashGet(ctx, &store.HashField{Key: key, Field: field})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return out.Value, nil
+}
+
+func (c *Client) HashGetAll(ctx context.Context, key string, opts ...CallOption) (map[string][]byte, error) {
+	out, err := invoke(ctx, c, c.byKey(key), opts, func(ctx context.Context, client store.StoreClient) (*store.Hash, error) {
+		return client.HashGetAll(ctx, &store.Key{Key: key})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return out.Fields, nil
+}
+
+func (c *Client) HashDelete(ctx context.Context, key string, fields []string, opts ...CallOption) (int64, error) {
+	return count(invoke(ctx, c, c.byKey(key), opts, func(ctx context.Context, client store.StoreClient) (*store.Count, error) {
+		return client.HashDelete(ctx, &store.HashFields{Key: key, Fields: fields})
+	}))
+}
+
+func (c *Client) ListPushLeft(ctx context.Context, key string, values [][]byte, opts ...CallOption) (int64, error) {
+	return c.listPush(ctx, key, values, true, opts)
+}
+
+func (c *Client) ListPushRight(ctx context.Context, key string, values [][]byte, opts ...CallOption) (int64, error) {
+	return c.listPush(ctx, key, values, false, opts)
+}
+
+func (c *Client) listPush(ctx context.Context, key string, values [][]byte, left bool, opts []CallOption) (int64, error) {
+	return count(invokeOnce(ctx, c, c.byKey(key), opts, func(ctx context.Context, client store.StoreClient) (*store.Count, error) {
+		return client.ListPush(ctx, &store.ListPushRequest{Key: key, Values: values, Left: left})
+	}))
+}
+
+// ListPopLeft returns ErrNotFound when the list is empty, as does ListPopRight.
+func (c *Client) ListPopLeft(ctx context.Context, key string, opts ...CallOption) ([]byte, error) {
+	return c.listPop(ctx, key, true, opts)
+}
+
+func (c *Client) ListPopRight(ctx context.Context, key string, opts ...CallOption) ([]byte, error) {
+	return c.listPop(ctx, key, false, opts)
+}
+
+func (c *Client) listPop(ctx context.Context, key string, left bool, opts []CallOption) ([]byte, error) {
+	out, err := invokeOnce(ctx, c, c.byKey(key), opts, func(ctx context.Context, client store.StoreClient) (*store.Value, error) {
+		return client.ListPop(ctx, &store.ListPopRequest{Key: key, Left: left})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return out.Value, nil
+}
+
+func (c *Client) ListRange(ctx context.Context, key string, start int64, stop int64, opts ...CallOption) ([][]byte, error) {
+	return members(invoke(ctx, c, c.byKey(key), opts, func(ctx context.Context, client store.StoreClient) (*store.Members, error) {
+		return client.ListRange(ctx, &store.ListRangeRequest{Key: key, Start: start, Stop: stop})
+	}))
+}
+
+func (c *Client) SetAdd(ctx context.Context, key string, items [][]byte, opts ...CallOption) (int64, error) {
+	return count(invoke(ctx, c, c.byKey(key), opts, func(ctx context.Context, client store.StoreClient) (*store.Count, error) {
+		return client.SetAdd(ctx, &store.Members{Key: key, Members: items})
+	}))
+}
+
+func (c *Client) SetRemove(ctx context.Context, key string, items [][]byte, opts ...CallOption) (int64, error) {
+	return count(invoke(ctx, c, c.byKey(key), opts, func(ctx context.Context, client store.StoreClient) (*store.Count, error) {
+		return client.SetRemove(ctx, &store.Members{Key: key, Members: items})
+	}))
+}
+
+func (c *Client) SetMembers(ctx context.Context, key string, opts ...CallOption) ([][]byte, error) {
+	return members(invoke(ctx, c, c.byKey(key), opts, func(ctx context.Context, client store.StoreClient) (*store.Members, error) {
+		return client.SetMembers(ctx, &store.Key{Key: key})
+	}))
+}
+
+func (c *Client) SortedSetAdd(ctx context.Context, key string, items []ScoredMember, opts ...CallOption) (int64, error) {
+	req := &store.ScoredMembers{Key: key, Members: make([]*store.ScoredMember, 0, len(items))}
+	for _, item := range items {
+		req.Members = append(req.Members, &store.ScoredMember{Member: item.Member, Score: item.Score})
+	}
+
+	return count(invoke(ctx, c, c.byKey(key), opts, func(ctx context.Context, client store.StoreClient) (*store.Count, error) {
+		return client.SortedSetAdd(ctx, req)
+	}))
+}
+
+func (c *Client) SortedSetRemove(ctx context.Context, key string, items [][]byte, opts ...CallOption) (int64, error) {
+	return count(invoke(ctx, c, c.byKey(key), opts, func(ctx context.Context, client store.StoreClient) (*store.Count, error) {
+		return client.SortedSetRemove(ctx, &store.Members{Key: key, Members: items})
+	}))
+}
+
+// SortedSetRank returns the rank and score of member, counting from the
+// highest score when reverse is set, or ErrNotFound.
+func (c *Client) SortedSetRank(ctx context.Context, key string, member []byte, reverse bool, opts ...CallOption) (int64, float64, error) {
+	out, err := invoke(ctx, c, c.byKey(key), opts, func(ctx context.Context, client store.StoreClient) (*store.Rank, error) {
+		return client.SortedSetRank(ctx, &store.SortedSetMember{Key: key, Member: member, Reverse: reverse})
+	})
+	if err != nil {
+		return 0, 0, err
+	}
+
+	return out.Rank, out.Score, nil
+}
+
+func (c *Client) SortedSetRangeByRank(ctx context.Context, key string, start int64, stop int64, reverse bool, opts ...CallOption) ([]ScoredMember, error) {
+	return scoredMembers(invoke(ctx, c, c.byKey(key), opts, func(ctx context.Context, client store.StoreClient) (*store.ScoredMembers, error) {
+		return client.SortedSetRangeByRank(ctx, &store.RankRangeRequest{Key: key, Start: start, Stop: stop, Reverse: reverse})
+	}))
+}
+
+// SortedSetRangeByScore returns members scored between min and max, a limit
+// of zero returns all of them.
+func (c *Client) SortedSetRangeByScore(ctx context.Context, key string, min float64, max float64, offset int64, limit int64, reverse bool, opts ...CallOption) ([]ScoredMember, error) {
+	return scoredMembers(invoke(ctx, c, c.byKey(key), opts, func(ctx context.Context, client store.StoreClient) (*store.ScoredMembers, error) {
+		return client.SortedSetRangeByScore(ctx, &store.ScoreRangeRequest{
+			Key:     key,
+			Min:     min,
+			Max:     max,
+			Offset:  offset,
+			Limit:   limit,
+			Reverse: reverse,
+		})
+	}))
+}
+
+func count(out *store.Count, err error) (int64, error) {
+	if err != nil {
+		return 0, err
+	}
+
+	return out.Count, nil
+}
+
+func members(out *store.Members, err error) ([][]byte, error) {
+	if err != nil {
+		return nil, err
+	}
+
+	return out.Members, nil
+}
+
+func scoredMembers(out *store.ScoredMembers, err error) ([]ScoredMember, error) {
+	if err != nil {
+		return nil, err
+	}
+
+	items := make([]ScoredMember, 0, len(out.Members))
+	for _, member := range out.Members {
+		items = append(items, ScoredMember{Member: member.Member, Score: member.Score})
+	}
+
+	return items, nil
+}
@@ -0,0 +1,52 @@
+package client
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/thenonexistent/nilis/pkg/store"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+var (
+	ErrNotFound  = errors.New("not found")
+	ErrWrongType = errors.New("key holds the wrong kind of value")
+	ErrClosed    = errors.New("client is closed")
+)
+
+func translateError(err error) error {
+	st, ok := status.FromError(err)
+	if !ok {
+		return err
+	}
+
+	switch {
+	case st.Code() == codes.NotFound:
+		return fmt.Errorf("%w: %s", ErrNotFound, st.Message())
+	case st.Code() == codes.FailedPrecondition && wrongTypeDetails(st) != nil:
+		return fmt.Errorf("%w: %s", ErrWrongType, st.Message())
+	}
+
+	return err
+}
+
+func movedDetails(st *status.Status) *store.Moved {
+	for _, detail := range st.Details() {
+		if moved, ok := detail.(*store.Moved); ok {
+			return moved
+		}
+	}
+
+	return nil
+}
+
+func wrongTypeDetails(st *status.Status) *store.WrongType {
+	for _, detail := range st.Details() {
+		if wrongType, ok := detail.(*store.WrongType); ok {
+			return wrongType
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,64 @@
+package client
+
+import (
+	"context"
+
+	"github.com/thenonexistent/nilis/pkg/store"
+	"google.golang.org/protobuf/types/known/emptypb"
+)
+
+func (c *Client) byKey(key string) func() (string, uint64) {
+	return func() (string, uint64) {
+		return c.addressOf(key)
+	}
+}
+
+func (c *Client) Get(ctx context.Context, key string, opts ...CallOption) ([]byte, error) {
+	out, err := invoke(ctx, c, c.byKey(key), opts, func(ctx context.Context, client store.StoreClient) (*store.Value, error) {
+		return client.Get(ctx, &store.Key{Key: key})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return out.Value, nil
+}
+
+func (c *Client) Set(ctx context.Context, key string, value []byte, opts ...CallOption) error {
+	_, err := invoke(ctx, c, c.byKey(key), opts, func(ctx context.Context, client store.StoreClient) (*emptypb.Empty, error) {
+		return client.Set(ctx, &store.Value{Key: key, Value: value})
+	})
+
+	return err
+}
+
+func (c *Client) Delete(ctx context.Context, key string, opts ...CallOption) error {
+	_, err := invoke(ctx, c, c.byKey(key), opts, func(ctx context.Context, client store.StoreClient) (*emptypb.Empty, error) {
+		return client.Delete(ctx, &store.Key{Key: key})
+	})
+
+	return err
+}
+
+// DeletePrefix deletes every key starting with prefix on all shards and
+// returns how many were deleted.
+func (c *Client) DeletePrefix(ctx context.Context, prefix string, opts ...CallOption) (int64, error) {
+	return c.deleteRange(ctx, &store.DeleteRangeRequest{Prefix: prefix}, opts)
+}
+
+// DeleteRange deletes every key in [start, end) on all shards, an empty end
+// deletes up to the last key.
+func (c *Client) DeleteRange(ctx context.Context, start string, end string, opts ...CallOption) (int64, error) {
+	return c.deleteRange(ctx, &store.DeleteRangeRequest{Start: start, End: end}, opts)
+}
+
+func (c *Client) deleteRange(ctx context.Context, req *store.DeleteRangeRequest, opts []CallOption) (int64, error) {
+	out, err := invoke(ctx, c, c.anyAddress, opts, func(ctx context.Context, client store.StoreClient) (*store.Count, error) {
+		return client.DeleteRange(ctx, req)
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return out.Count, nil
+}
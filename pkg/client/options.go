@@ -0,0 +1,43 @@
+package client
+
+import "time"
+
+type CallOption func(*callOptions)
+
+type callOptions struct {
+	timeout time.Duration
+	retries int
+}
+
+// WithTimeout bounds every attempt of a call instead of Config.Timeout.
+func WithTimeout(timeout time.Duration) CallOption {
+	return func(o *callOptions) {
+		o.timeout = timeout
+	}
+}
+
+// WithRetries overrides how often an idempotent call is retried on an
+// unavailable shard, zero disables retries. Calls that change state on every
+// run, such as Enqueue or ListPush, are never retried.
+func WithRetries(retries int) CallOption {
+	return func(o *callOptions) {
+		o.retries = retries
+	}
+}
+
+func (c *Client) callOptions(opts []CallOption) callOptions {
+	call := callOptions{
+		timeout: c.config.Timeout,
+		retries: c.config.MaxRetries,
+	}
+
+	for _, opt := range opts {
+		opt(&call)
+	}
+
+	if call.retries < 0 {
+		call.retries = 0
+	}
+
+	return call
+}
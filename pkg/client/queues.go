@@ -0,0 +1,76 @@
+package client
+
+import (
+	"context"
+	"time"
+
+	"github.com/thenonexistent/nilis/pkg/store"
+	"google.golang.org/protobuf/types/known/emptypb"
+)
+
+type Message struct {
+	ID            uint64
+	Body          []byte
+	ReceiptHandle string
+	DeliveryCount uint32
+}
+
+func (c *Client) byQueue(queue string) func() (string, uint64) {
+	return c.byKey(c.queueRoutingKey(queue))
+}
+
+func (c *Client) Enqueue(ctx context.Context, queue string, messages [][]byte, opts ...CallOption) ([]uint64, error) {
+	out, err := invokeOnce(ctx, c, c.byQueue(queue), opts, func(ctx context.Context, client store.StoreClient) (*store.MessageIDs, error) {
+		return client.Enqueue(ctx, &store.EnqueueRequest{Queue: queue, Messages: messages})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return out.Ids, nil
+}
+
+// Dequeue receives up to max messages, hiding them from other consumers until
+// visibilityTimeout passes. A zero timeout uses the server default.
+func (c *Client) Dequeue(ctx context.Context, queue string, max int, visibilityTimeout time.Duration, opts ...CallOption) ([]Message, error) {
+	out, err := invokeOnce(ctx, c, c.byQueue(queue), opts, func(ctx context.Context, client store.StoreClient) (*store.QueueMessages, error) {
+		return client.Dequeue(ctx, &store.DequeueRequest{
+			Queue:               queue,
+			MaxMessages:         int32(max),
+			VisibilityTimeoutMs: visibilityTimeout.Milliseconds(),
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	messages := make([]Message, 0, len(out.Messages))
+	for _, message := range out.Messages {
+		messages = append(messages, Message{
+			ID:            message.Id,
+			Body:          message.Body,
+			ReceiptHandle: message.ReceiptHandle,
+			DeliveryCount: message.DeliveryCount,
+		})
+	}
+
+	return messages, nil
+}
+
+// Ack returns ErrNotFound when the receipt expired and the message may have
+// been delivered again.
+func (c *Client) Ack(ctx context.Context, queue string, receiptHandle string, opts ...CallOption) error {
+	_, err := invoke(ctx, c, c.byQueue(queue), opts, func(ctx context.Context, client store.StoreClient) (*emptypb.Empty, error) {
+		return client.Ack(ctx, &store.Receipt{Queue: queue, ReceiptHandle: receiptHandle})
+	})
+
+	return err
+}
+
+func (c *Client) Nack(ctx context.Context, queue string, receiptHandle string, delay time.Duration, opts ...CallOption) error {
+	_, err := invoke(ctx, c, c.byQueue(queue), opts, func(ctx context.Context, client store.StoreClient) (*emptypb.Empty, error) {
+		return client.Nack(ctx, &store.Receipt{Queue: queue, ReceiptHandle: receiptHandle, DelayMs: delay.Milliseconds()})
+	})
+
+	return err
+}
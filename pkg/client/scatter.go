@@ -0,0 +1,107 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/thenonexistent/nilis/pkg/store"
+)
+
+type KeyValue struct {
+	Key   string
+	Value []byte
+	Type  string
+}
+
+type ScanOptions struct {
+	Prefix   string
+	Start    string
+	End      string
+	Limit    int64
+	KeysOnly bool
+}
+
+type ScanResult struct {
+	Entries []KeyValue
+	// Next is the Start of the following page, empty on the last one.
+	Next string
+}
+
+// PartialError is returned next to the results of a fan-out read when some
+// shards failed, keyed by shard id.
+type PartialError struct {
+	Shards map[int]string
+}
+
+func (e *PartialError) Error() string {
+	failures := make([]string, 0, len(e.Shards))
+	for id, message := range e.Shards {
+		failures = append(failures, fmt.Sprintf("shard %d: %s", id, message))
+	}
+
+	return "partial failure: " + strings.Join(failures, "; ")
+}
+
+// MultiGet reads keys from all shards owning them through a single node.
+// Missing keys are left out. When some shards fail the keys read from the
+// others are returned along with a *PartialError.
+func (c *Client) MultiGet(ctx context.Context, keys []string, opts ...CallOption) (map[string][]byte, error) {
+	if len(keys) == 0 {
+		return map[string][]byte{}, nil
+	}
+
+	out, err := invoke(ctx, c, c.byKey(keys[0]), opts, func(ctx context.Context, client store.StoreClient) (*store.KeyValues, error) {
+		return client.MultiGet(ctx, &store.Keys{Keys: keys})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	values := make(map[string][]byte, len(out.Entries))
+	for _, entry := range out.Entries {
+		values[entry.Key] = entry.Value
+	}
+
+	return values, partialError(out.Errors)
+}
+
+// Scan returns one page of keys across all shards in key order. Like
+// MultiGet it returns a *PartialError alongside results when shards fail.
+func (c *Client) Scan(ctx context.Context, scan ScanOptions, opts ...CallOption) (*ScanResult, error) {
+	out, err := invoke(ctx, c, c.anyAddress, opts, func(ctx context.Context, client store.StoreClient) (*store.KeyValues, error) {
+		return client.Scan(ctx, &store.ScanRequest{
+			Prefix:   scan.Prefix,
+			Start:    scan.Start,
+			End:      scan.End,
+			Limit:    scan.Limit,
+			KeysOnly: scan.KeysOnly,
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	result := &ScanResult{
+		Entries: make([]KeyValue, 0, len(out.Entries)),
+		Next:    out.Next,
+	}
+	for _, entry := range out.Entries {
+		result.Entries = append(result.Entries, KeyValue{Key: entry.Key, Value: entry.Value, Type: entry.Type})
+	}
+
+	return result, partialError(out.Errors)
+}
+
+func partialError(errs []*store.ShardError) error {
+	if len(errs) == 0 {
+		return nil
+	}
+
+	shards := make(map[int]string, len(errs))
+	for _, err := range errs {
+		shards[int(err.ShardId)] = err.Error
+	}
+
+	return &PartialError{Shards: shards}
+}
@@ -0,0 +1,76 @@
+package client
+
+import (
+	"context"
+	"time"
+
+	"github.com/thenonexistent/nilis/pkg/sharding"
+	"github.com/thenonexistent/nilis/pkg/store"
+	"google.golang.org/protobuf/types/known/emptypb"
+)
+
+type Session struct {
+	ID                string
+	HeartbeatInterval time.Duration
+	// Timeout is how long the session survives without heartbeats.
+	Timeout time.Duration
+}
+
+// bySession routes to the shard holding a session, nodes forward session
+// calls they do not hold themselves.
+func (c *Client) bySession(id string) func() (string, uint64) {
+	return func() (string, uint64) {
+		if shardID, ok := sharding.SessionShard(id); ok {
+			if address, epoch, ok := c.addressOfShard(shardID); ok {
+				return address, epoch
+			}
+		}
+
+		return c.anyAddress()
+	}
+}
+
+// CreateSession opens a session, a zero heartbeat interval uses the server
+// default. Ephemeral keys set with SetEphemeral are deleted once the session
+// is closed or misses its heartbeats for Timeout.
+func (c *Client) CreateSession(ctx context.Context, heartbeatInterval time.Duration, opts ...CallOption) (Session, error) {
+	out, err := invokeOnce(ctx, c, c.anyAddress, opts, func(ctx context.Context, client store.StoreClient) (*store.Session, error) {
+		return client.CreateSession(ctx, &store.SessionRequest{HeartbeatIntervalMs: heartbeatInterval.Milliseconds()})
+	})
+	if err != nil {
+		return Session{}, err
+	}
+
+	return Session{
+		ID:                out.Id,
+		HeartbeatInterval: time.Duration(out.HeartbeatIntervalMs) * time.Millisecond,
+		Timeout:           time.Duration(out.TimeoutMs) * time.Millisecond,
+	}, nil
+}
+
+// Heartbeat keeps a session alive, it returns ErrNotFound once the session
+// expired.
+func (c *Client) Heartbeat(ctx context.Context, sessionID string, opts ...CallOption) error {
+	_, err := invoke(ctx, c, c.bySession(sessionID), opts, func(ctx context.Context, client store.StoreClient) (*emptypb.Empty, error) {
+		return client.Heartbeat(ctx, &store.SessionID{Id: sessionID})
+	})
+
+	return err
+}
+
+func (c *Client) CloseSession(ctx context.Context, sessionID string, opts ...CallOption) error {
+	_, err := invokeOnce(ctx, c, c.bySession(sessionID), opts, func(ctx context.Context, client store.StoreClient) (*emptypb.Empty, error) {
+		return client.CloseSession(ctx, &store.SessionID{Id: sessionID})
+	})
+
+	return err
+}
+
+// SetEphemeral stores a plain value that is deleted along with the session.
+func (c *Client) SetEphemeral(ctx context.Context, key string, value []byte, sessionID string, opts ...CallOption) error {
+	_, err := invoke(ctx, c, c.byKey(key), opts, func(ctx context.Context, client store.StoreClient) (*emptypb.Empty, error) {
+		return client.Set(ctx, &store.Value{Key: key, Value: value, SessionId: sessionID})
+	})
+
+	return err
+}
@@ -1,6 +1,24 @@
 package sharding
 
-import "hash/fnv"
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"hash/crc64"
+	"hash/fnv"
+	"strings"
+)
+
+const (
+	HashFNV64  = "fnv64"
+	HashFNV64a = "fnv64a"
+	HashCRC64  = "crc64"
+	HashSHA256 = "sha256"
+)
+
+type HashFunc func(key string) uint64
+
+var crc64Table = crc64.MakeTable(crc64.ECMA)
 
 func HashSumFromKey(key string) uint64 {
 	h := fnv.New64()
@@ -8,6 +26,53 @@ func HashSumFromKey(key string) uint64 {
 	return h.Sum64()
 }
 
+func HashFunctionByName(name string) (HashFunc, error) {
+	switch name {
+	case HashFNV64:
+		return HashSumFromKey, nil
+	case HashFNV64a:
+		return func(key string) uint64 {
+			h := fnv.New64a()
+			h.Write([]byte(key))
+			return h.Sum64()
+		}, nil
+	case HashCRC64:
+		return func(key string) uint64 {
+			return crc64.Checksum([]byte(key), crc64Table)
+		}, nil
+	case HashSHA256:
+		return func(key string) uint64 {
+			sum := sha256.Sum256([]byte(key))
+			return binary.BigEndian.Uint64(sum[:8])
+		}, nil
+	default:
+		return nil, fmt.Errorf("unknown hash function: %s", name)
+	}
+}
+
+// HashTag returns the part of key that is hashed when hash tags are enabled.
+// Like redis cluster, only the content between the first '{' and the first
+// '}' after it is used, unless that content is empty.
+func HashTag(key string) string {
+	start := strings.IndexByte(key, '{')
+	if start < 0 {
+		return key
+	}
+
+	end := strings.IndexByte(key[start+1:], '}')
+	if end <= 0 {
+		return key
+	}
+
+	return key[start+1 : start+1+end]
+}
+
+func withHashTags(hash HashFunc) HashFunc {
+	return func(key string) uint64 {
+		return hash(HashTag(key))
+	}
+}
+
 func ShardFromKey(key string, shards []Shard) Shard {
 	hashSum := HashSumFromKey(key)
 	return ShardFromHashSum(hashSum, shards)
@@ -20,3 +85,15 @@ func ShardFromHashSum(hashSum uint64, shards []Shard) Shard {
 
 	return shard
 }
+
+// Mix64 is the splitmix64 finalizer, used where fnv alone spreads short,
+// similar inputs such as virtual node labels or shard ids poorly, and to
+// decorrelate hashes of the same key taken for different placements.
+func Mix64(x uint64) uint64 {
+	x ^= x >> 30
+	x *= 0xbf58476d1ce4e5b9
+	x ^= x >> 27
+	x *= 0x94d049bb133111eb
+	x ^= x >> 31
+	return x
+}
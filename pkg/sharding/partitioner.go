@@ -0,0 +1,183 @@
+package sharding
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+)
+
+const (
+	StrategyModulo     = "modulo"
+	StrategyRing       = "ring"
+	StrategyRendezvous = "rendezvous"
+	StrategyJump       = "jump"
+)
+
+// Partitioner decides which shard owns a key. Every node of a cluster has to
+// use identical settings, otherwise keys are silently misrouted.
+type Partitioner interface {
+	ShardFromKey(key string) Shard
+	Shards() []Shard
+	Settings() PartitionerSettings
+}
+
+type PartitionerSettings struct {
+	Strategy     string
+	HashFunction string
+	VirtualNodes int
+	HashTags     bool
+}
+
+// Fingerprint identifies the settings together with the shard ids and
+// weights, which is everything that affects where a key is placed.
+func (s PartitionerSettings) Fingerprint(shards []Shard) string {
+	sorted := append([]Shard(nil), shards...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].ID < sorted[j].ID })
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "strategy=%s;hash=%s", s.Strategy, s.HashFunction)
+	if s.HashTags {
+		b.WriteString(";hash_tags")
+	}
+	if s.Strategy == StrategyRing {
+		fmt.Fprintf(&b, ";virtual_nodes=%d", s.VirtualNodes)
+	}
+	for _, shard := range sorted {
+		fmt.Fprintf(&b, ";shard=%d", shard.ID)
+		if s.Strategy == StrategyRing || s.Strategy == StrategyRendezvous {
+			fmt.Fprintf(&b, "/%d", max(shard.Weight, 1))
+		}
+	}
+
+	sum := sha256.Sum256([]byte(b.String()))
+	return hex.EncodeToString(sum[:])
+}
+
+func NewPartitioner(settings PartitionerSettings, shards []Shard) (Partitioner, error) {
+	if len(shards) == 0 {
+		return nil, fmt.Errorf("partitioner requires at least one shard")
+	}
+
+	hash, err := HashFunctionByName(settings.HashFunction)
+	if err != nil {
+		return nil, err
+	}
+
+	if settings.HashTags {
+		hash = withHashTags(hash)
+	}
+
+	switch settings.Strategy {
+	case StrategyModulo:
+		return &Modulo{settings: settings, shards: shards, hash: hash}, nil
+	case StrategyRing:
+		return NewRing(settings, shards, hash), nil
+	case StrategyRendezvous:
+		return &Rendezvous{settings: settings, shards: shards, hash: hash}, nil
+	case StrategyJump:
+		return NewJump(settings, shards, hash), nil
+	default:
+		return nil, fmt.Errorf("unknown partitioner strategy: %s", settings.Strategy)
+	}
+}
+
+// Modulo places a key on the shard whose id equals its hash modulo the shard
+// count, it expects shard ids to run from 0 to n-1.
+type Modulo struct {
+	settings PartitionerSettings
+	shards   []Shard
+	hash     HashFunc
+}
+
+func (m *Modulo) ShardFromKey(key string) Shard {
+	return ShardFromHashSum(m.hash(key), m.shards)
+}
+
+func (m *Modulo) Shards() []Shard {
+	return m.shards
+}
+
+func (m *Modulo) Settings() PartitionerSettings {
+	return m.settings
+}
+
+// Rendezvous implements weighted highest random weight hashing, every shard
+// scores the key and the highest score wins.
+type Rendezvous struct {
+	settings PartitionerSettings
+	shards   []Shard
+	hash     HashFunc
+}
+
+func (r *Rendezvous) ShardFromKey(key string) Shard {
+	hashSum := r.hash(key)
+
+	var best Shard
+	bestScore := math.Inf(-1)
+	for _, shard := range r.shards {
+		// map the combined hash onto (0, 1) and apply the weighted score
+		// -w/ln(u), which keeps each shard's share proportional to its weight
+		combined := Mix64(hashSum ^ Mix64(uint64(shard.ID)+1))
+		u := (float64(combined>>11) + 0.5) / (1 << 53)
+		score := -float64(max(shard.Weight, 1)) / math.Log(u)
+
+		if score > bestScore || (score == bestScore && shard.ID < best.ID) {
+			best = shard
+			bestScore = score
+		}
+	}
+
+	return best
+}
+
+func (r *Rendezvous) Shards() []Shard {
+	return r.shards
+}
+
+func (r *Rendezvous) Settings() PartitionerSettings {
+	return r.settings
+}
+
+// Jump implements jump consistent hashing over the shards ordered by id. It
+// needs no extra memory but ignores weights and only moves keys optimally
+// when shards are added or removed at the end of the id range.
+type Jump struct {
+	settings PartitionerSettings
+	shards   []Shard
+	hash     HashFunc
+}
+
+func NewJump(settings PartitionerSettings, shards []Shard, hash HashFunc) *Jump {
+	sorted := append([]Shard(nil), shards...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].ID < sorted[j].ID })
+
+	return &Jump{settings: settings, shards: sorted, hash: hash}
+}
+
+func (j *Jump) ShardFromKey(key string) Shard {
+	return j.shards[jumpHash(j.hash(key), len(j.shards))]
+}
+
+func (j *Jump) Shards() []Shard {
+	return j.shards
+}
+
+func (j *Jump) Settings() PartitionerSettings {
+	return j.settings
+}
+
+// jumpHash is the algorithm from Lamping and Veach, "A Fast, Minimal Memory,
+// Consistent Hash Algorithm".
+func jumpHash(key uint64, buckets int) int {
+	var b, j int64 = -1, 0
+	for j < int64(buckets) {
+		b = j
+		key = key*2862933555777941757 + 1
+		j = int64(float64(b+1) * (float64(int64(1)<<31) / float64((key>>33)+1)))
+	}
+
+	return int(b)
+}
@@ -0,0 +1,81 @@
+package sharding
+
+import (
+	"fmt"
+	"sort"
+)
+
+const DefaultVirtualNodes = 128
+
+type ringPoint struct {
+	hash    uint64
+	shardID int
+}
+
+// Ring places keys on a consistent hash ring where each shard owns
+// virtualNodes*weight points, so adding or removing a shard only moves the
+// keys between its points and their predecessors.
+type Ring struct {
+	settings PartitionerSettings
+	points   []ringPoint
+	shards   []Shard
+	hash     HashFunc
+}
+
+func NewRing(settings PartitionerSettings, shards []Shard, hash HashFunc) *Ring {
+	virtualNodes := settings.VirtualNodes
+	if virtualNodes <= 0 {
+		virtualNodes = DefaultVirtualNodes
+	}
+
+	r := &Ring{settings: settings, shards: shards, hash: hash}
+	for _, shard := range shards {
+		weight := shard.Weight
+		if weight <= 0 {
+			weight = 1
+		}
+
+		// points are derived from the shard id rather than its address, so
+		// re-addressing a shard does not move any keys
+		for i := 0; i < virtualNodes*weight; i++ {
+			r.points = append(r.points, ringPoint{
+				hash:    Mix64(hash(fmt.Sprintf("shard-%d-%d", shard.ID, i))),
+				shardID: shard.ID,
+			})
+		}
+	}
+
+	sort.Slice(r.points, func(i, j int) bool {
+		if r.points[i].hash != r.points[j].hash {
+			return r.points[i].hash < r.points[j].hash
+		}
+		return r.points[i].shardID < r.points[j].shardID
+	})
+
+	return r
+}
+
+func (r *Ring) ShardFromKey(key string) Shard {
+	if len(r.points) == 0 {
+		return Shard{}
+	}
+
+	hashSum := Mix64(r.hash(key))
+	i := sort.Search(len(r.points), func(i int) bool {
+		return r.points[i].hash >= hashSum
+	})
+	if i == len(r.points) {
+		i = 0
+	}
+
+	shard, _ := FindShardById(r.shards, r.points[i].shardID)
+	return shard
+}
+
+func (r *Ring) Shards() []Shard {
+	return r.shards
+}
+
+func (r *Ring) Settings() PartitionerSettings {
+	return r.settings
+}
@@ -1,9 +1,20 @@
 package sharding
 
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// MetadataKey carries the id of the shard a request is meant for, which a
+// node serving several shards needs to hand it to the right one.
+const MetadataKey = "nilis-shard-id"
+
 type Shard struct {
 	ID       int
 	Address  string
 	Replicas []Replica
+	Weight   int
 }
 
 type Replica struct {
@@ -19,3 +30,25 @@ func FindShardById(shards []Shard, id int) (Shard, bool) {
 
 	return Shard{}, false
 }
+
+// SessionID prefixes a session token with the shard holding the session, so
+// shards owning its keys and clients know where to find it.
+func SessionID(shardID int, token string) string {
+	return fmt.Sprintf("%d-%s", shardID, token)
+}
+
+// SessionShard returns the shard holding a session, false for ids that do
+// not name one.
+func SessionShard(id string) (int, bool) {
+	prefix, _, ok := strings.Cut(id, "-")
+	if !ok {
+		return 0, false
+	}
+
+	shardID, err := strconv.Atoi(prefix)
+	if err != nil {
+		return 0, false
+	}
+
+	return shardID, true
+}
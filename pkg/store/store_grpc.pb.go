@@ -20,9 +20,37 @@ import (
 const _ = grpc.SupportPackageIsVersion9
 
 const (
-	Store_Set_FullMethodName    = "/store.Store/Set"
-	Store_Get_FullMethodName    = "/store.Store/Get"
-	Store_Delete_FullMethodName = "/store.Store/Delete"
+	Store_Set_FullMethodName                   = "/store.Store/Set"
+	Store_Get_FullMethodName                   = "/store.Store/Get"
+	Store_Delete_FullMethodName                = "/store.Store/Delete"
+	Store_DeleteRange_FullMethodName           = "/store.Store/DeleteRange"
+	Store_MultiGet_FullMethodName              = "/store.Store/MultiGet"
+	Store_Scan_FullMethodName                  = "/store.Store/Scan"
+	Store_CreateSession_FullMethodName         = "/store.Store/CreateSession"
+	Store_Heartbeat_FullMethodName             = "/store.Store/Heartbeat"
+	Store_CloseSession_FullMethodName          = "/store.Store/CloseSession"
+	Store_HashSet_FullMethodName               = "/store.Store/HashSet"
+	Store_HashGet_FullMethodName               = "/store.Store/HashGet"
+	Store_HashGetAll_FullMethodName            = "/store.Store/HashGetAll"
+	Store_HashDelete_FullMethodName            = "/store.Store/HashDelete"
+	Store_ListPush_FullMethodName              = "/store.Store/ListPush"
+	Store_ListPop_FullMethodName               = "/store.Store/ListPop"
+	Store_ListRange_FullMethodName             = "/store.Store/ListRange"
+	Store_SetAdd_FullMethodName                = "/store.Store/SetAdd"
+	Store_SetRemove_FullMethodName             = "/store.Store/SetRemove"
+	Store_SetMembers_FullMethodName            = "/store.Store/SetMembers"
+	Store_SortedSetAdd_FullMethodName          = "/store.Store/SortedSetAdd"
+	Store_SortedSetRemove_FullMethodName       = "/store.Store/SortedSetRemove"
+	Store_SortedSetRank_FullMethodName         = "/store.Store/SortedSetRank"
+	Store_SortedSetRangeByRank_FullMethodName  = "/store.Store/SortedSetRangeByRank"
+	Store_SortedSetRangeByScore_FullMethodName = "/store.Store/SortedSetRangeByScore"
+	Store_Enqueue_FullMethodName               = "/store.Store/Enqueue"
+	Store_Dequeue_FullMethodName               = "/store.Store/Dequeue"
+	Store_Ack_FullMethodName                   = "/store.Store/Ack"
+	Store_Nack_FullMethodName                  = "/store.Store/Nack"
+	Store_GetCacheStats_FullMethodName         = "/store.Store/GetCacheStats"
+	Store_WatchEvictions_FullMethodName        = "/store.Store/WatchEvictions"
+	Store_GetShardMap_FullMethodName           = "/store.Store/GetShardMap"
 )
 
 // StoreClient is the client API for Store service.
@@ -32,6 +60,34 @@ type StoreClient interface {
 	Set(ctx context.Context, in *Value, opts ...grpc.CallOption) (*emptypb.Empty, error)
 	Get(ctx context.Context, in *Key, opts ...grpc.CallOption) (*Value, error)
 	Delete(ctx context.Context, in *Key, opts ...grpc.CallOption) (*emptypb.Empty, error)
+	DeleteRange(ctx context.Context, in *DeleteRangeRequest, opts ...grpc.CallOption) (*Count, error)
+	MultiGet(ctx context.Context, in *Keys, opts ...grpc.CallOption) (*KeyValues, error)
+	Scan(ctx context.Context, in *ScanRequest, opts ...grpc.CallOption) (*KeyValues, error)
+	CreateSession(ctx context.Context, in *SessionRequest, opts ...grpc.CallOption) (*Session, error)
+	Heartbeat(ctx context.Context, in *SessionID, opts ...grpc.CallOption) (*emptypb.Empty, error)
+	CloseSession(ctx context.Context, in *SessionID, opts ...grpc.CallOption) (*emptypb.Empty, error)
+	HashSet(ctx context.Context, in *HashSetRequest, opts ...grpc.CallOption) (*Count, error)
+	HashGet(ctx context.Context, in *HashField, opts ...grpc.CallOption) (*HashField, error)
+	HashGetAll(ctx context.Context, in *Key, opts ...grpc.CallOption) (*Hash, error)
+	HashDelete(ctx context.Context, in *HashFields, opts ...grpc.CallOption) (*Count, error)
+	ListPush(ctx context.Context, in *ListPushRequest, opts ...grpc.CallOption) (*Count, error)
+	ListPop(ctx context.Context, in *ListPopRequest, opts ...grpc.CallOption) (*Value, error)
+	ListRange(ctx context.Context, in *ListRangeRequest, opts ...grpc.CallOption) (*Members, error)
+	SetAdd(ctx context.Context, in *Members, opts ...grpc.CallOption) (*Count, error)
+	SetRemove(ctx context.Context, in *Members, opts ...grpc.CallOption) (*Count, error)
+	SetMembers(ctx context.Context, in *Key, opts ...grpc.CallOption) (*Members, error)
+	SortedSetAdd(ctx context.Context, in *ScoredMembers, opts ...grpc.CallOption) (*Count, error)
+	SortedSetRemove(ctx context.Context, in *Members, opts ...grpc.CallOption) (*Count, error)
+	SortedSetRank(ctx context.Context, in *SortedSetMember, opts ...grpc.CallOption) (*Rank, error)
+	SortedSetRangeByRank(ctx context.Context, in *RankRangeRequest, opts ...grpc.CallOption) (*ScoredMembers, error)
+	SortedSetRangeByScore(ctx context.Context, in *ScoreRangeRequest, opts ...grpc.CallOption) (*ScoredMembers, error)
+	Enqueue(ctx context.Context, in *EnqueueRequest, opts ...grpc.CallOption) (*MessageIDs, error)
+	Dequeue(ctx context.Context, in *DequeueRequest, opts ...grpc.CallOption) (*QueueMessages, error)
+	Ack(ctx context.Context, in *Receipt, opts ...grpc.CallOption) (*emptypb.Empty, error)
+	Nack(ctx context.Context, in *Receipt, opts ...grpc.CallOption) (*emptypb.Empty, error)
+	GetCacheStats(ctx context.Context, in *emptypb.Empty, opts ...grpc.CallOption) (*CacheStats, error)
+	WatchEvictions(ctx context.Context, in *emptypb.Empty, opts ...grpc.CallOption) (grpc.ServerStreamingClient[EvictionEvent], error)
+	GetShardMap(ctx context.Context, in *emptypb.Empty, opts ...grpc.CallOption) (*ShardMap, error)
 }
 
 type storeClient struct {
@@ -72,6 +128,295 @@ func (c *storeClient) Delete(ctx context.Context, in *Key, opts ...grpc.CallOpti
 	return out, nil
 }
 
+func (c *storeClient) DeleteRange(ctx context.Context, in *DeleteRangeRequest, opts ...grpc.CallOption) (*Count, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(Count)
+	err := c.cc.Invoke(ctx, Store_DeleteRange_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *storeClient) MultiGet(ctx context.Context, in *Keys, opts ...grpc.CallOption) (*KeyValues, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(KeyValues)
+	err := c.cc.Invoke(ctx, Store_MultiGet_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *storeClient) Scan(ctx context.Context, in *ScanRequest, opts ...grpc.CallOption) (*KeyValues, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(KeyValues)
+	err := c.cc.Invoke(ctx, Store_Scan_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *storeClient) CreateSession(ctx context.Context, in *SessionRequest, opts ...grpc.CallOption) (*Session, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(Session)
+	err := c.cc.Invoke(ctx, Store_CreateSession_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *storeClient) Heartbeat(ctx context.Context, in *SessionID, opts ...grpc.CallOption) (*emptypb.Empty, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(emptypb.Empty)
+	err := c.cc.Invoke(ctx, Store_Heartbeat_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *storeClient) CloseSession(ctx context.Context, in *SessionID, opts ...grpc.CallOption) (*emptypb.Empty, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(emptypb.Empty)
+	err := c.cc.Invoke(ctx, Store_CloseSession_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *storeClient) HashSet(ctx context.Context, in *HashSetRequest, opts ...grpc.CallOption) (*Count, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(Count)
+	err := c.cc.Invoke(ctx, Store_HashSet_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *storeClient) HashGet(ctx context.Context, in *HashField, opts ...grpc.CallOption) (*HashField, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(HashField)
+	err := c.cc.Invoke(ctx, Store_HashGet_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *storeClient) HashGetAll(ctx context.Context, in *Key, opts ...grpc.CallOption) (*Hash, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(Hash)
+	err := c.cc.Invoke(ctx, Store_HashGetAll_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *storeClient) HashDelete(ctx context.Context, in *HashFields, opts ...grpc.CallOption) (*Count, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(Count)
+	err := c.cc.Invoke(ctx, Store_HashDelete_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *storeClient) ListPush(ctx context.Context, in *ListPushRequest, opts ...grpc.CallOption) (*Count, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(Count)
+	err := c.cc.Invoke(ctx, Store_ListPush_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *storeClient) ListPop(ctx context.Context, in *ListPopRequest, opts ...grpc.CallOption) (*Value, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(Value)
+	err := c.cc.Invoke(ctx, Store_ListPop_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *storeClient) ListRange(ctx context.Context, in *ListRangeRequest, opts ...grpc.CallOption) (*Members, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(Members)
+	err := c.cc.Invoke(ctx, Store_ListRange_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *storeClient) SetAdd(ctx context.Context, in *Members, opts ...grpc.CallOption) (*Count, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(Count)
+	err := c.cc.Invoke(ctx, Store_SetAdd_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *storeClient) SetRemove(ctx context.Context, in *Members, opts ...grpc.CallOption) (*Count, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(Count)
+	err := c.cc.Invoke(ctx, Store_SetRemove_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *storeClient) SetMembers(ctx context.Context, in *Key, opts ...grpc.CallOption) (*Members, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(Members)
+	err := c.cc.Invoke(ctx, Store_SetMembers_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *storeClient) SortedSetAdd(ctx context.Context, in *ScoredMembers, opts ...grpc.CallOption) (*Count, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(Count)
+	err := c.cc.Invoke(ctx, Store_SortedSetAdd_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *storeClient) SortedSetRemove(ctx context.Context, in *Members, opts ...grpc.CallOption) (*Count, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(Count)
+	err := c.cc.Invoke(ctx, Store_SortedSetRemove_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *storeClient) SortedSetRank(ctx context.Context, in *SortedSetMember, opts ...grpc.CallOption) (*Rank, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(Rank)
+	err := c.cc.Invoke(ctx, Store_SortedSetRank_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *storeClient) SortedSetRangeByRank(ctx context.Context, in *RankRangeRequest, opts ...grpc.CallOption) (*ScoredMembers, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ScoredMembers)
+	err := c.cc.Invoke(ctx, Store_SortedSetRangeByRank_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *storeClient) SortedSetRangeByScore(ctx context.Context, in *ScoreRangeRequest, opts ...grpc.CallOption) (*ScoredMembers, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ScoredMembers)
+	err := c.cc.Invoke(ctx, Store_SortedSetRangeByScore_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *storeClient) Enqueue(ctx context.Context, in *EnqueueRequest, opts ...grpc.CallOption) (*MessageIDs, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(MessageIDs)
+	err := c.cc.Invoke(ctx, Store_Enqueue_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *storeClient) Dequeue(ctx context.Context, in *DequeueRequest, opts ...grpc.CallOption) (*QueueMessages, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(QueueMessages)
+	err := c.cc.Invoke(ctx, Store_Dequeue_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *storeClient) Ack(ctx context.Context, in *Receipt, opts ...grpc.CallOption) (*emptypb.Empty, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(emptypb.Empty)
+	err := c.cc.Invoke(ctx, Store_Ack_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *storeClient) Nack(ctx context.Context, in *Receipt, opts ...grpc.CallOption) (*emptypb.Empty, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(emptypb.Empty)
+	err := c.cc.Invoke(ctx, Store_Nack_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *storeClient) GetCacheStats(ctx context.Context, in *emptypb.Empty, opts ...grpc.CallOption) (*CacheStats, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(CacheStats)
+	err := c.cc.Invoke(ctx, Store_GetCacheStats_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *storeClient) WatchEvictions(ctx context.Context, in *emptypb.Empty, opts ...grpc.CallOption) (grpc.ServerStreamingClient[EvictionEvent], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &Store_ServiceDesc.Streams[0], Store_WatchEvictions_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[emptypb.Empty, EvictionEvent]{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type Store_WatchEvictionsClient = grpc.ServerStreamingClient[EvictionEvent]
+
+func (c *storeClient) GetShardMap(ctx context.Context, in *emptypb.Empty, opts ...grpc.CallOption) (*ShardMap, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ShardMap)
+	err := c.cc.Invoke(ctx, Store_GetShardMap_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 // StoreServer is the server API for Store service.
 // All implementations must embed UnimplementedStoreServer
 // for forward compatibility.
@@ -79,6 +424,34 @@ type StoreServer interface {
 	Set(context.Context, *Value) (*emptypb.Empty, error)
 	Get(context.Context, *Key) (*Value, error)
 	Delete(context.Context, *Key) (*emptypb.Empty, error)
+	DeleteRange(context.Context, *DeleteRangeRequest) (*Count, error)
+	MultiGet(context.Context, *Keys) (*KeyValues, error)
+	Scan(context.Context, *ScanRequest) (*KeyValues, error)
+	CreateSession(context.Context, *SessionRequest) (*Session, error)
+	Heartbeat(context.Context, *SessionID) (*emptypb.Empty, error)
+	CloseSession(context.Context, *SessionID) (*emptypb.Empty, error)
+	HashSet(context.Context, *HashSetRequest) (*Count, error)
+	HashGet(context.Context, *HashField) (*HashField, error)
+	HashGetAll(context.Context, *Key) (*Hash, error)
+	HashDelete(context.Context, *HashFields) (*Count, error)
+	ListPush(context.Context, *ListPushRequest) (*Count, error)
+	ListPop(context.Context, *ListPopRequest) (*Value, error)
+	ListRange(context.Context, *ListRangeRequest) (*Members, error)
+	SetAdd(context.Context, *Members) (*Count, error)
+	SetRemove(context.Context, *Members) (*Count, error)
+	SetMembers(context.Context, *Key) (*Members, error)
+	SortedSetAdd(context.Context, *ScoredMembers) (*Count, error)
+	SortedSetRemove(context.Context, *Members) (*Count, error)
+	SortedSetRank(context.Context, *SortedSetMember) (*Rank, error)
+	SortedSetRangeByRank(context.Context, *RankRangeRequest) (*ScoredMembers, error)
+	SortedSetRangeByScore(context.Context, *ScoreRangeRequest) (*ScoredMembers, error)
+	Enqueue(context.Context, *EnqueueRequest) (*MessageIDs, error)
+	Dequeue(context.Context, *DequeueRequest) (*QueueMessages, error)
+	Ack(context.Context, *Receipt) (*emptypb.Empty, error)
+	Nack(context.Context, *Receipt) (*emptypb.Empty, error)
+	GetCacheStats(context.Context, *emptypb.Empty) (*CacheStats, error)
+	WatchEvictions(*emptypb.Empty, grpc.ServerStreamingServer[EvictionEvent]) error
+	GetShardMap(context.Context, *emptypb.Empty) (*ShardMap, error)
 	mustEmbedUnimplementedStoreServer()
 }
 
@@ -98,6 +471,90 @@ func (UnimplementedStoreServer) Get(context.Context, *Key) (*Value, error) {
 func (UnimplementedStoreServer) Delete(context.Context, *Key) (*emptypb.Empty, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method Delete not implemented")
 }
+func (UnimplementedStoreServer) DeleteRange(context.Context, *DeleteRangeRequest) (*Count, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method DeleteRange not implemented")
+}
+func (UnimplementedStoreServer) MultiGet(context.Context, *Keys) (*KeyValues, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method MultiGet not implemented")
+}
+func (UnimplementedStoreServer) Scan(context.Context, *ScanRequest) (*KeyValues, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Scan not implemented")
+}
+func (UnimplementedStoreServer) CreateSession(context.Context, *SessionRequest) (*Session, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method CreateSession not implemented")
+}
+func (UnimplementedStoreServer) Heartbeat(context.Context, *SessionID) (*emptypb.Empty, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Heartbeat not implemented")
+}
+func (UnimplementedStoreServer) CloseSession(context.Context, *SessionID) (*emptypb.Empty, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method CloseSession not implemented")
+}
+func (UnimplementedStoreServer) HashSet(context.Context, *HashSetRequest) (*Count, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method HashSet not implemented")
+}
+func (UnimplementedStoreServer) HashGet(context.Context, *HashField) (*HashField, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method HashGet not implemented")
+}
+func (UnimplementedStoreServer) HashGetAll(context.Context, *Key) (*Hash, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method HashGetAll not implemented")
+}
+func (UnimplementedStoreServer) HashDelete(context.Context, *HashFields) (*Count, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method HashDelete not implemented")
+}
+func (UnimplementedStoreServer) ListPush(context.Context, *ListPushRequest) (*Count, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListPush not implemented")
+}
+func (UnimplementedStoreServer) ListPop(context.Context, *ListPopRequest) (*Value, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListPop not implemented")
+}
+func (UnimplementedStoreServer) ListRange(context.Context, *ListRangeRequest) (*Members, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListRange not implemented")
+}
+func (UnimplementedStoreServer) SetAdd(context.Context, *Members) (*Count, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method SetAdd not implemented")
+}
+func (UnimplementedStoreServer) SetRemove(context.Context, *Members) (*Count, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method SetRemove not implemented")
+}
+func (UnimplementedStoreServer) SetMembers(context.Context, *Key) (*Members, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method SetMembers not implemented")
+}
+func (UnimplementedStoreServer) SortedSetAdd(context.Context, *ScoredMembers) (*Count, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method SortedSetAdd not implemented")
+}
+func (UnimplementedStoreServer) SortedSetRemove(context.Context, *Members) (*Count, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method SortedSetRemove not implemented")
+}
+func (UnimplementedStoreServer) SortedSetRank(context.Context, *SortedSetMember) (*Rank, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method SortedSetRank not implemented")
+}
+func (UnimplementedStoreServer) SortedSetRangeByRank(context.Context, *RankRangeRequest) (*ScoredMembers, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method SortedSetRangeByRank not implemented")
+}
+func (UnimplementedStoreServer) SortedSetRangeByScore(context.Context, *ScoreRangeRequest) (*ScoredMembers, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method SortedSetRangeByScore not implemented")
+}
+func (UnimplementedStoreServer) Enqueue(context.Context, *EnqueueRequest) (*MessageIDs, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Enqueue not implemented")
+}
+func (UnimplementedStoreServer) Dequeue(context.Context, *DequeueRequest) (*QueueMessages, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Dequeue not implemented")
+}
+func (UnimplementedStoreServer) Ack(context.Context, *Receipt) (*emptypb.Empty, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Ack not implemented")
+}
+func (UnimplementedStoreServer) Nack(context.Context, *Receipt) (*emptypb.Empty, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Nack not implemented")
+}
+func (UnimplementedStoreServer) GetCacheStats(context.Context, *emptypb.Empty) (*CacheStats, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetCacheStats not implemented")
+}
+func (UnimplementedStoreServer) WatchEvictions(*emptypb.Empty, grpc.ServerStreamingServer[EvictionEvent]) error {
+	return status.Errorf(codes.Unimplemented, "method WatchEvictions not implemented")
+}
+func (UnimplementedStoreServer) GetShardMap(context.Context, *emptypb.Empty) (*ShardMap, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetShardMap not implemented")
+}
 func (UnimplementedStoreServer) mustEmbedUnimplementedStoreServer() {}
 func (UnimplementedStoreServer) testEmbeddedByValue()               {}
 
@@ -173,26 +630,1722 @@ func _Store_Delete_Handler(srv interface{}, ctx context.Context, dec func(interf
 	return interceptor(ctx, in, info, handler)
 }
 
-// Store_ServiceDesc is the grpc.ServiceDesc for Store service.
-// It's only intended for direct use with grpc.RegisterService,
-// and not to be introspected or modified (even as a copy)
-var Store_ServiceDesc = grpc.ServiceDesc{
-	ServiceName: "store.Store",
-	HandlerType: (*StoreServer)(nil),
-	Methods: []grpc.MethodDesc{
-		{
-			MethodName: "Set",
-			Handler:    _Store_Set_Handler,
-		},
-		{
-			MethodName: "Get",
-			Handler:    _Store_Get_Handler,
-		},
-		{
-			MethodName: "Delete",
-			Handler:    _Store_Delete_Handler,
+func _Store_DeleteRange_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(DeleteRangeRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(StoreServer).DeleteRange(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Store_DeleteRange_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(StoreServer).DeleteRange(ctx, req.(*DeleteRangeRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Store_MultiGet_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(Keys)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(StoreServer).MultiGet(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Store_MultiGet_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(StoreServer).MultiGet(ctx, req.(*Keys))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Store_Scan_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ScanRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(StoreServer).Scan(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Store_Scan_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(StoreServer).Scan(ctx, req.(*ScanRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Store_CreateSession_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(SessionRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(StoreServer).CreateSession(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Store_CreateSession_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(StoreServer).CreateSession(ctx, req.(*SessionRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Store_Heartbeat_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(SessionID)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(StoreServer).Heartbeat(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Store_Heartbeat_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(StoreServer).Heartbeat(ctx, req.(*SessionID))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Store_CloseSession_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(SessionID)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(StoreServer).CloseSession(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Store_CloseSession_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(StoreServer).CloseSession(ctx, req.(*SessionID))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Store_HashSet_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(HashSetRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(StoreServer).HashSet(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Store_HashSet_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(StoreServer).HashSet(ctx, req.(*HashSetRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Store_HashGet_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(HashField)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(StoreServer).HashGet(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Store_HashGet_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(StoreServer).HashGet(ctx, req.(*HashField))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Store_HashGetAll_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(Key)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(StoreServer).HashGetAll(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Store_HashGetAll_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(StoreServer).HashGetAll(ctx, req.(*Key))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Store_HashDelete_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(HashFields)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(StoreServer).HashDelete(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Store_HashDelete_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(StoreServer).HashDelete(ctx, req.(*HashFields))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Store_ListPush_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListPushRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(StoreServer).ListPush(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Store_ListPush_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(StoreServer).ListPush(ctx, req.(*ListPushRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Store_ListPop_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListPopRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(StoreServer).ListPop(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Store_ListPop_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(StoreServer).ListPop(ctx, req.(*ListPopRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Store_ListRange_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListRangeRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(StoreServer).ListRange(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Store_ListRange_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(StoreServer).ListRange(ctx, req.(*ListRangeRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Store_SetAdd_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(Members)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(StoreServer).SetAdd(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Store_SetAdd_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(StoreServer).SetAdd(ctx, req.(*Members))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Store_SetRemove_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(Members)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(StoreServer).SetRemove(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Store_SetRemove_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(StoreServer).SetRemove(ctx, req.(*Members))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Store_SetMembers_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(Key)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(StoreServer).SetMembers(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Store_SetMembers_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(StoreServer).SetMembers(ctx, req.(*Key))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Store_SortedSetAdd_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ScoredMembers)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(StoreServer).SortedSetAdd(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Store_SortedSetAdd_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(StoreServer).SortedSetAdd(ctx, req.(*ScoredMembers))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Store_SortedSetRemove_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(Members)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(StoreServer).SortedSetRemove(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Store_SortedSetRemove_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(StoreServer).SortedSetRemove(ctx, req.(*Members))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Store_SortedSetRank_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(SortedSetMember)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(StoreServer).SortedSetRank(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Store_SortedSetRank_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(StoreServer).SortedSetRank(ctx, req.(*SortedSetMember))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Store_SortedSetRangeByRank_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(RankRangeRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(StoreServer).SortedSetRangeByRank(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Store_SortedSetRangeByRank_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(StoreServer).SortedSetRangeByRank(ctx, req.(*RankRangeRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Store_SortedSetRangeByScore_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ScoreRangeRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(StoreServer).SortedSetRangeByScore(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Store_SortedSetRangeByScore_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(StoreServer).SortedSetRangeByScore(ctx, req.(*ScoreRangeRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Store_Enqueue_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(EnqueueRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(StoreServer).Enqueue(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Store_Enqueue_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(StoreServer).Enqueue(ctx, req.(*EnqueueRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Store_Dequeue_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(DequeueRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(StoreServer).Dequeue(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Store_Dequeue_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(StoreServer).Dequeue(ctx, req.(*DequeueRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Store_Ack_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(Receipt)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(StoreServer).Ack(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Store_Ack_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(StoreServer).Ack(ctx, req.(*Receipt))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Store_Nack_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(Receipt)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(StoreServer).Nack(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Store_Nack_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(StoreServer).Nack(ctx, req.(*Receipt))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Store_GetCacheStats_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(emptypb.Empty)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(StoreServer).GetCacheStats(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Store_GetCacheStats_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(StoreServer).GetCacheStats(ctx, req.(*emptypb.Empty))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Store_WatchEvictions_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(emptypb.Empty)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(StoreServer).WatchEvictions(m, &grpc.GenericServerStream[emptypb.Empty, EvictionEvent]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type Store_WatchEvictionsServer = grpc.ServerStreamingServer[EvictionEvent]
+
+func _Store_GetShardMap_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(emptypb.Empty)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(StoreServer).GetShardMap(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Store_GetShardMap_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(StoreServer).GetShardMap(ctx, req.(*emptypb.Empty))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// Store_ServiceDesc is the grpc.ServiceDesc for Store service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var Store_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "store.Store",
+	HandlerType: (*StoreServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "Set",
+			Handler:    _Store_Set_Handler,
+		},
+		{
+			MethodName: "Get",
+			Handler:    _Store_Get_Handler,
+		},
+		{
+			MethodName: "Delete",
+			Handler:    _Store_Delete_Handler,
+		},
+		{
+			MethodName: "DeleteRange",
+			Handler:    _Store_DeleteRange_Handler,
+		},
+		{
+			MethodName: "MultiGet",
+			Handler:    _Store_MultiGet_Handler,
+		},
+		{
+			MethodName: "Scan",
+			Handler:    _Store_Scan_Handler,
+		},
+		{
+			MethodName: "CreateSession",
+			Handler:    _Store_CreateSession_Handler,
+		},
+		{
+			MethodName: "Heartbeat",
+			Handler:    _Store_Heartbeat_Handler,
+		},
+		{
+			MethodName: "CloseSession",
+			Handler:    _Store_CloseSession_Handler,
+		},
+		{
+			MethodName: "HashSet",
+			Handler:    _Store_HashSet_Handler,
+		},
+		{
+			MethodName: "HashGet",
+			Handler:    _Store_HashGet_Handler,
+		},
+		{
+			MethodName: "HashGetAll",
+			Handler:    _Store_HashGetAll_Handler,
+		},
+		{
+			MethodName: "HashDelete",
+			Handler:    _Store_HashDelete_Handler,
+		},
+		{
+			MethodName: "ListPush",
+			Handler:    _Store_ListPush_Handler,
+		},
+		{
+			MethodName: "ListPop",
+			Handler:    _Store_ListPop_Handler,
+		},
+		{
+			MethodName: "ListRange",
+			Handler:    _Store_ListRange_Handler,
+		},
+		{
+			MethodName: "SetAdd",
+			Handler:    _Store_SetAdd_Handler,
+		},
+		{
+			MethodName: "SetRemove",
+			Handler:    _Store_SetRemove_Handler,
+		},
+		{
+			MethodName: "SetMembers",
+			Handler:    _Store_SetMembers_Handler,
+		},
+		{
+			MethodName: "SortedSetAdd",
+			Handler:    _Store_SortedSetAdd_Handler,
+		},
+		{
+			MethodName: "SortedSetRemove",
+			Handler:    _Store_SortedSetRemove_Handler,
+		},
+		{
+			MethodName: "SortedSetRank",
+			Handler:    _Store_SortedSetRank_Handler,
+		},
+		{
+			MethodName: "SortedSetRangeByRank",
+			Handler:    _Store_SortedSetRangeByRank_Handler,
+		},
+		{
+			MethodName: "SortedSetRangeByScore",
+			Handler:    _Store_SortedSetRangeByScore_Handler,
+		},
+		{
+			MethodName: "Enqueue",
+			Handler:    _Store_Enqueue_Handler,
+		},
+		{
+			MethodName: "Dequeue",
+			Handler:    _Store_Dequeue_Handler,
+		},
+		{
+			MethodName: "Ack",
+			Handler:    _Store_Ack_Handler,
+		},
+		{
+			MethodName: "Nack",
+			Handler:    _Store_Nack_Handler,
+		},
+		{
+			MethodName: "GetCacheStats",
+			Handler:    _Store_GetCacheStats_Handler,
+		},
+		{
+			MethodName: "GetShardMap",
+			Handler:    _Store_GetShardMap_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "WatchEvictions",
+			Handler:       _Store_WatchEvictions_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "store.proto",
+}
+
+const (
+	Cluster_Handshake_FullMethodName            = "/store.Cluster/Handshake"
+	Cluster_Ping_FullMethodName                 = "/store.Cluster/Ping"
+	Cluster_PingReq_FullMethodName              = "/store.Cluster/PingReq"
+	Cluster_ClusterStatus_FullMethodName        = "/store.Cluster/ClusterStatus"
+	Cluster_GetPoolStats_FullMethodName         = "/store.Cluster/GetPoolStats"
+	Cluster_GetOwnershipStats_FullMethodName    = "/store.Cluster/GetOwnershipStats"
+	Cluster_FindMisplacedKeys_FullMethodName    = "/store.Cluster/FindMisplacedKeys"
+	Cluster_CleanupOrphans_FullMethodName       = "/store.Cluster/CleanupOrphans"
+	Cluster_GetKeyStats_FullMethodName          = "/store.Cluster/GetKeyStats"
+	Cluster_GetHotKeys_FullMethodName           = "/store.Cluster/GetHotKeys"
+	Cluster_Backup_FullMethodName               = "/store.Cluster/Backup"
+	Cluster_LookupSession_FullMethodName        = "/store.Cluster/LookupSession"
+	Cluster_GetReplicationStatus_FullMethodName = "/store.Cluster/GetReplicationStatus"
+	Cluster_Replicate_FullMethodName            = "/store.Cluster/Replicate"
+	Cluster_StartReshard_FullMethodName         = "/store.Cluster/StartReshard"
+	Cluster_GetReshardStatus_FullMethodName     = "/store.Cluster/GetReshardStatus"
+	Cluster_PrepareReshard_FullMethodName       = "/store.Cluster/PrepareReshard"
+	Cluster_CommitReshard_FullMethodName        = "/store.Cluster/CommitReshard"
+	Cluster_AddShard_FullMethodName             = "/store.Cluster/AddShard"
+	Cluster_RemoveShard_FullMethodName          = "/store.Cluster/RemoveShard"
+	Cluster_UpdateShard_FullMethodName          = "/store.Cluster/UpdateShard"
+	Cluster_AddReplica_FullMethodName           = "/store.Cluster/AddReplica"
+	Cluster_RemoveReplica_FullMethodName        = "/store.Cluster/RemoveReplica"
+	Cluster_ApplyTopology_FullMethodName        = "/store.Cluster/ApplyTopology"
+	Cluster_ImportEntries_FullMethodName        = "/store.Cluster/ImportEntries"
+	Cluster_ExportEntries_FullMethodName        = "/store.Cluster/ExportEntries"
+	Cluster_DeleteEntries_FullMethodName        = "/store.Cluster/DeleteEntries"
+)
+
+// ClusterClient is the client API for Cluster service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type ClusterClient interface {
+	Handshake(ctx context.Context, in *PartitionerInfo, opts ...grpc.CallOption) (*PartitionerInfo, error)
+	Ping(ctx context.Context, in *GossipMessage, opts ...grpc.CallOption) (*GossipMessage, error)
+	PingReq(ctx context.Context, in *PingRequest, opts ...grpc.CallOption) (*GossipMessage, error)
+	ClusterStatus(ctx context.Context, in *emptypb.Empty, opts ...grpc.CallOption) (*ClusterState, error)
+	GetPoolStats(ctx context.Context, in *emptypb.Empty, opts ...grpc.CallOption) (*PoolStats, error)
+	GetOwnershipStats(ctx context.Context, in *emptypb.Empty, opts ...grpc.CallOption) (*OwnershipStats, error)
+	FindMisplacedKeys(ctx context.Context, in *MisplacedKeysRequest, opts ...grpc.CallOption) (*MisplacedKeys, error)
+	CleanupOrphans(ctx context.Context, in *OrphanCleanupRequest, opts ...grpc.CallOption) (*OrphanCleanupReport, error)
+	GetKeyStats(ctx context.Context, in *KeyStatsRequest, opts ...grpc.CallOption) (*KeyStats, error)
+	GetHotKeys(ctx context.Context, in *HotKeysRequest, opts ...grpc.CallOption) (*HotKeys, error)
+	Backup(ctx context.Context, in *BackupRequest, opts ...grpc.CallOption) (*BackupReport, error)
+	LookupSession(ctx context.Context, in *SessionID, opts ...grpc.CallOption) (*Session, error)
+	GetReplicationStatus(ctx context.Context, in *emptypb.Empty, opts ...grpc.CallOption) (*ReplicationStatus, error)
+	Replicate(ctx context.Context, opts ...grpc.CallOption) (grpc.BidiStreamingClient[ReplicationAck, ReplicationBatch], error)
+	StartReshard(ctx context.Context, in *Topology, opts ...grpc.CallOption) (*ReshardStatus, error)
+	GetReshardStatus(ctx context.Context, in *emptypb.Empty, opts ...grpc.CallOption) (*ReshardStatus, error)
+	PrepareReshard(ctx context.Context, in *PrepareReshardRequest, opts ...grpc.CallOption) (*emptypb.Empty, error)
+	CommitReshard(ctx context.Context, in *Epoch, opts ...grpc.CallOption) (*emptypb.Empty, error)
+	AddShard(ctx context.Context, in *ShardSpec, opts ...grpc.CallOption) (*ReshardStatus, error)
+	RemoveShard(ctx context.Context, in *ShardID, opts ...grpc.CallOption) (*ReshardStatus, error)
+	UpdateShard(ctx context.Context, in *ShardSpec, opts ...grpc.CallOption) (*ShardMap, error)
+	AddReplica(ctx context.Context, in *ReplicaRequest, opts ...grpc.CallOption) (*ShardMap, error)
+	RemoveReplica(ctx context.Context, in *ReplicaRequest, opts ...grpc.CallOption) (*ShardMap, error)
+	ApplyTopology(ctx context.Context, in *Topology, opts ...grpc.CallOption) (*emptypb.Empty, error)
+	ImportEntries(ctx context.Context, in *EntryBatch, opts ...grpc.CallOption) (*Count, error)
+	ExportEntries(ctx context.Context, in *EntryKeys, opts ...grpc.CallOption) (*EntryBatch, error)
+	DeleteEntries(ctx context.Context, in *EntryKeys, opts ...grpc.CallOption) (*Count, error)
+}
+
+type clusterClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewClusterClient(cc grpc.ClientConnInterface) ClusterClient {
+	return &clusterClient{cc}
+}
+
+func (c *clusterClient) Handshake(ctx context.Context, in *PartitionerInfo, opts ...grpc.CallOption) (*PartitionerInfo, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(PartitionerInfo)
+	err := c.cc.Invoke(ctx, Cluster_Handshake_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *clusterClient) Ping(ctx context.Context, in *GossipMessage, opts ...grpc.CallOption) (*GossipMessage, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(GossipMessage)
+	err := c.cc.Invoke(ctx, Cluster_Ping_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *clusterClient) PingReq(ctx context.Context, in *PingRequest, opts ...grpc.CallOption) (*GossipMessage, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(GossipMessage)
+	err := c.cc.Invoke(ctx, Cluster_PingReq_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *clusterClient) ClusterStatus(ctx context.Context, in *emptypb.Empty, opts ...grpc.CallOption) (*ClusterState, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ClusterState)
+	err := c.cc.Invoke(ctx, Cluster_ClusterStatus_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *clusterClient) GetPoolStats(ctx context.Context, in *emptypb.Empty, opts ...grpc.CallOption) (*PoolStats, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(PoolStats)
+	err := c.cc.Invoke(ctx, Cluster_GetPoolStats_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *clusterClient) GetOwnershipStats(ctx context.Context, in *emptypb.Empty, opts ...grpc.CallOption) (*OwnershipStats, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(OwnershipStats)
+	err := c.cc.Invoke(ctx, Cluster_GetOwnershipStats_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *clusterClient) FindMisplacedKeys(ctx context.Context, in *MisplacedKeysRequest, opts ...grpc.CallOption) (*MisplacedKeys, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(MisplacedKeys)
+	err := c.cc.Invoke(ctx, Cluster_FindMisplacedKeys_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *clusterClient) CleanupOrphans(ctx context.Context, in *OrphanCleanupRequest, opts ...grpc.CallOption) (*OrphanCleanupReport, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(OrphanCleanupReport)
+	err := c.cc.Invoke(ctx, Cluster_CleanupOrphans_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *clusterClient) GetKeyStats(ctx context.Context, in *KeyStatsRequest, opts ...grpc.CallOption) (*KeyStats, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(KeyStats)
+	err := c.cc.Invoke(ctx, Cluster_GetKeyStats_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *clusterClient) GetHotKeys(ctx context.Context, in *HotKeysRequest, opts ...grpc.CallOption) (*HotKeys, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(HotKeys)
+	err := c.cc.Invoke(ctx, Cluster_GetHotKeys_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *clusterClient) Backup(ctx context.Context, in *BackupRequest, opts ...grpc.CallOption) (*BackupReport, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(BackupReport)
+	err := c.cc.Invoke(ctx, Cluster_Backup_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *clusterClient) LookupSession(ctx context.Context, in *SessionID, opts ...grpc.CallOption) (*Session, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(Session)
+	err := c.cc.Invoke(ctx, Cluster_LookupSession_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *clusterClient) GetReplicationStatus(ctx context.Context, in *emptypb.Empty, opts ...grpc.CallOption) (*ReplicationStatus, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ReplicationStatus)
+	err := c.cc.Invoke(ctx, Cluster_GetReplicationStatus_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *clusterClient) Replicate(ctx context.Context, opts ...grpc.CallOption) (grpc.BidiStreamingClient[ReplicationAck, ReplicationBatch], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &Cluster_ServiceDesc.Streams[0], Cluster_Replicate_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[ReplicationAck, ReplicationBatch]{ClientStream: stream}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type Cluster_ReplicateClient = grpc.BidiStreamingClient[ReplicationAck, ReplicationBatch]
+
+func (c *clusterClient) StartReshard(ctx context.Context, in *Topology, opts ...grpc.CallOption) (*ReshardStatus, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ReshardStatus)
+	err := c.cc.Invoke(ctx, Cluster_StartReshard_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *clusterClient) GetReshardStatus(ctx context.Context, in *emptypb.Empty, opts ...grpc.CallOption) (*ReshardStatus, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ReshardStatus)
+	err := c.cc.Invoke(ctx, Cluster_GetReshardStatus_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *clusterClient) PrepareReshard(ctx context.Context, in *PrepareReshardRequest, opts ...grpc.CallOption) (*emptypb.Empty, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(emptypb.Empty)
+	err := c.cc.Invoke(ctx, Cluster_PrepareReshard_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *clusterClient) CommitReshard(ctx context.Context, in *Epoch, opts ...grpc.CallOption) (*emptypb.Empty, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(emptypb.Empty)
+	err := c.cc.Invoke(ctx, Cluster_CommitReshard_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *clusterClient) AddShard(ctx context.Context, in *ShardSpec, opts ...grpc.CallOption) (*ReshardStatus, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ReshardStatus)
+	err := c.cc.Invoke(ctx, Cluster_AddShard_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *clusterClient) RemoveShard(ctx context.Context, in *ShardID, opts ...grpc.CallOption) (*ReshardStatus, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ReshardStatus)
+	err := c.cc.Invoke(ctx, Cluster_RemoveShard_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *clusterClient) UpdateShard(ctx context.Context, in *ShardSpec, opts ...grpc.CallOption) (*ShardMap, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ShardMap)
+	err := c.cc.Invoke(ctx, Cluster_UpdateShard_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *clusterClient) AddReplica(ctx context.Context, in *ReplicaRequest, opts ...grpc.CallOption) (*ShardMap, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ShardMap)
+	err := c.cc.Invoke(ctx, Cluster_AddReplica_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *clusterClient) RemoveReplica(ctx context.Context, in *ReplicaRequest, opts ...grpc.CallOption) (*ShardMap, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ShardMap)
+	err := c.cc.Invoke(ctx, Cluster_RemoveReplica_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *clusterClient) ApplyTopology(ctx context.Context, in *Topology, opts ...grpc.CallOption) (*emptypb.Empty, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(emptypb.Empty)
+	err := c.cc.Invoke(ctx, Cluster_ApplyTopology_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *clusterClient) ImportEntries(ctx context.Context, in *EntryBatch, opts ...grpc.CallOption) (*Count, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(Count)
+	err := c.cc.Invoke(ctx, Cluster_ImportEntries_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *clusterClient) ExportEntries(ctx context.Context, in *EntryKeys, opts ...grpc.CallOption) (*EntryBatch, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(EntryBatch)
+	err := c.cc.Invoke(ctx, Cluster_ExportEntries_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *clusterClient) DeleteEntries(ctx context.Context, in *EntryKeys, opts ...grpc.CallOption) (*Count, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(Count)
+	err := c.cc.Invoke(ctx, Cluster_DeleteEntries_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// ClusterServer is the server API for Cluster service.
+// All implementations must embed UnimplementedClusterServer
+// for forward compatibility.
+type ClusterServer interface {
+	Handshake(context.Context, *PartitionerInfo) (*PartitionerInfo, error)
+	Ping(context.Context, *GossipMessage) (*GossipMessage, error)
+	PingReq(context.Context, *PingRequest) (*GossipMessage, error)
+	ClusterStatus(context.Context, *emptypb.Empty) (*ClusterState, error)
+	GetPoolStats(context.Context, *emptypb.Empty) (*PoolStats, error)
+	GetOwnershipStats(context.Context, *emptypb.Empty) (*OwnershipStats, error)
+	FindMisplacedKeys(context.Context, *MisplacedKeysRequest) (*MisplacedKeys, error)
+	CleanupOrphans(context.Context, *OrphanCleanupRequest) (*OrphanCleanupReport, error)
+	GetKeyStats(context.Context, *KeyStatsRequest) (*KeyStats, error)
+	GetHotKeys(context.Context, *HotKeysRequest) (*HotKeys, error)
+	Backup(context.Context, *BackupRequest) (*BackupReport, error)
+	LookupSession(context.Context, *SessionID) (*Session, error)
+	GetReplicationStatus(context.Context, *emptypb.Empty) (*ReplicationStatus, error)
+	Replicate(grpc.BidiStreamingServer[ReplicationAck, ReplicationBatch]) error
+	StartReshard(context.Context, *Topology) (*ReshardStatus, error)
+	GetReshardStatus(context.Context, *emptypb.Empty) (*ReshardStatus, error)
+	PrepareReshard(context.Context, *PrepareReshardRequest) (*emptypb.Empty, error)
+	CommitReshard(context.Context, *Epoch) (*emptypb.Empty, error)
+	AddShard(context.Context, *ShardSpec) (*ReshardStatus, error)
+	RemoveShard(context.Context, *ShardID) (*ReshardStatus, error)
+	UpdateShard(context.Context, *ShardSpec) (*ShardMap, error)
+	AddReplica(context.Context, *ReplicaRequest) (*ShardMap, error)
+	RemoveReplica(context.Context, *ReplicaRequest) (*ShardMap, error)
+	ApplyTopology(context.Context, *Topology) (*emptypb.Empty, error)
+	ImportEntries(context.Context, *EntryBatch) (*Count, error)
+	ExportEntries(context.Context, *EntryKeys) (*EntryBatch, error)
+	DeleteEntries(context.Context, *EntryKeys) (*Count, error)
+	mustEmbedUnimplementedClusterServer()
+}
+
+// UnimplementedClusterServer must be embedded to have
+// forward compatible implementations.
+//
+// NOTE: this should be embedded by value instead of pointer to avoid a nil
+// pointer dereference when methods are called.
+type UnimplementedClusterServer struct{}
+
+func (UnimplementedClusterServer) Handshake(context.Context, *PartitionerInfo) (*PartitionerInfo, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Handshake not implemented")
+}
+func (UnimplementedClusterServer) Ping(context.Context, *GossipMessage) (*GossipMessage, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Ping not implemented")
+}
+func (UnimplementedClusterServer) PingReq(context.Context, *PingRequest) (*GossipMessage, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method PingReq not implemented")
+}
+func (UnimplementedClusterServer) ClusterStatus(context.Context, *emptypb.Empty) (*ClusterState, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ClusterStatus not implemented")
+}
+func (UnimplementedClusterServer) GetPoolStats(context.Context, *emptypb.Empty) (*PoolStats, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetPoolStats not implemented")
+}
+func (UnimplementedClusterServer) GetOwnershipStats(context.Context, *emptypb.Empty) (*OwnershipStats, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetOwnershipStats not implemented")
+}
+func (UnimplementedClusterServer) FindMisplacedKeys(context.Context, *MisplacedKeysRequest) (*MisplacedKeys, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method FindMisplacedKeys not implemented")
+}
+func (UnimplementedClusterServer) CleanupOrphans(context.Context, *OrphanCleanupRequest) (*OrphanCleanupReport, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method CleanupOrphans not implemented")
+}
+func (UnimplementedClusterServer) GetKeyStats(context.Context, *KeyStatsRequest) (*KeyStats, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetKeyStats not implemented")
+}
+func (UnimplementedClusterServer) GetHotKeys(context.Context, *HotKeysRequest) (*HotKeys, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetHotKeys not implemented")
+}
+func (UnimplementedClusterServer) Backup(context.Context, *BackupRequest) (*BackupReport, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Backup not implemented")
+}
+func (UnimplementedClusterServer) LookupSession(context.Context, *SessionID) (*Session, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method LookupSession not implemented")
+}
+func (UnimplementedClusterServer) GetReplicationStatus(context.Context, *emptypb.Empty) (*ReplicationStatus, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetReplicationStatus not implemented")
+}
+func (UnimplementedClusterServer) Replicate(grpc.BidiStreamingServer[ReplicationAck, ReplicationBatch]) error {
+	return status.Errorf(codes.Unimplemented, "method Replicate not implemented")
+}
+func (UnimplementedClusterServer) StartReshard(context.Context, *Topology) (*ReshardStatus, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method StartReshard not implemented")
+}
+func (UnimplementedClusterServer) GetReshardStatus(context.Context, *emptypb.Empty) (*ReshardStatus, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetReshardStatus not implemented")
+}
+func (UnimplementedClusterServer) PrepareReshard(context.Context, *PrepareReshardRequest) (*emptypb.Empty, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method PrepareReshard not implemented")
+}
+func (UnimplementedClusterServer) CommitReshard(context.Context, *Epoch) (*emptypb.Empty, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method CommitReshard not implemented")
+}
+func (UnimplementedClusterServer) AddShard(context.Context, *ShardSpec) (*ReshardStatus, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method AddShard not implemented")
+}
+func (UnimplementedClusterServer) RemoveShard(context.Context, *ShardID) (*ReshardStatus, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method RemoveShard not implemented")
+}
+func (UnimplementedClusterServer) UpdateShard(context.Context, *ShardSpec) (*ShardMap, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method UpdateShard not implemented")
+}
+func (UnimplementedClusterServer) AddReplica(context.Context, *ReplicaRequest) (*ShardMap, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method AddReplica not implemented")
+}
+func (UnimplementedClusterServer) RemoveReplica(context.Context, *ReplicaRequest) (*ShardMap, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method RemoveReplica not implemented")
+}
+func (UnimplementedClusterServer) ApplyTopology(context.Context, *Topology) (*emptypb.Empty, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ApplyTopology not implemented")
+}
+func (UnimplementedClusterServer) ImportEntries(context.Context, *EntryBatch) (*Count, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ImportEntries not implemented")
+}
+func (UnimplementedClusterServer) ExportEntries(context.Context, *EntryKeys) (*EntryBatch, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ExportEntries not implemented")
+}
+func (UnimplementedClusterServer) DeleteEntries(context.Context, *EntryKeys) (*Count, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method DeleteEntries not implemented")
+}
+func (UnimplementedClusterServer) mustEmbedUnimplementedClusterServer() {}
+func (UnimplementedClusterServer) testEmbeddedByValue()                 {}
+
+// UnsafeClusterServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to ClusterServer will
+// result in compilation errors.
+type UnsafeClusterServer interface {
+	mustEmbedUnimplementedClusterServer()
+}
+
+func RegisterClusterServer(s grpc.ServiceRegistrar, srv ClusterServer) {
+	// If the following call pancis, it indicates UnimplementedClusterServer was
+	// embedded by pointer and is nil.  This will cause panics if an
+	// unimplemented method is ever invoked, so we test this at initialization
+	// time to prevent it from happening at runtime later due to I/O.
+	if t, ok := srv.(interface{ testEmbeddedByValue() }); ok {
+		t.testEmbeddedByValue()
+	}
+	s.RegisterService(&Cluster_ServiceDesc, srv)
+}
+
+func _Cluster_Handshake_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(PartitionerInfo)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ClusterServer).Handshake(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Cluster_Handshake_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ClusterServer).Handshake(ctx, req.(*PartitionerInfo))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Cluster_Ping_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GossipMessage)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ClusterServer).Ping(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Cluster_Ping_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ClusterServer).Ping(ctx, req.(*GossipMessage))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Cluster_PingReq_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(PingRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ClusterServer).PingReq(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Cluster_PingReq_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ClusterServer).PingReq(ctx, req.(*PingRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Cluster_ClusterStatus_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(emptypb.Empty)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ClusterServer).ClusterStatus(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Cluster_ClusterStatus_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ClusterServer).ClusterStatus(ctx, req.(*emptypb.Empty))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Cluster_GetPoolStats_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(emptypb.Empty)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ClusterServer).GetPoolStats(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Cluster_GetPoolStats_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ClusterServer).GetPoolStats(ctx, req.(*emptypb.Empty))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Cluster_GetOwnershipStats_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(emptypb.Empty)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ClusterServer).GetOwnershipStats(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Cluster_GetOwnershipStats_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ClusterServer).GetOwnershipStats(ctx, req.(*emptypb.Empty))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Cluster_FindMisplacedKeys_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(MisplacedKeysRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ClusterServer).FindMisplacedKeys(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Cluster_FindMisplacedKeys_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ClusterServer).FindMisplacedKeys(ctx, req.(*MisplacedKeysRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Cluster_CleanupOrphans_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(OrphanCleanupRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ClusterServer).CleanupOrphans(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Cluster_CleanupOrphans_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ClusterServer).CleanupOrphans(ctx, req.(*OrphanCleanupRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Cluster_GetKeyStats_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(KeyStatsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ClusterServer).GetKeyStats(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Cluster_GetKeyStats_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ClusterServer).GetKeyStats(ctx, req.(*KeyStatsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Cluster_GetHotKeys_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(HotKeysRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ClusterServer).GetHotKeys(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Cluster_GetHotKeys_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ClusterServer).GetHotKeys(ctx, req.(*HotKeysRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Cluster_Backup_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(BackupRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ClusterServer).Backup(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Cluster_Backup_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ClusterServer).Backup(ctx, req.(*BackupRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Cluster_LookupSession_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(SessionID)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ClusterServer).LookupSession(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Cluster_LookupSession_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ClusterServer).LookupSession(ctx, req.(*SessionID))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Cluster_GetReplicationStatus_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(emptypb.Empty)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ClusterServer).GetReplicationStatus(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Cluster_GetReplicationStatus_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ClusterServer).GetReplicationStatus(ctx, req.(*emptypb.Empty))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Cluster_Replicate_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(ClusterServer).Replicate(&grpc.GenericServerStream[ReplicationAck, ReplicationBatch]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type Cluster_ReplicateServer = grpc.BidiStreamingServer[ReplicationAck, ReplicationBatch]
+
+func _Cluster_StartReshard_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(Topology)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ClusterServer).StartReshard(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Cluster_StartReshard_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ClusterServer).StartReshard(ctx, req.(*Topology))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Cluster_GetReshardStatus_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(emptypb.Empty)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ClusterServer).GetReshardStatus(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Cluster_GetReshardStatus_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ClusterServer).GetReshardStatus(ctx, req.(*emptypb.Empty))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Cluster_PrepareReshard_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(PrepareReshardRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ClusterServer).PrepareReshard(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Cluster_PrepareReshard_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ClusterServer).PrepareReshard(ctx, req.(*PrepareReshardRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Cluster_CommitReshard_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(Epoch)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ClusterServer).CommitReshard(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Cluster_CommitReshard_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ClusterServer).CommitReshard(ctx, req.(*Epoch))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Cluster_AddShard_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ShardSpec)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ClusterServer).AddShard(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Cluster_AddShard_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ClusterServer).AddShard(ctx, req.(*ShardSpec))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Cluster_RemoveShard_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ShardID)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ClusterServer).RemoveShard(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Cluster_RemoveShard_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ClusterServer).RemoveShard(ctx, req.(*ShardID))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Cluster_UpdateShard_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ShardSpec)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ClusterServer).UpdateShard(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Cluster_UpdateShard_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ClusterServer).UpdateShard(ctx, req.(*ShardSpec))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Cluster_AddReplica_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ReplicaRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ClusterServer).AddReplica(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Cluster_AddReplica_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ClusterServer).AddReplica(ctx, req.(*ReplicaRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Cluster_RemoveReplica_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ReplicaRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ClusterServer).RemoveReplica(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Cluster_RemoveReplica_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ClusterServer).RemoveReplica(ctx, req.(*ReplicaRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Cluster_ApplyTopology_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(Topology)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ClusterServer).ApplyTopology(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Cluster_ApplyTopology_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ClusterServer).ApplyTopology(ctx, req.(*Topology))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Cluster_ImportEntries_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(EntryBatch)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ClusterServer).ImportEntries(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Cluster_ImportEntries_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ClusterServer).ImportEntries(ctx, req.(*EntryBatch))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Cluster_ExportEntries_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(EntryKeys)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ClusterServer).ExportEntries(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Cluster_ExportEntries_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ClusterServer).ExportEntries(ctx, req.(*EntryKeys))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Cluster_DeleteEntries_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(EntryKeys)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ClusterServer).DeleteEntries(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Cluster_DeleteEntries_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ClusterServer).DeleteEntries(ctx, req.(*EntryKeys))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// Cluster_ServiceDesc is the grpc.ServiceDesc for Cluster service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var Cluster_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "store.Cluster",
+	HandlerType: (*ClusterServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "Handshake",
+			Handler:    _Cluster_Handshake_Handler,
+		},
+		{
+			MethodName: "Ping",
+			Handler:    _Cluster_Ping_Handler,
+		},
+		{
+			MethodName: "PingReq",
+			Handler:    _Cluster_PingReq_Handler,
+		},
+		{
+			MethodName: "ClusterStatus",
+			Handler:    _Cluster_ClusterStatus_Handler,
+		},
+		{
+			MethodName: "GetPoolStats",
+			Handler:    _Cluster_GetPoolStats_Handler,
+		},
+		{
+			MethodName: "GetOwnershipStats",
+			Handler:    _Cluster_GetOwnershipStats_Handler,
+		},
+		{
+			MethodName: "FindMisplacedKeys",
+			Handler:    _Cluster_FindMisplacedKeys_Handler,
+		},
+		{
+			MethodName: "CleanupOrphans",
+			Handler:    _Cluster_CleanupOrphans_Handler,
+		},
+		{
+			MethodName: "GetKeyStats",
+			Handler:    _Cluster_GetKeyStats_Handler,
+		},
+		{
+			MethodName: "GetHotKeys",
+			Handler:    _Cluster_GetHotKeys_Handler,
+		},
+		{
+			MethodName: "Backup",
+			Handler:    _Cluster_Backup_Handler,
+		},
+		{
+			MethodName: "LookupSession",
+			Handler:    _Cluster_LookupSession_Handler,
+		},
+		{
+			MethodName: "GetReplicationStatus",
+			Handler:    _Cluster_GetReplicationStatus_Handler,
+		},
+		{
+			MethodName: "StartReshard",
+			Handler:    _Cluster_StartReshard_Handler,
+		},
+		{
+			MethodName: "GetReshardStatus",
+			Handler:    _Cluster_GetReshardStatus_Handler,
+		},
+		{
+			MethodName: "PrepareReshard",
+			Handler:    _Cluster_PrepareReshard_Handler,
+		},
+		{
+			MethodName: "CommitReshard",
+			Handler:    _Cluster_CommitReshard_Handler,
+		},
+		{
+			MethodName: "AddShard",
+			Handler:    _Cluster_AddShard_Handler,
+		},
+		{
+			MethodName: "RemoveShard",
+			Handler:    _Cluster_RemoveShard_Handler,
+		},
+		{
+			MethodName: "UpdateShard",
+			Handler:    _Cluster_UpdateShard_Handler,
+		},
+		{
+			MethodName: "AddReplica",
+			Handler:    _Cluster_AddReplica_Handler,
+		},
+		{
+			MethodName: "RemoveReplica",
+			Handler:    _Cluster_RemoveReplica_Handler,
+		},
+		{
+			MethodName: "ApplyTopology",
+			Handler:    _Cluster_ApplyTopology_Handler,
+		},
+		{
+			MethodName: "ImportEntries",
+			Handler:    _Cluster_ImportEntries_Handler,
+		},
+		{
+			MethodName: "ExportEntries",
+			Handler:    _Cluster_ExportEntries_Handler,
+		},
+		{
+			MethodName: "DeleteEntries",
+			Handler:    _Cluster_DeleteEntries_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "Replicate",
+			Handler:       _Cluster_Replicate_Handler,
+			ServerStreams: true,
+			ClientStreams: true,
 		},
 	},
-	Streams:  []grpc.StreamDesc{},
 	Metadata: "store.proto",
 }